@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// Email verification and password resets both mail the user a link with a
+// single-use token. Tokens expire, and issuing a new one for the same
+// purpose voids the user's older ones.
+
+const (
+	verifyEmailTokenTTL   = 48 * time.Hour
+	resetPasswordTokenTTL = time.Hour
+)
+
+var (
+	ErrInvalidUserToken = errors.New("invalid or expired link")
+	ErrEmailNotVerified = errors.New("verify your email address first")
+)
+
+// createUserToken voids the user's unused tokens for the purpose and issues
+// a new one.
+func (s *serviceImpl) createUserToken(ctx context.Context, userID int, purpose UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return "", fmt.Errorf("failed to void old tokens: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`, userID, purpose, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return token, nil
+}
+
+// useUserToken marks a valid token as used and returns its user.
+func useUserToken(ctx context.Context, tx *sql.Tx, purpose UserTokenPurpose, token string) (int, error) {
+	var userID int
+	err := tx.QueryRowContext(ctx, `
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`, hashToken(token), purpose,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidUserToken
+		}
+		return 0, fmt.Errorf("failed to use token: %w", err)
+	}
+	return userID, nil
+}
+
+func (s *serviceImpl) appLink(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// SendVerificationEmail mails the user a link to verify their address.
+func (s *serviceImpl) SendVerificationEmail(ctx context.Context, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var username, email string
+	var verified bool
+	err := s.db.QueryRowContext(ctx, `SELECT username, email, email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID).
+		Scan(&username, &email, &verified)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if verified {
+		return errors.New("email is already verified")
+	}
+
+	token, err := s.createUserToken(ctx, userID, USER_TOKEN_VERIFY_EMAIL, verifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, Mail{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email address:\n\n%s\n\nIt expires in %s.\n",
+			username, s.appLink("/verify-email", token), verifyEmailTokenTTL),
+	})
+}
+
+func (s *serviceImpl) VerifyEmail(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, err := useUserToken(ctx, tx, USER_TOKEN_VERIFY_EMAIL, token)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset mails a reset link if the address belongs to a user.
+// It succeeds either way, so it can't be used to probe for accounts.
+func (s *serviceImpl) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var userID int
+	var username string
+	err := s.db.QueryRowContext(ctx, `SELECT id, username FROM users WHERE lower(email) = lower($1)`, email).
+		Scan(&userID, &username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := s.createUserToken(ctx, userID, USER_TOKEN_RESET_PASSWORD, resetPasswordTokenTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, Mail{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to choose a new password:\n\n%s\n\n"+
+			"It expires in %s. If you didn't ask for this, you can ignore this email.\n",
+			username, s.appLink("/reset-password", token), resetPasswordTokenTTL),
+	})
+}
+
+// ResetPassword sets a new password, logs the user out everywhere and
+// revokes their API tokens. The mailed link proves ownership of the
+// address, so it also verifies it.
+func (s *serviceImpl) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, err := useUserToken(ctx, tx, USER_TOKEN_RESET_PASSWORD, token)
+	if err != nil {
+		return err
+	}
+
+	var username, email string
+	if err := tx.QueryRowContext(ctx, `SELECT username, email FROM users WHERE id = $1`, userID).Scan(&username, &email); err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := checkPasswordStrength(password, username, email); err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash the password: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users
+		SET hashed_password = $2, email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = $1`, userID, hashedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// Whoever knew the old password may have made tokens with it
+	_, err = tx.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		log.Printf("failed to revoke sessions of user %d after a password reset: %v", userID, err)
+	}
+	return nil
+}
+
+// requireVerifiedEmail returns ErrEmailNotVerified for unverified users.
+func (s *serviceImpl) requireVerifiedEmail(ctx context.Context, userID int) error {
+	var verified bool
+	err := s.db.QueryRowContext(ctx, `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&verified)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -2,154 +2,161 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
-	"google.golang.org/genai"
+	"github.com/redis/go-redis/v9"
+
+	"oj-be/prompts"
 )
 
+// Finished feedback is cached by prompt, so asking again for the same code
+// (a page reload, say) doesn't pay for another generation.
+const feedbackCacheTTL = 24 * time.Hour
+
+var ErrEmptyCode = errors.New("empty code provided")
+
+// AI builds the prompts for the AI features and sends them to the
+// configured provider.
 type AI struct {
-	aiClient            *genai.Client
-	service             serviceImpl
-	explanationTemplate string
-	feedbackTemplate    string
-	modelName           string
+	llm     LLMProvider
+	service *serviceImpl
+	prompts *prompts.Set
 }
 
-func NewAI(ctx context.Context, apiKey string, service serviceImpl, modelName, feedbackTemplate, explanationTemplate string) (*AI, error) {
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		return nil, err
-	}
+func NewAI(llm LLMProvider, service *serviceImpl, prompts *prompts.Set) *AI {
+	return &AI{llm: llm, service: service, prompts: prompts}
+}
 
-	for model, err := range client.Models.All(ctx) {
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Println("Model:", model.Name)
+// promptProblem is the part of a problem the prompts get to see.
+func promptProblem(problem *ProblemDetail) prompts.Problem {
+	return prompts.Problem{
+		Title:            problem.Title,
+		Description:      problem.Description,
+		Constraints:      problem.Constraints,
+		Explanation:      problem.Explanation,
+		SolutionLanguage: string(problem.SolutionLanguage),
+		SolutionCode:     problem.SolutionCode,
 	}
-
-	// log.Println(testResponse(ctx, modelName, client))
-
-	return &AI{
-		aiClient:            client,
-		service:             service,
-		explanationTemplate: explanationTemplate,
-		feedbackTemplate:    feedbackTemplate,
-		modelName:           modelName,
-	}, nil
 }
 
-func (ai *AI) AddProblemExplanation(problemID int) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
-	defer cancel()
-
+// problemForPrompt loads what the prompts need to know about a problem.
+func (ai *AI) problemForPrompt(ctx context.Context, problemID int) (prompts.Problem, error) {
 	problem, err := ai.service.GetProblemForAIByID(ctx, problemID)
 	if err != nil {
-		log.Println("[-] Error fetching problem for AI: ", err)
-		return
-	}
-
-	prompt := fmt.Sprintf(ai.explanationTemplate, problem.SolutionCode, problem.Constraints[0])
-
-	log.Println("Prompt : ", prompt)
-
-	var config *genai.GenerateContentConfig = &genai.GenerateContentConfig{Temperature: genai.Ptr[float32](0)}
-	result, err := ai.aiClient.Models.GenerateContent(ctx, ai.modelName, genai.Text(prompt), config)
-	if err != nil {
-		log.Fatal(err)
-		return
+		if errors.Is(err, sql.ErrNoRows) {
+			return prompts.Problem{}, ErrProblemNotFound
+		}
+		return prompts.Problem{}, fmt.Errorf("failed to fetch problem for AI: %w", err)
 	}
+	return promptProblem(problem), nil
+}
 
-	explanation := result.Text()
-
-	log.Println("Explanation received: ", explanation)
-
-	err = ai.service.UpdateProblemExplanation(ctx, problemID, explanation)
+// PreviewPrompt renders a prompt against a problem the way the AI features
+// would, without sending it. data.Problem is filled in from the problem.
+func (ai *AI) PreviewPrompt(ctx context.Context, problemID int, name string, data prompts.Data) (prompts.Prompt, error) {
+	problem, err := ai.problemForPrompt(ctx, problemID)
 	if err != nil {
-		log.Println("Error updating explanation : ", err)
+		return prompts.Prompt{}, err
 	}
+	data.Problem = problem
+	return ai.prompts.Render(name, data)
 }
 
-func (ai *AI) GetFeedback(ctx context.Context, problemID int, code string) string {
-	if strings.TrimSpace(code) == "" {
-		return "empty string"
+// AddProblemExplanation asks for an explanation of the reference solution
+// and stores it on the problem. It runs as an AI job, see ai_jobs.go.
+func (ai *AI) AddProblemExplanation(ctx context.Context, problemID int) (explanation, promptVersion string, err error) {
+	problem, err := ai.problemForPrompt(ctx, problemID)
+	if err != nil {
+		return "", "", err
 	}
-
-	problem, err := ai.service.GetProblemForAIByID(ctx, problemID)
+	prompt, err := ai.prompts.Render(prompts.Explanation, prompts.Data{Problem: problem})
 	if err != nil {
-		log.Println("Error fetching problem for AI : ", err)
-		return "invalid problem"
+		return "", "", err
 	}
 
-	prompt := fmt.Sprintf(ai.feedbackTemplate, problem.Explanation, code)
-
-	var config *genai.GenerateContentConfig = &genai.GenerateContentConfig{Temperature: genai.Ptr[float32](0)}
-	result, err := ai.aiClient.Models.GenerateContent(ctx, ai.modelName, genai.Text(prompt), config)
+	call := aiCall{feature: AI_FEATURE_EXPLANATION, problemID: problemID, promptVersion: prompt.Version}
+	explanation, err = ai.generate(ctx, call, LLMRequest{Prompt: prompt.Text, Temperature: 0})
 	if err != nil {
-		log.Fatal(err)
-		return "failed to get response from AI"
+		return "", "", err
 	}
+	log.Println("Explanation received for problem", problemID)
 
-	return result.Text()
-
-	// 	return strings.TrimSpace(`
-	// ### Feedback Summary
-
-	// Your solution correctly implements the brute-force approach for the Two Sum problem.
-
-	// ---
-
-	// ### ✅ What’s Good
-	// - The code is easy to read and well-indented.
-	// - You've handled the loop logic correctly and returned the correct indices.
-
-	// ---
-
-	// ### ⚠️ Suggestions for Improvement
-
-	// 1. **Time Complexity**
-	//    Your current solution has a time complexity of **O(n²)**. Consider using a **hash map** to reduce this to **O(n)**.
-
-	// 2. **Variable Naming**
-	//    Consider using more descriptive names for clarity.
-
-	// ---
-
-	// ### 💡 Recommended Code
-
-	// ` + "```" + `
-	// def two_sum(nums, target):
-	//     seen = {}
-	//     for i, num in enumerate(nums):
-	//         complement = target - num
-	//         if complement in seen:
-	//             return [seen[complement], i]
-	//         seen[num] = i
-	// ` + "```" + `
+	if err := ai.service.UpdateProblemExplanation(ctx, problemID, explanation, prompt.Version); err != nil {
+		return "", "", fmt.Errorf("failed to update explanation: %w", err)
+	}
+	return explanation, prompt.Version, nil
+}
 
-	// ---
+// cachedFeedback is a finished answer, kept with the prompt version that
+// produced it.
+type cachedFeedback struct {
+	Text          string
+	PromptVersion string
+}
 
-	// ✅ Passes basic test cases
-	// ⚠️ Could be optimized for performance
-	// `)
+func (ai *AI) GetFeedback(ctx context.Context, userID, problemID int, code string) (feedback, promptVersion string, err error) {
+	return ai.StreamFeedback(ctx, userID, problemID, code, func(string) error { return nil })
 }
 
-// TODO: remove this
-func testResponse(ctx context.Context, modelName string, client *genai.Client) string {
-	prompt := "explain quantum mechanics like I'm five."
+// StreamFeedback passes the feedback to onChunk as the provider generates
+// it. A cached answer is sent as a single chunk. When the user already ran
+// or submitted this code, the prompt includes how it failed, see
+// feedback.go.
+func (ai *AI) StreamFeedback(ctx context.Context, userID, problemID int, code string, onChunk func(string) error) (feedback, promptVersion string, err error) {
+	if strings.TrimSpace(code) == "" {
+		return "", "", ErrEmptyCode
+	}
+	// Checked again here, a queued job may run once a contest started
+	if err := ai.service.checkFeedbackAllowed(ctx, userID, problemID); err != nil {
+		return "", "", err
+	}
+	req := ai.service.feedbackRequest(userID, problemID, code)
 
-	var config *genai.GenerateContentConfig = &genai.GenerateContentConfig{Temperature: genai.Ptr[float32](0)}
-	result, err := client.Models.GenerateContent(ctx, modelName, genai.Text(prompt), config)
+	problem, err := ai.problemForPrompt(ctx, problemID)
+	if err != nil {
+		return "", "", err
+	}
+	prompt, err := ai.prompts.Render(prompts.Feedback, prompts.Data{
+		Problem:     problem,
+		Code:        req.Code,
+		Language:    req.Language,
+		Verdict:     req.Verdict,
+		Error:       req.Error,
+		FailingTest: req.FailingTest,
+		CodeChanged: req.CodeChanged,
+	})
 	if err != nil {
-		log.Fatal(err)
-		return "failed to get response from AI"
+		return "", "", err
+	}
+	// The version is part of the key, so a new prompt doesn't serve answers
+	// to the old one
+	sum := sha256.Sum256([]byte(prompt.Version + "\n" + prompt.Text))
+	cacheKey := "ai_feedback:" + hex.EncodeToString(sum[:])
+
+	var cached cachedFeedback
+	err = ai.service.redis.Get(ctx, cacheKey, &cached)
+	if err == nil {
+		return cached.Text, cached.PromptVersion, onChunk(cached.Text)
+	}
+	if !errors.Is(err, redis.Nil) {
+		log.Println("Error reading cached feedback: ", err)
 	}
 
-	return result.Text()
+	call := aiCall{feature: AI_FEATURE_FEEDBACK, userID: userID, problemID: problemID, promptVersion: prompt.Version}
+	feedback, err = ai.generateStream(ctx, call, LLMRequest{Prompt: prompt.Text, Temperature: 0}, onChunk)
+	if err != nil {
+		return "", "", err
+	}
+	cached = cachedFeedback{Text: feedback, PromptVersion: prompt.Version}
+	if err := ai.service.redis.Set(ctx, cacheKey, cached, feedbackCacheTTL); err != nil {
+		log.Println("Error caching feedback: ", err)
+	}
+	return feedback, prompt.Version, nil
 }
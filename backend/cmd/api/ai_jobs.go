@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	aiJobPollInterval = time.Second
+	// A claimed job is handed to another worker once its lease runs out,
+	// so the lease must outlast aiJobTimeout.
+	aiJobLease      = 2 * time.Minute
+	aiJobTimeout    = 90 * time.Second
+	aiJobBaseDelay  = 5 * time.Second
+	aiJobMaxBackoff = 10 * time.Minute
+)
+
+var (
+	ErrAIJobNotFound   = errors.New("AI job not found")
+	ErrProblemNotFound = errors.New("problem not found")
+)
+
+// EnqueueAIJob queues AI work for the job workers. userID is 0 for jobs the
+// system starts, such as explanations on approval. A user who is out of AI
+// quota gets an *AIQuotaError right away.
+func (s *serviceImpl) EnqueueAIJob(ctx context.Context, kind AIJobKind, userID, problemID int, input AIJobInput) (int, error) {
+	if userID != 0 {
+		if err := s.CheckAIQuota(ctx, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var jobID int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO ai_jobs (kind, user_id, problem_id, input)
+		VALUES ($1, NULLIF($2, 0), $3, $4) RETURNING id`,
+		kind, userID, problemID, data,
+	).Scan(&jobID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return 0, ErrProblemNotFound
+		}
+		return 0, fmt.Errorf("failed to queue AI job: %w", err)
+	}
+	return jobID, nil
+}
+
+const aiJobColumns = `id, kind, user_id, problem_id, input, status, attempts, max_attempts,
+	run_at, result, error, prompt_version, created_at, updated_at`
+
+func scanAIJob(row *sql.Row) (*AIJob, int, error) {
+	var job AIJob
+	var input []byte
+	var maxAttempts int
+	err := row.Scan(&job.ID, &job.Kind, &job.UserID, &job.ProblemID, &input, &job.Status, &job.Attempts,
+		&maxAttempts, &job.RunAt, &job.Result, &job.Error, &job.PromptVersion, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := json.Unmarshal(input, &job.Input); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode input of AI job %d: %w", job.ID, err)
+	}
+	return &job, maxAttempts, nil
+}
+
+func (s *serviceImpl) GetAIJob(ctx context.Context, jobID int) (*AIJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	job, _, err := scanAIJob(s.db.QueryRowContext(ctx, `SELECT `+aiJobColumns+` FROM ai_jobs WHERE id = $1`, jobID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAIJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get AI job: %w", err)
+	}
+	return job, nil
+}
+
+// claimAIJob leases the next due job, including running jobs whose worker
+// stopped before finishing them. It returns nil when nothing is due.
+func (s *serviceImpl) claimAIJob(ctx context.Context) (*AIJob, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	job, maxAttempts, err := scanAIJob(s.db.QueryRowContext(ctx, `
+		UPDATE ai_jobs
+		SET status = $1, attempts = attempts + 1,
+		    locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2), updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM ai_jobs
+			WHERE (status = $3 AND run_at <= CURRENT_TIMESTAMP)
+			   OR (status = $1 AND locked_until < CURRENT_TIMESTAMP)
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING `+aiJobColumns,
+		AI_JOB_STATUS_RUNNING, aiJobLease.Seconds(), AI_JOB_STATUS_QUEUED,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to claim AI job: %w", err)
+	}
+	return job, maxAttempts, nil
+}
+
+func (s *serviceImpl) completeAIJob(ctx context.Context, jobID int, result, promptVersion string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE ai_jobs
+		SET status = $2, result = $3, prompt_version = $4, error = NULL, locked_until = NULL,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, jobID, AI_JOB_STATUS_COMPLETED, result, promptVersion)
+	return err
+}
+
+// failAIJob puts the job back in the queue after a backoff, or marks it
+// failed when it can't be retried.
+func (s *serviceImpl) failAIJob(ctx context.Context, jobID int, cause error, retryAfter time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	status := AI_JOB_STATUS_FAILED
+	if retryAfter > 0 {
+		status = AI_JOB_STATUS_QUEUED
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE ai_jobs
+		SET status = $2, error = $3, run_at = CURRENT_TIMESTAMP + make_interval(secs => $4),
+		    locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, jobID, status, cause.Error(), retryAfter.Seconds())
+	return err
+}
+
+// aiJobBackoff is the delay before retry number attempt+1: 5s, 10s, 20s and
+// so on, capped at aiJobMaxBackoff.
+func aiJobBackoff(attempt int) time.Duration {
+	delay := aiJobBaseDelay
+	for i := 1; i < attempt && delay < aiJobMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, aiJobMaxBackoff)
+}
+
+// retryable reports whether an error may go away on its own, like the
+// provider being down or slow.
+func retryable(err error) bool {
+	if errors.Is(err, errAIDisabled) {
+		return false
+	}
+	return errors.Is(err, ErrLLMUnavailable) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// StartJobWorkers starts n workers that run queued AI jobs until ctx is
+// canceled.
+func (ai *AI) StartJobWorkers(ctx context.Context, n int, wg *sync.WaitGroup) {
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, maxAttempts, err := ai.service.claimAIJob(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Println("Error claiming AI job: ", err)
+				}
+				if job == nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(aiJobPollInterval):
+					}
+					continue
+				}
+				ai.runJob(ctx, job, maxAttempts)
+			}
+		}()
+	}
+}
+
+func (ai *AI) runJob(ctx context.Context, job *AIJob, maxAttempts int) {
+	var result, promptVersion string
+	var err error
+	if job.Attempts > maxAttempts {
+		// Only reached by a job whose worker died on the last attempt
+		err = errors.New("the job was interrupted too many times")
+	} else {
+		jobCtx, cancel := context.WithTimeout(ctx, aiJobTimeout)
+		switch job.Kind {
+		case AI_JOB_EXPLANATION:
+			result, promptVersion, err = ai.AddProblemExplanation(jobCtx, job.ProblemID)
+		case AI_JOB_FEEDBACK:
+			userID := 0
+			if job.UserID != nil {
+				userID = *job.UserID
+			}
+			result, promptVersion, err = ai.GetFeedback(jobCtx, userID, job.ProblemID, job.Input.Code)
+		case AI_JOB_TEST_CASES:
+			result, promptVersion, err = ai.ProposeTestCases(jobCtx, job)
+		default:
+			err = fmt.Errorf("unknown AI job kind %q", job.Kind)
+		}
+		cancel()
+	}
+
+	// The server is shutting down, the job is picked up again once its
+	// lease runs out
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		err = ai.service.completeAIJob(ctx, job.ID, result, promptVersion)
+	} else {
+		var retryAfter time.Duration
+		if retryable(err) && job.Attempts < maxAttempts {
+			retryAfter = aiJobBackoff(job.Attempts)
+		}
+		log.Printf("AI job %d (%s) attempt %d failed: %v", job.ID, job.Kind, job.Attempts, err)
+		err = ai.service.failAIJob(ctx, job.ID, err, retryAfter)
+	}
+	if err != nil {
+		log.Printf("Error updating AI job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Every call to the AI provider is recorded with the tokens it used. Calls
+// made for a user count against the quota of their roles (ai_quotas), per
+// UTC day and month. Answers served from a cache or stored earlier, like a
+// hint someone else revealed first, cost nothing and don't count.
+//
+// A call is recorded before it's made, in the same transaction as the quota
+// check, so concurrent calls can't all pass the check. The row gets the
+// tokens once the provider answers and is dropped if the call fails.
+
+var ErrAIQuotaExceeded = errors.New("AI quota exceeded")
+
+// AIQuotaError tells the user which limit they hit and when it resets.
+type AIQuotaError struct {
+	Period  string // "day" or "month"
+	Limit   int
+	ResetAt time.Time
+}
+
+func (e *AIQuotaError) Error() string {
+	return fmt.Sprintf("%s: %d AI requests per %s, resets at %s",
+		ErrAIQuotaExceeded, e.Limit, e.Period, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *AIQuotaError) Unwrap() error { return ErrAIQuotaExceeded }
+
+// aiQuotaWindows returns the start of the current UTC day and month and the
+// start of the next ones, when their counts reset.
+func aiQuotaWindows(now time.Time) (dayStart, dayEnd, monthStart, monthEnd time.Time) {
+	now = now.UTC()
+	dayStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return dayStart, dayStart.AddDate(0, 0, 1), monthStart, monthStart.AddDate(0, 1, 0)
+}
+
+// userAIQuota resolves the limits of the user's role and global grants,
+// the most generous of each. nil means no limit.
+func userAIQuota(ctx context.Context, db queryer, userID int) (daily, monthly *int, err error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT q.daily_limit, q.monthly_limit
+		FROM (
+			SELECT role FROM users WHERE id = $1
+			UNION
+			SELECT role FROM role_grants WHERE user_id = $1 AND resource_id IS NULL
+		) r
+		LEFT JOIN ai_quotas q ON q.role = r.role`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get AI quota: %w", err)
+	}
+	defer rows.Close()
+
+	// A role without a row has no limits, like one with NULL limits
+	limited := false
+	dailyLimited, monthlyLimited := true, true
+	var maxDaily, maxMonthly int
+	for rows.Next() {
+		var d, m *int
+		if err := rows.Scan(&d, &m); err != nil {
+			return nil, nil, err
+		}
+		limited = true
+		if d == nil {
+			dailyLimited = false
+		} else {
+			maxDaily = max(maxDaily, *d)
+		}
+		if m == nil {
+			monthlyLimited = false
+		} else {
+			maxMonthly = max(maxMonthly, *m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if limited && dailyLimited {
+		daily = &maxDaily
+	}
+	if limited && monthlyLimited {
+		monthly = &maxMonthly
+	}
+	return daily, monthly, nil
+}
+
+// GetAIUsageStatus reports what the user has used of their quota.
+func (s *serviceImpl) GetAIUsageStatus(ctx context.Context, userID int) (*AIUsageStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+	return aiUsageStatus(ctx, s.db, userID)
+}
+
+func aiUsageStatus(ctx context.Context, db queryer, userID int) (*AIUsageStatus, error) {
+	daily, monthly, err := userAIQuota(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dayStart, dayEnd, monthStart, monthEnd := aiQuotaWindows(time.Now())
+	status := &AIUsageStatus{
+		Daily:   AIQuotaUsage{Limit: daily, ResetAt: dayEnd},
+		Monthly: AIQuotaUsage{Limit: monthly, ResetAt: monthEnd},
+	}
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE created_at >= $2), COUNT(*),
+		       COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0)
+		FROM ai_usage
+		WHERE user_id = $1 AND created_at >= $3`, userID, dayStart, monthStart,
+	).Scan(&status.Daily.Used, &status.Monthly.Used, &status.InputTokens, &status.OutputTokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI usage: %w", err)
+	}
+	return status, nil
+}
+
+// CheckAIQuota returns an *AIQuotaError when the user has no AI calls left.
+// It's only a hint, the call itself reserves its share, see reserveAIUsage.
+func (s *serviceImpl) CheckAIQuota(ctx context.Context, userID int) error {
+	status, err := s.GetAIUsageStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return quotaError(status)
+}
+
+// quotaError is an *AIQuotaError if the usage reached a limit.
+func quotaError(status *AIUsageStatus) error {
+	// The monthly limit is reported first, waiting for the next day
+	// wouldn't help
+	if limit := status.Monthly.Limit; limit != nil && status.Monthly.Used >= *limit {
+		return &AIQuotaError{Period: "month", Limit: *limit, ResetAt: status.Monthly.ResetAt}
+	}
+	if limit := status.Daily.Limit; limit != nil && status.Daily.Used >= *limit {
+		return &AIQuotaError{Period: "day", Limit: *limit, ResetAt: status.Daily.ResetAt}
+	}
+	return nil
+}
+
+// aiCall is what a provider call is for, to check and record it. userID is
+// 0 for calls the system makes on its own.
+type aiCall struct {
+	feature       AIFeature
+	userID        int
+	problemID     int
+	promptVersion string
+}
+
+// reserveAIUsage records a call about to be made and returns its row, or
+// an *AIQuotaError when the user has no calls left. The user's reservations
+// wait for each other, so each one sees those before it.
+func (s *serviceImpl) reserveAIUsage(ctx context.Context, call aiCall) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if call.userID != 0 {
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, call.userID); err != nil {
+			return 0, fmt.Errorf("failed to lock user: %w", err)
+		}
+		status, err := aiUsageStatus(ctx, tx, call.userID)
+		if err != nil {
+			return 0, err
+		}
+		if err := quotaError(status); err != nil {
+			return 0, err
+		}
+	}
+
+	// The model is filled in with the tokens
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO ai_usage (user_id, problem_id, feature, model, prompt_version)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, '', NULLIF($4, ''))
+		RETURNING id`, call.userID, call.problemID, call.feature, call.promptVersion,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve AI usage: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
+
+func (s *serviceImpl) recordAIUsage(ctx context.Context, id int64, usage LLMUsage) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE ai_usage SET model = $2, input_tokens = $3, output_tokens = $4
+		WHERE id = $1`, id, usage.Model, usage.InputTokens, usage.OutputTokens)
+	return err
+}
+
+// releaseAIUsage drops the reservation of a call that failed.
+func (s *serviceImpl) releaseAIUsage(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM ai_usage WHERE id = $1`, id)
+	return err
+}
+
+// generate calls the provider once the user's quota allows it and records
+// the usage.
+func (ai *AI) generate(ctx context.Context, call aiCall, req LLMRequest) (string, error) {
+	return ai.generateStream(ctx, call, req, nil)
+}
+
+// generateStream is generate for streamed answers, onChunk may be nil.
+func (ai *AI) generateStream(ctx context.Context, call aiCall, req LLMRequest, onChunk func(string) error) (string, error) {
+	usageID, err := ai.service.reserveAIUsage(ctx, call)
+	if err != nil {
+		return "", err
+	}
+
+	var resp LLMResponse
+	produced := false
+	if onChunk == nil {
+		resp, err = ai.llm.Generate(ctx, req)
+	} else {
+		resp, err = generateStream(ctx, ai.llm, req, func(chunk string) error {
+			produced = true
+			return onChunk(chunk)
+		})
+	}
+	// The client may have gone, the reservation is settled either way. A
+	// call that failed before any output is free, one the user read part of
+	// is paid for, even if they left before the end.
+	if err != nil && !produced {
+		if err := ai.service.releaseAIUsage(context.WithoutCancel(ctx), usageID); err != nil {
+			log.Println("Error releasing AI usage: ", err)
+		}
+		return "", err
+	}
+	if err != nil {
+		resp.Usage = partialUsage(req, resp)
+	}
+	if err := ai.service.recordAIUsage(context.WithoutCancel(ctx), usageID, resp.Usage); err != nil {
+		log.Println("Error recording AI usage: ", err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// partialUsage is the usage of a stream cut short. Providers that report
+// it only at the end leave it to an estimate, about four characters a token.
+func partialUsage(req LLMRequest, resp LLMResponse) LLMUsage {
+	usage := resp.Usage
+	if usage.InputTokens == 0 {
+		usage.InputTokens = (len(req.Prompt) + 3) / 4
+	}
+	if usage.OutputTokens == 0 {
+		usage.OutputTokens = (len(resp.Text) + 3) / 4
+	}
+	return usage
+}
+
+func (s *serviceImpl) GetAIQuotas(ctx context.Context) ([]AIQuota, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT role, daily_limit, monthly_limit FROM ai_quotas ORDER BY role`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI quotas: %w", err)
+	}
+	defer rows.Close()
+
+	quotas := []AIQuota{}
+	for rows.Next() {
+		var q AIQuota
+		if err := rows.Scan(&q.Role, &q.DailyLimit, &q.MonthlyLimit); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, rows.Err()
+}
+
+// SetAIQuota sets the limits of a role, nil for no limit.
+func (s *serviceImpl) SetAIQuota(ctx context.Context, quota AIQuota) error {
+	if _, ok := rolePermissions[quota.Role]; !ok {
+		return fmt.Errorf("unknown role %q", quota.Role)
+	}
+	if (quota.DailyLimit != nil && *quota.DailyLimit < 0) || (quota.MonthlyLimit != nil && *quota.MonthlyLimit < 0) {
+		return errors.New("AI quota limits can't be negative")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ai_quotas (role, daily_limit, monthly_limit)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (role) DO UPDATE
+		SET daily_limit = EXCLUDED.daily_limit, monthly_limit = EXCLUDED.monthly_limit,
+		    updated_at = CURRENT_TIMESTAMP`, quota.Role, quota.DailyLimit, quota.MonthlyLimit)
+	if err != nil {
+		return fmt.Errorf("failed to set AI quota: %w", err)
+	}
+	return nil
+}
+
+// GetAIUsageReport sums the AI calls made in [from, to), in total, by
+// feature and by user.
+func (s *serviceImpl) GetAIUsageReport(ctx context.Context, from, to time.Time) (*AIUsageReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	report := &AIUsageReport{From: from, To: to, ByFeature: []AIUsageTotals{}, ByUser: []AIUsageTotals{}}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.feature, u.user_id, COALESCE(us.username, ''),
+		       COUNT(*), SUM(u.input_tokens), SUM(u.output_tokens)
+		FROM ai_usage u
+		LEFT JOIN users us ON us.id = u.user_id
+		WHERE u.created_at >= $1 AND u.created_at < $2
+		GROUP BY u.feature, u.user_id, us.username`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI usage: %w", err)
+	}
+	defer rows.Close()
+
+	byFeature := map[AIFeature]*AIUsageTotals{}
+	byUser := map[int]*AIUsageTotals{}
+	for rows.Next() {
+		var row AIUsageTotals
+		if err := rows.Scan(&row.Feature, &row.UserID, &row.Username, &row.Calls, &row.InputTokens, &row.OutputTokens); err != nil {
+			return nil, err
+		}
+		report.Total.add(row)
+
+		if byFeature[row.Feature] == nil {
+			byFeature[row.Feature] = &AIUsageTotals{Feature: row.Feature}
+		}
+		byFeature[row.Feature].add(row)
+
+		// Calls the system made on its own only show in the totals
+		if row.UserID == nil {
+			continue
+		}
+		if byUser[*row.UserID] == nil {
+			byUser[*row.UserID] = &AIUsageTotals{UserID: row.UserID, Username: row.Username}
+		}
+		byUser[*row.UserID].add(row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, totals := range byFeature {
+		report.ByFeature = append(report.ByFeature, *totals)
+	}
+	for _, totals := range byUser {
+		report.ByUser = append(report.ByUser, *totals)
+	}
+	slices.SortFunc(report.ByFeature, func(a, b AIUsageTotals) int { return strings.Compare(string(a.Feature), string(b.Feature)) })
+	// Heaviest users first
+	slices.SortFunc(report.ByUser, func(a, b AIUsageTotals) int {
+		return (b.InputTokens + b.OutputTokens) - (a.InputTokens + a.OutputTokens)
+	})
+	return report, nil
+}
+
+func (t *AIUsageTotals) add(row AIUsageTotals) {
+	t.Calls += row.Calls
+	t.InputTokens += row.InputTokens
+	t.OutputTokens += row.OutputTokens
+}
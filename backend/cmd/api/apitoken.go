@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Personal API tokens let the CLI and editor plugins act as the user without
+// a browser session. A token carries the user's permissions, narrowed by its
+// scopes, and is revoked by deleting it. Account security (sessions, 2FA and
+// the tokens themselves) stays behind a real login.
+
+const (
+	apiTokenPrefix      = "oj_"
+	maxAPITokens        = 20
+	apiTokenUsageWindow = time.Minute // last_used_at is only written this often
+)
+
+var ErrInvalidAPIToken = errors.New("invalid or expired API token")
+
+func validScope(scope TokenScope) bool {
+	switch scope {
+	case SCOPE_READ, SCOPE_SUBMIT, SCOPE_WRITE:
+		return true
+	}
+	return false
+}
+
+func fromTokenScopes(scopes []TokenScope) []string {
+	values := make([]string, len(scopes))
+	for i, s := range scopes {
+		values[i] = string(s)
+	}
+	return values
+}
+
+// requiredScopes lists the scopes that each allow the request. Write allows
+// everything.
+func requiredScopes(r *http.Request) []TokenScope {
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && (path == "/run" || path == "/submit"):
+		return []TokenScope{SCOPE_SUBMIT, SCOPE_WRITE}
+	case r.Method == http.MethodGet && (strings.HasPrefix(path, "/run/") || strings.HasPrefix(path, "/submission/")):
+		return []TokenScope{SCOPE_READ, SCOPE_SUBMIT, SCOPE_WRITE}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return []TokenScope{SCOPE_READ, SCOPE_WRITE}
+	default:
+		return []TokenScope{SCOPE_WRITE}
+	}
+}
+
+// CreateAPIToken stores a new token and returns it in plain text, which is
+// the only time it is shown.
+func (s *serviceImpl) CreateAPIToken(ctx context.Context, userID int, name string, scopes []TokenScope, expiresAt *time.Time) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, "", errors.New("token name must be 1 to 100 characters")
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("token needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := apiTokenPrefix + secret
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var count int
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to count API tokens: %w", err)
+	}
+	if count >= maxAPITokens {
+		return nil, "", fmt.Errorf("at most %d API tokens are allowed, revoke one first", maxAPITokens)
+	}
+
+	t := &APIToken{UserID: userID, Name: name, Scopes: scopes, ExpiresAt: expiresAt}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		userID, name, hashToken(token), pq.Array(fromTokenScopes(scopes)), expiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API token: %w", err)
+	}
+	return t, token, nil
+}
+
+func (s *serviceImpl) GetAPITokens(ctx context.Context, userID int) ([]APIToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, scopes, created_at, last_used_at, expires_at
+		FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes []string
+		if err := rows.Scan(&t.ID, &t.Name, pq.Array(&scopes), &t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		for _, scope := range scopes {
+			t.Scopes = append(t.Scopes, TokenScope(scope))
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *serviceImpl) RevokeAPIToken(ctx context.Context, userID, tokenID int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("API token not found")
+	}
+	return nil
+}
+
+// AuthenticateAPIToken returns the live token and records its use.
+func (s *serviceImpl) AuthenticateAPIToken(ctx context.Context, token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var t APIToken
+	var scopes []string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, u.role, t.name, t.scopes, t.created_at, t.last_used_at, t.expires_at
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL
+		  AND (t.expires_at IS NULL OR t.expires_at > CURRENT_TIMESTAMP)`, hashToken(token),
+	).Scan(&t.ID, &t.UserID, &t.Role, &t.Name, pq.Array(&scopes), &t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	for _, scope := range scopes {
+		t.Scopes = append(t.Scopes, TokenScope(scope))
+	}
+
+	// Tokens are used in bursts, so a write per request would be wasted
+	if t.LastUsedAt == nil || time.Since(*t.LastUsedAt) > apiTokenUsageWindow {
+		if _, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`, t.ID); err != nil {
+			return nil, fmt.Errorf("failed to record API token use: %w", err)
+		}
+	}
+	return &t, nil
+}
+
+func apiTokenFromContext(ctx context.Context) *APIToken {
+	token, _ := ctx.Value(ContextAPITokenKey).(*APIToken)
+	return token
+}
+
+// APITokenScopeMiddleware rejects API token requests outside the token's
+// scopes. Session requests pass through.
+func APITokenScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := apiTokenFromContext(r.Context())
+		if token == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		required := requiredScopes(r)
+		for _, scope := range token.Scopes {
+			if slices.Contains(required, scope) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, fmt.Sprintf("forbidden: API token needs the %s scope", required[0]), http.StatusForbidden)
+	})
+}
+
+// SessionOnly keeps API tokens away from routes that need a real login.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiTokenFromContext(r.Context()) != nil {
+			http.Error(w, "forbidden: log in to do this", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
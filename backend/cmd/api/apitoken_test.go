@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestRequiredScopes(t *testing.T) {
+	readable := []TokenScope{SCOPE_READ, SCOPE_WRITE}
+	submit := []TokenScope{SCOPE_SUBMIT, SCOPE_WRITE}
+	verdicts := []TokenScope{SCOPE_READ, SCOPE_SUBMIT, SCOPE_WRITE}
+	write := []TokenScope{SCOPE_WRITE}
+
+	tests := []struct {
+		method string
+		path   string
+		want   []TokenScope
+	}{
+		{http.MethodGet, "/problems", readable},
+		{http.MethodHead, "/problems", readable},
+		{http.MethodGet, "/contests/1/leaderboard", readable},
+		{http.MethodPost, "/run", submit},
+		{http.MethodPost, "/submit", submit},
+		{http.MethodGet, "/run/3", verdicts},
+		{http.MethodGet, "/submission/3", verdicts},
+		{http.MethodPost, "/run/3", write},
+		{http.MethodPost, "/submission/3/rejudge", write},
+		{http.MethodPost, "/submit/extra", write},
+		{http.MethodPost, "/contests/1/join", write},
+		{http.MethodPut, "/problems/1", write},
+		{http.MethodDelete, "/discussions/1", write},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredScopes(r); !slices.Equal(got, tt.want) {
+			t.Errorf("requiredScopes(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAPITokenScopeMiddleware(t *testing.T) {
+	handler := APITokenScopeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		token  *APIToken
+		method string
+		path   string
+		want   int
+	}{
+		{"session", nil, http.MethodPost, "/problems", http.StatusOK},
+		{"read token reads", &APIToken{Scopes: []TokenScope{SCOPE_READ}}, http.MethodGet, "/problems", http.StatusOK},
+		{"read token submits", &APIToken{Scopes: []TokenScope{SCOPE_READ}}, http.MethodPost, "/submit", http.StatusForbidden},
+		{"submit token submits", &APIToken{Scopes: []TokenScope{SCOPE_SUBMIT}}, http.MethodPost, "/submit", http.StatusOK},
+		{"submit token polls", &APIToken{Scopes: []TokenScope{SCOPE_SUBMIT}}, http.MethodGet, "/submission/1", http.StatusOK},
+		{"submit token reads", &APIToken{Scopes: []TokenScope{SCOPE_SUBMIT}}, http.MethodGet, "/problems", http.StatusForbidden},
+		{"submit token writes", &APIToken{Scopes: []TokenScope{SCOPE_SUBMIT}}, http.MethodPut, "/problems/1", http.StatusForbidden},
+		{"write token writes", &APIToken{Scopes: []TokenScope{SCOPE_WRITE}}, http.MethodPut, "/problems/1", http.StatusOK},
+		{"no scopes", &APIToken{}, http.MethodGet, "/problems", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ContextAPITokenKey, tt.token))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BlobStore keeps test data outside the database, addressed by the hex
+// SHA-256 of its content. Blobs are immutable, so a hash stays valid for as
+// long as the blob exists and workers can cache by hash forever.
+type BlobStore interface {
+	Put(ctx context.Context, data []byte) (string, error)
+	Get(ctx context.Context, hash string) ([]byte, error)
+}
+
+func NewBlobStore(cfg *Config) (BlobStore, error) {
+	switch cfg.BLOB_STORE {
+	case "", "fs":
+		return NewFileBlobStore(cfg.BLOB_DIR)
+	case "s3":
+		return NewS3BlobStore(cfg.S3_ENDPOINT, cfg.S3_BUCKET, cfg.S3_REGION, cfg.S3_ACCESS_KEY, cfg.S3_SECRET_KEY)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", cfg.BLOB_STORE)
+	}
+}
+
+func blobHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// FileBlobStore stores blobs under dir/<first two hex chars>/<hash>.
+type FileBlobStore struct {
+	dir string
+}
+
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob dir: %w", err)
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (f *FileBlobStore) path(hash string) string {
+	return filepath.Join(f.dir, hash[:2], hash)
+}
+
+func (f *FileBlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	hash := blobHash(data)
+	path := f.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob dir: %w", err)
+	}
+
+	// Write to a temp file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	return hash, nil
+}
+
+func (f *FileBlobStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	if !validBlobHash(hash) {
+		return nil, fmt.Errorf("invalid blob hash %q", hash)
+	}
+	data, err := os.ReadFile(f.path(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", hash, err)
+	}
+	return data, nil
+}
+
+// S3BlobStore talks to any S3-compatible service (AWS, MinIO, ...) using
+// path-style URLs and SigV4 request signing.
+type S3BlobStore struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func NewS3BlobStore(endpoint, bucket, region, accessKey, secretKey string) (*S3BlobStore, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("missing S3_BUCKET")
+	}
+	return &S3BlobStore{
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	hash := blobHash(data)
+
+	// Skip the upload when the blob is already there
+	res, err := s.do(ctx, http.MethodHead, hash, nil)
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			return hash, nil
+		}
+	}
+
+	res, err = s.do(ctx, http.MethodPut, hash, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload blob: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", fmt.Errorf("failed to upload blob: %s: %s", res.Status, body)
+	}
+	return hash, nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	if !validBlobHash(hash) {
+		return nil, fmt.Errorf("invalid blob hash %q", hash)
+	}
+	res, err := s.do(ctx, http.MethodGet, hash, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blob %s: %w", hash, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch blob %s: %s", hash, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+func (s *S3BlobStore) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (s *S3BlobStore) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := blobHash(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + blobHash([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
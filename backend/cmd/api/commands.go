@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	migrate "oj-be/migrations"
+)
+
+// Without arguments the binary serves the API. These subcommands manage the
+// database instead; they only need DB_URI.
+const commandUsage = `usage: app [command]
+
+commands:
+  migrate up       apply pending migrations
+  migrate down     revert the latest migration
+  migrate status   list migrations and whether they are applied
+  seed             load development data (only when ENVIRONMENT=DEV)`
+
+func runCommand(ctx context.Context, args []string) error {
+	dbURI, err := getEnv("DB_URI", true)
+	if err != nil {
+		return err
+	}
+
+	var cmd func(ctx context.Context, db *PostgreSQLDB) error
+	switch {
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "up":
+		cmd = migrateUp
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "down":
+		cmd = migrateDown
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "status":
+		cmd = migrateStatus
+	case len(args) == 1 && args[0] == "seed":
+		// Anything but DEV, including a misspelled PROD, may be a real database
+		if env := getEnvOrDefault("ENVIRONMENT", "DEV"); env != "DEV" {
+			return fmt.Errorf("seed loads development data and only runs when ENVIRONMENT=DEV, not %s", env)
+		}
+		cmd = seed
+	default:
+		return errors.New(commandUsage)
+	}
+
+	postgres, err := NewPostgreSQLDB(dbURI, 1, 1)
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer postgres.Close()
+	return cmd(ctx, postgres)
+}
+
+// migrateUp applies pending migrations, logging each one.
+func migrateUp(ctx context.Context, db *PostgreSQLDB) error {
+	applied, err := migrate.Up(ctx, db.conn)
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		log.Println("Database schema is up to date")
+	}
+	return nil
+}
+
+func migrateDown(ctx context.Context, db *PostgreSQLDB) error {
+	reverted, err := migrate.Down(ctx, db.conn)
+	if err != nil {
+		return err
+	}
+	if reverted == nil {
+		log.Println("No migrations to revert")
+		return nil
+	}
+	log.Printf("Reverted migration %04d_%s", reverted.Version, reverted.Name)
+	return nil
+}
+
+func migrateStatus(ctx context.Context, db *PostgreSQLDB) error {
+	statuses, err := migrate.GetStatus(ctx, db.conn)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case st.Missing:
+			applied += " (file missing)"
+		case st.Modified:
+			applied += " (file changed since)"
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+	return tw.Flush()
+}
+
+func seed(ctx context.Context, db *PostgreSQLDB) error {
+	if err := migrate.Seed(ctx, db.conn); err != nil {
+		return err
+	}
+	log.Println("Loaded the development data")
+	return nil
+}
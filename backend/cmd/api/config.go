@@ -4,18 +4,42 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	SERVER_PORT          int
-	REDIS_URI            string
-	DB_URI               string
-	AI_API_KEY           string
-	AI_MODEL_NAME        string
-	FEEDBACK_TEMPLATE    string
-	EXPLANATION_TEMPLATE string
+	SERVER_PORT       int
+	REDIS_URI         string
+	DB_URI            string
+	AI_PROVIDER       string // gemini, openai or stub
+	AI_API_KEY        string
+	AI_BASE_URL       string // OpenAI-compatible endpoint, e.g. a local Ollama
+	AI_MODEL_NAME     string
+	AI_WORKERS        int    // concurrent AI jobs
+	PROMPTS_DIR       string // prompt templates, the built-in ones if empty
+	BLOB_STORE        string
+	BLOB_DIR          string
+	S3_ENDPOINT       string
+	S3_BUCKET         string
+	S3_REGION         string
+	S3_ACCESS_KEY     string
+	S3_SECRET_KEY     string
+	JWT_KEYS          map[string][]byte // signing keys by kid
+	JWT_KEY_ID        string            // kid new tokens are signed with
+	ACCESS_TOKEN_TTL  time.Duration
+	REFRESH_TOKEN_TTL time.Duration
+	APP_URL           string // frontend base URL, for links in emails
+	MAILER            string
+	MAIL_FROM         string
+	MAIL_DIR          string
+	SMTP_ADDR         string
+	SMTP_USERNAME     string
+	SMTP_PASSWORD     string
+	ENVIRONMENT       string // DEV or PROD
+	MIGRATE_ON_START  bool   // apply pending migrations before serving
 }
 
 func LoadDotEnv() error {
@@ -54,26 +78,123 @@ func GetConfig() (*Config, error) {
 		return nil, err
 	}
 
-	apiKey, err := getEnv("AI_API_KEY", true)
+	// Optional with defaults
+	redisURI := getEnvOrDefault("REDIS_URI", "")
+
+	// AI: "gemini" needs AI_API_KEY, "openai" talks to any OpenAI-compatible
+	// server at AI_BASE_URL (Ollama by default), "stub" works offline and
+	// "disabled", the default without a key, turns the AI features off
+	apiKey := getEnvOrDefault("AI_API_KEY", "")
+	defaultProvider := "disabled"
+	if apiKey != "" {
+		defaultProvider = "gemini"
+	}
+	aiProvider := getEnvOrDefault("AI_PROVIDER", defaultProvider)
+	aiBaseURL := getEnvOrDefault("AI_BASE_URL", "http://localhost:11434/v1")
+	defaultModel := map[string]string{"gemini": "gemini-2.0-flash", "openai": "llama3.2"}[aiProvider]
+	modelName := getEnvOrDefault("AI_MODEL_NAME", defaultModel)
+	aiWorkers, err := strconv.Atoi(getEnvOrDefault("AI_WORKERS", "2"))
+	if err != nil || aiWorkers < 1 {
+		return nil, fmt.Errorf("invalid AI_WORKERS: %q", getEnvOrDefault("AI_WORKERS", "2"))
+	}
+	// Prompts are NAME.vN.tmpl files, see the prompts package
+	promptsDir := getEnvOrDefault("PROMPTS_DIR", "")
+
+	// Test data storage: "fs" (shared directory) or "s3" (S3-compatible service)
+	blobStore := getEnvOrDefault("BLOB_STORE", "fs")
+	blobDir := getEnvOrDefault("BLOB_DIR", "./data/blobs")
+	s3Endpoint := getEnvOrDefault("S3_ENDPOINT", "")
+	s3Bucket := getEnvOrDefault("S3_BUCKET", "")
+	s3Region := getEnvOrDefault("S3_REGION", "us-east-1")
+	s3AccessKey := getEnvOrDefault("S3_ACCESS_KEY", "")
+	s3SecretKey := getEnvOrDefault("S3_SECRET_KEY", "")
+
+	// JWT signing keys: JWT_SECRET alone, or "kid:secret,..." in JWT_KEYS to
+	// rotate. Tokens name their key in the kid header, so old keys can stay
+	// listed until the tokens signed with them have expired.
+	keyID := getEnvOrDefault("JWT_KEY_ID", "default")
+	jwtKeys, err := parseJWTKeys(getEnvOrDefault("JWT_KEYS", ""))
 	if err != nil {
 		return nil, err
 	}
+	if secret := getEnvOrDefault("JWT_SECRET", ""); secret != "" {
+		jwtKeys[keyID] = []byte(secret)
+	}
+	if _, ok := jwtKeys[keyID]; !ok {
+		return nil, fmt.Errorf("missing required environment variable: JWT_SECRET (or a %q key in JWT_KEYS)", keyID)
+	}
 
-	// Optional with defaults
-	redisURI := getEnvOrDefault("REDIS_URI", "")
-	modelName := getEnvOrDefault("AI_MODEL_NAME", "gemini-2.0-flash")
-	feedbackTemplate := getEnvOrDefault("FEEDBACK_TEMPLATE", "code:%s constraints:%s solution:%s")
-	explanationTemplate := getEnvOrDefault("EXPLANATION_TEMPLATE", "code:%s constraints:%s")
+	accessTTL, err := time.ParseDuration(getEnvOrDefault("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACCESS_TOKEN_TTL: %v", err)
+	}
+	refreshTTL, err := time.ParseDuration(getEnvOrDefault("REFRESH_TOKEN_TTL", "720h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REFRESH_TOKEN_TTL: %v", err)
+	}
+
+	// Mail: "smtp" for a real server, "file" to write .eml files to MAIL_DIR,
+	// or "log" to print messages, for development
+	appURL := strings.TrimRight(getEnvOrDefault("APP_URL", "http://localhost:5173"), "/")
+	mailer := getEnvOrDefault("MAILER", "log")
+	mailFrom := getEnvOrDefault("MAIL_FROM", "no-reply@localhost")
+	mailDir := getEnvOrDefault("MAIL_DIR", "./data/mail")
+	smtpAddr := getEnvOrDefault("SMTP_ADDR", "localhost:1025")
+	smtpUsername := getEnvOrDefault("SMTP_USERNAME", "")
+	smtpPassword := getEnvOrDefault("SMTP_PASSWORD", "")
+
+	migrateOnStart, err := strconv.ParseBool(getEnvOrDefault("MIGRATE_ON_START", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MIGRATE_ON_START: %v", err)
+	}
 
 	cfg := &Config{
-		SERVER_PORT:          port,
-		REDIS_URI:            redisURI,
-		DB_URI:               dbURI,
-		AI_API_KEY:           apiKey,
-		AI_MODEL_NAME:        modelName,
-		FEEDBACK_TEMPLATE:    feedbackTemplate,
-		EXPLANATION_TEMPLATE: explanationTemplate,
+		SERVER_PORT:       port,
+		REDIS_URI:         redisURI,
+		DB_URI:            dbURI,
+		AI_PROVIDER:       aiProvider,
+		AI_API_KEY:        apiKey,
+		AI_BASE_URL:       aiBaseURL,
+		AI_MODEL_NAME:     modelName,
+		AI_WORKERS:        aiWorkers,
+		PROMPTS_DIR:       promptsDir,
+		BLOB_STORE:        blobStore,
+		BLOB_DIR:          blobDir,
+		S3_ENDPOINT:       s3Endpoint,
+		S3_BUCKET:         s3Bucket,
+		S3_REGION:         s3Region,
+		S3_ACCESS_KEY:     s3AccessKey,
+		S3_SECRET_KEY:     s3SecretKey,
+		JWT_KEYS:          jwtKeys,
+		JWT_KEY_ID:        keyID,
+		ACCESS_TOKEN_TTL:  accessTTL,
+		REFRESH_TOKEN_TTL: refreshTTL,
+		APP_URL:           appURL,
+		MAILER:            mailer,
+		MAIL_FROM:         mailFrom,
+		MAIL_DIR:          mailDir,
+		SMTP_ADDR:         smtpAddr,
+		SMTP_USERNAME:     smtpUsername,
+		SMTP_PASSWORD:     smtpPassword,
+		ENVIRONMENT:       getEnvOrDefault("ENVIRONMENT", "DEV"),
+		MIGRATE_ON_START:  migrateOnStart,
 	}
 
 	return cfg, nil
 }
+
+func parseJWTKeys(s string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid:secret", entry)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
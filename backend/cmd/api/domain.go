@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"time"
 )
 
 type Service interface {
@@ -10,17 +11,80 @@ type Service interface {
 	GetUserProfile(ctx context.Context, username string) (*User, error)
 	GetUserByID(ctx context.Context, userID int) (*User, error)
 
+	CreateSession(ctx context.Context, userID int, userAgent, ip string) (string, string, error)
+	RefreshSession(ctx context.Context, refreshToken, userAgent, ip string) (int, string, string, string, error)
+	GetSessions(ctx context.Context, userID int, currentSessionID string) ([]Session, error)
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+	RevokeSessionByRefreshToken(ctx context.Context, refreshToken string) error
+	RevokeAllSessions(ctx context.Context, userID int) error
+	IsSessionRevoked(ctx context.Context, sessionID string) bool
+
+	CreateAPIToken(ctx context.Context, userID int, name string, scopes []TokenScope, expiresAt *time.Time) (*APIToken, string, error)
+	GetAPITokens(ctx context.Context, userID int) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, userID, tokenID int) error
+	AuthenticateAPIToken(ctx context.Context, token string) (*APIToken, error)
+
+	SendVerificationEmail(ctx context.Context, userID int) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+
+	TwoFactorEnabled(ctx context.Context, userID int) (bool, error)
+	BeginTwoFactorSetup(ctx context.Context, userID int) (string, string, error)
+	EnableTwoFactor(ctx context.Context, userID int, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID int, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error)
+	VerifySecondFactor(ctx context.Context, userID int, code string) error
+	CreateLoginChallenge(ctx context.Context, challenge LoginChallenge) (string, error)
+	GetLoginChallenge(ctx context.Context, token string) (*LoginChallenge, error)
+	CompleteLoginChallenge(ctx context.Context, token, code string) (*LoginChallenge, []string, error)
+
+	GetUserPermissions(ctx context.Context, userID int) (*Permissions, error)
+	GetUserRoles(ctx context.Context, userID int) (*UserRoles, error)
+	SetUserRole(ctx context.Context, userID int, role UserRole) error
+	AddRoleGrant(ctx context.Context, grant *RoleGrant) (int, error)
+	RemoveRoleGrant(ctx context.Context, userID, grantID int) error
+
 	GetProblems(ctx context.Context) ([]ProblemInfo, error)
 	AddProblem(ctx context.Context, problem *ProblemDetail) (int, error)
-	UpdateProblemByID(ctx context.Context, id int, problem *ProblemDetail) error
+	UpdateProblemByID(ctx context.Context, id, editorID int, problem *ProblemDetail) error
 	GetProblemBySlug(ctx context.Context, slug string) (*ProblemDetail, error)
 
+	GetProblemRevisions(ctx context.Context, problemID int) ([]ProblemRevision, error)
+	GetProblemRevision(ctx context.Context, problemID, revision int) (*ProblemRevision, error)
+	DiffProblemRevisions(ctx context.Context, problemID, fromRevision, toRevision int) (*ProblemRevisionDiff, error)
+	RollbackProblem(ctx context.Context, problemID, revision, editorID int) error
+	ImportProblemPackage(ctx context.Context, authorID int, data []byte) (int, error)
+	ExportProblemPackage(ctx context.Context, slug string) ([]byte, error)
+	UploadTestArchive(ctx context.Context, problemID, editorID int, data []byte, replace bool) (int, error)
+	StartTestGeneration(ctx context.Context, problemID, userID int, replace bool) (int, error)
+	HandleGenerationResult(ctx context.Context, er *ExecutionResponse) error
+	GetTestGenerationJob(ctx context.Context, jobID int) (*TestGenerationJob, error)
+	StartTestProposals(ctx context.Context, problemID, userID, count int) (int, error)
+	HandleProposalResult(ctx context.Context, er *ExecutionResponse) error
+	GetTestProposals(ctx context.Context, problemID int) ([]TestProposal, error)
+	AcceptTestProposals(ctx context.Context, problemID, editorID int, ids []int) (int, error)
+	DismissTestProposals(ctx context.Context, problemID int, ids []int) error
+	HandleValidationResult(ctx context.Context, er *ExecutionResponse) (int, ProblemStatus, error)
+
+	AdminGetProblems(ctx context.Context, userID int, perms *Permissions) ([]ProblemInfo, error)
+	GetProblemOwnership(ctx context.Context, problemID int) (*ProblemOwnership, error)
+	GetProblemOwnershipBySlug(ctx context.Context, slug string) (*ProblemOwnership, error)
+	SubmitProblemForReview(ctx context.Context, problemID, userID int, comment string) error
+	ReviewProblem(ctx context.Context, problemID, userID int, perms *Permissions, action ReviewAction, comment string) (ProblemStatus, error)
+	GetProblemReviews(ctx context.Context, problemID int) ([]ProblemReview, error)
+	TestProblem(ctx context.Context, userID, problemID int, language Language, code string) (int, error)
+
 	RunCode(context.Context, int, int, Language, string, []TestCase) (int, error)
-	GetRunResult(ctx context.Context, runID int) (Submission, error)
+	GetRunResult(ctx context.Context, userID, runID int) (Submission, error)
 	SubmitCode(ctx context.Context, userID, problemID int, language Language, code string) (int, error)
-	GetSubmissionResult(ctx context.Context, runID int) (Submission, error)
+	GetSubmissionResult(ctx context.Context, userID, runID int) (Submission, error)
 	GetUserSubmissions(ctx context.Context, userID, problemID int) ([]Submission, error)
 
+	Rejudge(ctx context.Context, filter RejudgeFilter, userID int) (*Rejudge, error)
+	GetRejudge(ctx context.Context, rejudgeID int) (*Rejudge, error)
+	GetSubmissionVerdicts(ctx context.Context, submissionID int) ([]VerdictChange, error)
+
 	CreateContest(ctx context.Context, contest *Contest) (int, error)
 	UpdateContest(ctx context.Context, id int, contest *Contest) error
 	GetAllContests(ctx context.Context) ([]Contest, error)
@@ -30,11 +94,34 @@ type Service interface {
 	EndContest(ctx context.Context, contestID int) error   // Remove contest from thhe cache
 	GetLeaderboard(ctx context.Context, contestID int) ([]ContestParticipant, error)
 
+	StartPlagiarismCheck(ctx context.Context, contestID, userID int) (int, error)
+	GetPlagiarismChecks(ctx context.Context, contestID int) ([]PlagiarismCheck, error)
+	GetPlagiarismCheck(ctx context.Context, contestID, checkID int) (*PlagiarismCheck, error)
+	ReviewPlagiarismPair(ctx context.Context, contestID, pairID, reviewerID int, review PlagiarismReview, note string) error
+	DisqualifyParticipant(ctx context.Context, contestID, userID, by int, reason string) error
+	ReinstateParticipant(ctx context.Context, contestID, userID int) error
+	GetDisqualifications(ctx context.Context, contestID int) ([]ContestDisqualification, error)
+
 	CreateDiscussion(ctx context.Context, discussion *Discussion) (int, error)
 	UpdateDiscussion(ctx context.Context, discussion *Discussion) error
 	GetDiscussionByID(ctx context.Context, discussionID int) (*Discussion, error)
 	AddVoteToDiscussion(ctx context.Context, userID, discussionID int, vote Vote) error
 	// AddVoteToComment(ctx context.Context, discussionID int, comment string) (int, error)
+
+	Search(ctx context.Context, query string, entityType SearchEntityType, limit int) ([]SearchResult, error)
+
+	EnqueueAIJob(ctx context.Context, kind AIJobKind, userID, problemID int, input AIJobInput) (int, error)
+	GetAIJob(ctx context.Context, jobID int) (*AIJob, error)
+
+	GetHintLadder(ctx context.Context, userID, problemID int) (*HintLadder, error)
+	GetProblemHints(ctx context.Context, problemID int) ([]ProblemHint, error)
+	SetProblemHints(ctx context.Context, problemID int, hints []ProblemHint) error
+
+	GetAIUsageStatus(ctx context.Context, userID int) (*AIUsageStatus, error)
+	CheckAIQuota(ctx context.Context, userID int) error
+	GetAIUsageReport(ctx context.Context, from, to time.Time) (*AIUsageReport, error)
+	GetAIQuotas(ctx context.Context) ([]AIQuota, error)
+	SetAIQuota(ctx context.Context, quota AIQuota) error
 }
 
 // type QueueService interface {
@@ -1,8 +1,24 @@
 package main
 
 const (
-	// ROLE_USER  UserRole = "user"
-	// ROLE_ADMIN UserRole = "admin"
+	ROLE_USER            UserRole = "user"
+	ROLE_ADMIN           UserRole = "admin"
+	ROLE_PROBLEM_SETTER  UserRole = "problem_setter"  // writes problems, sees only their own
+	ROLE_TESTER          UserRole = "tester"          // tries problems in review against the hidden tests
+	ROLE_REVIEWER        UserRole = "reviewer"        // approves problems or requests changes
+	ROLE_CONTEST_MANAGER UserRole = "contest_manager" // creates and runs contests
+	ROLE_MODERATOR       UserRole = "moderator"       // edits and hides any discussion
+
+	PERMISSION_PROBLEM_AUTHOR      Permission = "problem:author" // create problems, edit own
+	PERMISSION_PROBLEM_TEST        Permission = "problem:test"   // try problems in review
+	PERMISSION_PROBLEM_REVIEW      Permission = "problem:review" // approve problems, request changes
+	PERMISSION_PROBLEM_MANAGE      Permission = "problem:manage" // view and edit any problem
+	PERMISSION_CONTEST_MANAGE      Permission = "contest:manage"
+	PERMISSION_DISCUSSION_MODERATE Permission = "discussion:moderate"
+	PERMISSION_USER_MANAGE         Permission = "user:manage" // assign roles
+
+	RESOURCE_PROBLEM ResourceType = "problem"
+	RESOURCE_CONTEST ResourceType = "contest"
 
 	PROBLEM_STATUS_DRAFT     ProblemStatus = "draft"
 	PROBLEM_STATUS_VALIDATE  ProblemStatus = "validate"
@@ -10,6 +26,20 @@ const (
 	PROBLEM_STATUS_REJECTED  ProblemStatus = "rejected"
 	PROBLEM_STATUS_ARCHIEVED ProblemStatus = "archieved"
 
+	// Review workflow: validation passes -> validated -> submitted for review
+	// -> in_review -> approved (active) or changes_requested
+	PROBLEM_STATUS_VALIDATED         ProblemStatus = "validated"
+	PROBLEM_STATUS_IN_REVIEW         ProblemStatus = "in_review"
+	PROBLEM_STATUS_CHANGES_REQUESTED ProblemStatus = "changes_requested"
+
+	USER_TOKEN_VERIFY_EMAIL   UserTokenPurpose = "verify_email"
+	USER_TOKEN_RESET_PASSWORD UserTokenPurpose = "reset_password"
+
+	REVIEW_ACTION_SUBMITTED         ReviewAction = "submitted"
+	REVIEW_ACTION_COMMENT           ReviewAction = "comment"
+	REVIEW_ACTION_APPROVED          ReviewAction = "approved"
+	REVIEW_ACTION_CHANGES_REQUESTED ReviewAction = "changes_requested"
+
 	SUBMISSION_STATUS_PENDING           SubmissionStatus = "pending"
 	SUBMISSION_STATUS_ACCEPTED          SubmissionStatus = "accepted"
 	SUBMISSION_STATUS_WRONG_ANSWER      SubmissionStatus = "wrong answer"
@@ -38,7 +68,64 @@ const (
 	EXECUTION_CONTEST_SUBMIT ExecutionType = "contest"
 	EXECUTION_VALIDATE       ExecutionType = "validate"
 
+	// Test generation stages, see StartTestGeneration
+	EXECUTION_GENERATE        ExecutionType = "generate"
+	EXECUTION_VALIDATE_INPUT  ExecutionType = "validate_input"
+	EXECUTION_GENERATE_OUTPUT ExecutionType = "generate_output"
+
+	// Checks of AI-proposed tests, see test_proposals.go
+	EXECUTION_PROPOSE_VALIDATE ExecutionType = "propose_validate"
+	EXECUTION_PROPOSE_OUTPUT   ExecutionType = "propose_output"
+
+	GENERATION_STATUS_GENERATING GenerationStatus = "generating"
+	GENERATION_STATUS_VALIDATING GenerationStatus = "validating"
+	GENERATION_STATUS_SOLVING    GenerationStatus = "solving"
+	GENERATION_STATUS_COMPLETED  GenerationStatus = "completed"
+	GENERATION_STATUS_FAILED     GenerationStatus = "failed"
+
+	AI_JOB_EXPLANATION AIJobKind = "explanation"
+	AI_JOB_FEEDBACK    AIJobKind = "feedback"
+	AI_JOB_TEST_CASES  AIJobKind = "test_cases"
+
+	AI_JOB_STATUS_QUEUED    AIJobStatus = "queued" // also while waiting to retry
+	AI_JOB_STATUS_RUNNING   AIJobStatus = "running"
+	AI_JOB_STATUS_COMPLETED AIJobStatus = "completed"
+	AI_JOB_STATUS_FAILED    AIJobStatus = "failed"
+
+	HINT_SOURCE_AUTHOR HintSource = "author"
+	HINT_SOURCE_AI     HintSource = "ai"
+
+	// What an AI call was for, see ai_usage.go
+	AI_FEATURE_EXPLANATION AIFeature = "explanation"
+	AI_FEATURE_FEEDBACK    AIFeature = "feedback"
+	AI_FEATURE_HINT        AIFeature = "hint"
+	AI_FEATURE_TEST_CASES  AIFeature = "test_cases"
+
+	PLAGIARISM_CHECK_RUNNING   PlagiarismCheckStatus = "running"
+	PLAGIARISM_CHECK_COMPLETED PlagiarismCheckStatus = "completed"
+	PLAGIARISM_CHECK_FAILED    PlagiarismCheckStatus = "failed"
+
+	PLAGIARISM_REVIEW_PENDING   PlagiarismReview = "pending"
+	PLAGIARISM_REVIEW_CONFIRMED PlagiarismReview = "confirmed" // copied, see the disqualifications
+	PLAGIARISM_REVIEW_DISMISSED PlagiarismReview = "dismissed"
+
+	PROPOSAL_STATUS_VALIDATING TestProposalStatus = "validating"
+	PROPOSAL_STATUS_SOLVING    TestProposalStatus = "solving"
+	PROPOSAL_STATUS_READY      TestProposalStatus = "ready"   // waits for the author
+	PROPOSAL_STATUS_INVALID    TestProposalStatus = "invalid" // rejected by the input validator
+	PROPOSAL_STATUS_FAILED     TestProposalStatus = "failed"  // the reference solution failed on it
+	PROPOSAL_STATUS_ACCEPTED   TestProposalStatus = "accepted"
+	PROPOSAL_STATUS_DISMISSED  TestProposalStatus = "dismissed"
+
 	VOTE_NIL  Vote = 0
 	VOTE_UP   Vote = 1
 	VOTE_DOWN Vote = -1
+
+	SEARCH_ENTITY_PROBLEM    SearchEntityType = "problem"
+	SEARCH_ENTITY_DISCUSSION SearchEntityType = "discussion"
+
+	// API token scopes, see requiredScopes
+	SCOPE_READ   TokenScope = "read"   // any GET request
+	SCOPE_SUBMIT TokenScope = "submit" // run and submit code, fetch the results
+	SCOPE_WRITE  TokenScope = "write"  // anything the user may do, implies the others
 )
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"oj-be/prompts"
+)
+
+// Feedback on code the user already ran or submitted explains how that
+// attempt failed: its verdict, the compiler error and, when the user can
+// see the tests, the runtime error and the failing input with both
+// outputs. The answer goes back to the user, so nothing of a hidden test
+// may reach the prompt, not even a runtime error that could print it.
+
+// Feedback is steered by the explanation of the reference solution and
+// can't be priced like a hint, so it's off on the problems of a contest the
+// user is taking part in.
+var ErrFeedbackDisabled = errors.New("feedback is disabled during this contest")
+
+// hiddenTestData replaces the data of submission tests, see hideTestData.
+// Runs keep theirs, the user chose those cases.
+const hiddenTestData = "<hidden>"
+
+// maxFeedbackDataSize caps each test field and the error text in a prompt.
+const maxFeedbackDataSize = 2 << 10
+
+// FeedbackRequest is the code to review and, when the user ran or submitted
+// it, how it did.
+type FeedbackRequest struct {
+	Code        string
+	Language    string
+	Verdict     string
+	Error       string
+	FailingTest *prompts.Test
+	CodeChanged bool // Verdict is of an earlier version of Code
+}
+
+// isErrorStatus reports whether a test status comes with error output
+// instead of the program's answer.
+func isErrorStatus(status string) bool {
+	status = strings.ToLower(status)
+	return status == "compilation error" || status == "runtime error"
+}
+
+// judgeError is the error output of the first test that failed with one,
+// kept on the submission before its test data is hidden.
+func judgeError(results []TestResult) string {
+	for _, result := range results {
+		if isErrorStatus(result.Status) {
+			return truncate(result.Output, maxFeedbackDataSize)
+		}
+	}
+	return ""
+}
+
+// compileError is the compiler output, if the code didn't compile. Unlike
+// runtime errors it can't contain test data.
+func compileError(results []TestResult) string {
+	for _, result := range results {
+		if strings.EqualFold(result.Status, "compilation error") {
+			return truncate(result.Output, maxFeedbackDataSize)
+		}
+	}
+	return ""
+}
+
+// hideTestData keeps the tests out of a judged submission, leaving only
+// compiler output in its message.
+func hideTestData(sub *Submission) {
+	sub.Message = compileError(sub.Results)
+	for i := range sub.Results {
+		sub.Results[i].Input = hiddenTestData
+		sub.Results[i].Output = hiddenTestData
+		sub.Results[i].ExpectedOutput = hiddenTestData
+	}
+}
+
+// checkFeedbackAllowed returns ErrFeedbackDisabled while the problem is in
+// a running contest of the user, see hintContest.
+func (s *serviceImpl) checkFeedbackAllowed(ctx context.Context, userID, problemID int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	contestID, _, err := s.hintContest(ctx, userID, problemID)
+	if err != nil {
+		return err
+	}
+	if contestID != nil {
+		return ErrFeedbackDisabled
+	}
+	return nil
+}
+
+// lastJudgedAttempt is a copy of the user's latest finished run or
+// submission to the problem, and whether its code differs from code. ok is
+// false if nothing was judged yet.
+func (s *serviceImpl) lastJudgedAttempt(userID, problemID int, code string) (sub Submission, codeChanged, ok bool) {
+	s.submissionsMu.Lock()
+	defer s.submissionsMu.Unlock()
+	for i := len(s.submissions) - 1; i >= 0; i-- {
+		sub := s.submissions[i]
+		if sub.UserID != userID || sub.ProblemID == nil || *sub.ProblemID != problemID {
+			continue
+		}
+		if sub.Status == "pending" || len(sub.Results) == 0 {
+			continue
+		}
+		// Results is replaced, not changed in place, when a result comes in
+		return sub, strings.TrimSpace(sub.Code) != strings.TrimSpace(code), true
+	}
+	return Submission{}, false, false
+}
+
+// feedbackRequest adds what is known about how the code did to a feedback
+// request. When the user changed the code since, that's how the previous
+// version did.
+func (s *serviceImpl) feedbackRequest(userID, problemID int, code string) FeedbackRequest {
+	req := FeedbackRequest{Code: code}
+	sub, codeChanged, ok := s.lastJudgedAttempt(userID, problemID, code)
+	if !ok {
+		return req
+	}
+
+	req.CodeChanged = codeChanged
+	req.Language = string(sub.Language)
+	req.Verdict = "accepted"
+	req.Error = sub.Message
+	for i, result := range sub.Results {
+		if strings.EqualFold(result.Status, "accepted") {
+			continue
+		}
+		if req.Error == "" && isErrorStatus(result.Status) && result.Output != hiddenTestData {
+			req.Error = truncate(result.Output, maxFeedbackDataSize)
+		}
+		// Code that doesn't compile fails every test the same way
+		if strings.EqualFold(result.Status, "compilation error") {
+			req.Verdict = "compilation error"
+			break
+		}
+		req.Verdict = fmt.Sprintf("%s on test %d", strings.ToLower(result.Status), i+1)
+		if result.Input != hiddenTestData {
+			req.FailingTest = &prompts.Test{
+				Input:          truncate(result.Input, maxFeedbackDataSize),
+				ExpectedOutput: truncate(result.ExpectedOutput, maxFeedbackDataSize),
+				Output:         truncate(result.Output, maxFeedbackDataSize),
+			}
+		}
+		break
+	}
+	return req
+}
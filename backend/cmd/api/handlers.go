@@ -2,6 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,16 +15,19 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
+
+	"oj-be/prompts"
 )
 
 type Handler struct {
 	service *serviceImpl
 	redis   *RedisService
 	ai      *AI
+	tokens  *TokenIssuer
 }
 
-func NewHandler(service *serviceImpl, redis *RedisService, ai *AI) *Handler {
-	return &Handler{service: service, redis: redis, ai: ai}
+func NewHandler(service *serviceImpl, redis *RedisService, ai *AI, tokens *TokenIssuer) *Handler {
+	return &Handler{service: service, redis: redis, ai: ai, tokens: tokens}
 }
 
 func (h *Handler) Routes() http.Handler {
@@ -48,6 +54,12 @@ func (h *Handler) Routes() http.Handler {
 	r.Post("/signup", h.Signup)
 	r.Post("/login", h.Login)
 	r.Post("/logout", h.Logout)
+	r.Post("/login/2fa", h.CompleteTwoFactorLogin)
+	r.Post("/login/2fa/setup", h.BeginTwoFactorLoginSetup)
+	r.Post("/refresh", h.RefreshSession)
+	r.Post("/verify-email", h.VerifyEmail)
+	r.With(httprate.LimitByIP(5, 15*time.Minute)).Post("/password/forgot", h.RequestPasswordReset)
+	r.Post("/password/reset", h.ResetPassword)
 	r.Get("/profile/{username}", h.GetUserProfile)
 	r.Get("/problems", h.GetProblems)
 	r.Get("/problem/{slug}", h.GetProblemBySlug)
@@ -60,27 +72,118 @@ func (h *Handler) Routes() http.Handler {
 	r.Get("/discussion/{id}", h.GetDiscussionByID)
 	r.Get("/problems/{problemId}/discussions", h.GetDiscussionsByProblemID)
 
-	r.Get("/some/unpredictable/yet/public/endpoint", h.ResetDB) // for cron jobs
+	r.Get("/search", h.Search)
 
 	// Protected routes
 	r.Group(func(protected chi.Router) {
-		protected.Use(AuthMiddleware)
+		protected.Use(AuthMiddleware(h.tokens, h.service))
+		protected.Use(PermissionsMiddleware(h.service))
+		protected.Use(APITokenScopeMiddleware)
+
+		// Problem authoring and review, see problem_review.go for who may
+		// view or edit which problem
+		protected.Group(func(authoring chi.Router) {
+			view := authoring.With(h.problemAccess(false))
+			edit := authoring.With(h.problemAccess(true))
+			setter := authoring.With(RequirePermission(PERMISSION_PROBLEM_AUTHOR))
+
+			view.Get("/problem-list/{slug}", h.AdminGetProblemBySlug)
+			view.Get("/problem-list/{slug}/package", h.ExportProblemPackage)
+			authoring.Get("/problem-list", h.AdminGetProblems)
+			setter.Post("/problems", h.AddProblem)
+			edit.Put("/problems/{id}", h.UpdateProblem)
+			setter.Post("/problems/package", h.ImportProblemPackage)
+			edit.Post("/problems/{id}/tests", h.UploadTestArchive)
+			edit.Post("/problems/{id}/generate", h.StartTestGeneration)
+			view.Get("/problems/{id}/hints/all", h.GetProblemHints)
+			edit.Put("/problems/{id}/hints", h.SetProblemHints)
+			authoring.Get("/generation-jobs/{id}", h.GetTestGenerationJob)
+			edit.Post("/problems/{id}/test-proposals", h.StartTestProposals)
+			view.Get("/problems/{id}/test-proposals", h.GetTestProposals)
+			edit.Post("/problems/{id}/test-proposals/accept", h.AcceptTestProposals)
+			edit.Post("/problems/{id}/test-proposals/dismiss", h.DismissTestProposals)
+
+			manage := authoring.With(RequirePermission(PERMISSION_PROBLEM_MANAGE))
+			manage.Get("/prompts", h.GetPrompts)
+			manage.Post("/problems/{id}/prompts/{name}/preview", h.PreviewPrompt)
+
+			// Rejudges, contest managers rejudge their contests below
+			manage.Post("/submission/{id}/rejudge", h.RejudgeSubmission)
+			manage.Get("/submission/{id}/verdicts", h.GetSubmissionVerdicts)
+			manage.Post("/problems/{id}/rejudge", h.RejudgeProblem)
+
+			view.Get("/problems/{id}/revisions", h.GetProblemRevisions)
+			view.Get("/problems/{id}/revisions/diff", h.DiffProblemRevisions)
+			view.Get("/problems/{id}/revisions/{revision}", h.GetProblemRevision)
+			edit.Post("/problems/{id}/revisions/{revision}/rollback", h.RollbackProblem)
+
+			edit.Post("/problems/{id}/review/submit", h.SubmitProblemForReview)
+			view.Get("/problems/{id}/reviews", h.GetProblemReviews)
+			view.Post("/problems/{id}/reviews", h.ReviewProblem)
+			view.With(RequireResourcePermission(PERMISSION_PROBLEM_TEST, RESOURCE_PROBLEM, "id")).
+				Post("/problems/{id}/test-runs", h.TestProblem)
+		})
+
+		// Contest managers run every contest, or only the ones granted to them
+		protected.Group(func(contests chi.Router) {
+			manage := contests.With(RequireResourcePermission(PERMISSION_CONTEST_MANAGE, RESOURCE_CONTEST, "id"))
+
+			contests.With(RequirePermission(PERMISSION_CONTEST_MANAGE)).Post("/contest", h.CreateContest)
+			manage.Put("/contest/{id}", h.UpdateContest)
+
+			manage.Post("/contest/{id}/start", h.StartContest)
+			manage.Post("/contest/{id}/end", h.EndContest)
+
+			manage.Post("/contest/{id}/plagiarism", h.StartPlagiarismCheck)
+			manage.Get("/contest/{id}/plagiarism", h.GetPlagiarismChecks)
+			manage.Get("/contest/{id}/plagiarism/{checkID}", h.GetPlagiarismCheck)
+			manage.Put("/contest/{id}/plagiarism/pairs/{pairID}", h.ReviewPlagiarismPair)
+			manage.Get("/contest/{id}/disqualifications", h.GetDisqualifications)
+			manage.Post("/contest/{id}/disqualifications", h.DisqualifyParticipant)
+			manage.Delete("/contest/{id}/disqualifications/{userID}", h.ReinstateParticipant)
+
+			manage.Post("/contest/{id}/rejudge", h.RejudgeContest)
+		})
 
-		protected.Group(func(admin chi.Router) {
-			admin.Use(AdminOnlyMiddleware)
+		// Problem managers see every rejudge, contest managers those of
+		// their contests
+		protected.Get("/rejudges/{id}", h.GetRejudge)
 
-			admin.Get("/problem-list/{slug}", h.AdminGetProblemBySlug)
-			admin.Get("/problem-list", h.AdminGetProblems)
-			admin.Post("/problems", h.AddProblem)
-			admin.Put("/problems/{id}", h.UpdateProblem)
+		protected.Group(func(users chi.Router) {
+			users.Use(RequirePermission(PERMISSION_USER_MANAGE))
 
-			admin.Post("/contest", h.CreateContest)
-			admin.Put("/contest/{id}", h.UpdateContest)
+			users.Get("/users/{id}/roles", h.GetUserRoles)
+			users.Put("/users/{id}/role", h.SetUserRole)
+			users.Post("/users/{id}/grants", h.AddRoleGrant)
+			users.Delete("/users/{id}/grants/{grantID}", h.RemoveRoleGrant)
 
-			admin.Post("/contest/{id}/start", h.StartContest)
-			admin.Post("/contest/{id}/end", h.EndContest)
+			users.Get("/ai/usage", h.GetAIUsageReport)
+			users.Get("/ai/quotas", h.GetAIQuotas)
+			users.Put("/ai/quotas/{role}", h.SetAIQuota)
 		})
 		protected.Get("/me", h.GetCurrentUserProfile)
+		protected.Get("/me/permissions", h.GetCurrentUserPermissions)
+		protected.Get("/me/ai-usage", h.GetAIUsageStatus)
+		protected.With(httprate.LimitByIP(5, 15*time.Minute)).Post("/verify-email/resend", h.ResendVerificationEmail)
+
+		// Account security needs a login, API tokens can't change it
+		protected.Group(func(account chi.Router) {
+			account.Use(SessionOnly)
+
+			account.Get("/2fa", h.GetTwoFactorStatus)
+			account.Post("/2fa/setup", h.BeginTwoFactorSetup)
+			account.Post("/2fa/enable", h.EnableTwoFactor)
+			account.Post("/2fa/disable", h.DisableTwoFactor)
+			account.Post("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+
+			account.Get("/sessions", h.GetSessions)
+			account.Delete("/sessions", h.RevokeAllSessions)
+			account.Delete("/sessions/{id}", h.RevokeSession)
+
+			account.Get("/tokens", h.GetAPITokens)
+			account.Post("/tokens", h.CreateAPIToken)
+			account.Delete("/tokens/{id}", h.RevokeAPIToken)
+		})
 
 		protected.Route("/", func(slow chi.Router) {
 			slow.Use(httprate.Limit(
@@ -93,7 +196,11 @@ func (h *Handler) Routes() http.Handler {
 			slow.Post("/submit", h.SubmitCode)
 
 			slow.Post("/feedback", h.AIFeedback)
+			slow.Post("/feedback/stream", h.StreamAIFeedback)
+			slow.Post("/problems/{id}/hints/{level}", h.RevealHint)
 		})
+		protected.Get("/problems/{id}/hints", h.GetHintLadder)
+		protected.Get("/ai-jobs/{id}", h.GetAIJob)
 
 		protected.Get("/submissions/{problemID}", h.GetUserSubmissions)
 		protected.Get("/run/{runID}", h.GetRunResult)
@@ -124,317 +231,1167 @@ func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
 
 	userId, role, err := h.service.Register(r.Context(), payload.Username, payload.Email, payload.Password)
 	if err != nil {
+		if errors.Is(err, ErrWeakPassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	token, err := CreateJWTToken(userId, role)
-	if err != nil {
+	// The account works without a verified address, so a mail failure
+	// shouldn't fail the signup; the user can ask for another link
+	if err := h.service.SendVerificationEmail(r.Context(), userId); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", userId, err)
+	}
+
+	if err := h.startSession(w, r, userId, role); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	setAuthCookie(w, token)
 	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
 }
 
-func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
-	setAuthCookie(w, "")
+// VerifyEmail takes {"Token": "..."} from the mailed link.
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body struct{ Token string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), body.Token); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
 }
 
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var payload LoginPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+func (h *Handler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	if err := h.service.SendVerificationEmail(r.Context(), userID); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
+}
 
-	log.Println("\n\n", payload.Username, payload.Password)
-
-	userId, role, err := h.service.Login(r.Context(), payload.Username, payload.Password)
-	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+// RequestPasswordReset takes {"Email": "..."} and always answers ok.
+func (h *Handler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var body struct{ Email string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	token, err := CreateJWTToken(userId, role)
-	if err != nil {
+	if err := h.service.RequestPasswordReset(r.Context(), strings.TrimSpace(body.Email)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	setAuthCookie(w, token)
 	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
 }
 
-func (h *Handler) GetCurrentUserProfile(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(ContextUserIDKey).(int)
-
-	user, err := h.service.GetUserByID(r.Context(), userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+// ResetPassword takes {"Token": "...", "Password": "..."}.
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string
+		Password string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	json.NewEncoder(w).Encode(user)
-}
 
-func (h *Handler) GetUserProfile(w http.ResponseWriter, r *http.Request) {
-	username := chi.URLParam(r, "username")
-	user, err := h.service.GetUserProfile(r.Context(), username)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err := h.service.ResetPassword(r.Context(), body.Token, body.Password); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) || errors.Is(err, ErrWeakPassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
 }
 
-// --- PROBLEMS ---
+// Logout ends the current session, found through the refresh token so it
+// works after the access token expired.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(RefreshCookieName); err == nil && cookie.Value != "" {
+		if err := h.service.RevokeSessionByRefreshToken(r.Context(), cookie.Value); err != nil && !errors.Is(err, ErrInvalidRefreshToken) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	clearAuthCookies(w)
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
+}
 
-func (h *Handler) AdminGetProblemBySlug(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	problem, err := h.service.AdminGetProblemBySlug(r.Context(), slug)
+// startSession creates a session and sets its access and refresh cookies.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, userID int, role string) error {
+	sessionID, refreshToken, err := h.service.CreateSession(r.Context(), userID, r.UserAgent(), r.RemoteAddr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+		return err
 	}
-	json.NewEncoder(w).Encode(problem)
+	return h.setSessionCookies(w, userID, role, sessionID, refreshToken)
 }
 
-func (h *Handler) AdminGetProblems(w http.ResponseWriter, r *http.Request) {
-	problems, err := h.service.AdminGetProblems(r.Context())
+func (h *Handler) setSessionCookies(w http.ResponseWriter, userID int, role, sessionID, refreshToken string) error {
+	token, expires, err := h.tokens.CreateAccessToken(userID, role, sessionID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
-	json.NewEncoder(w).Encode(problems)
+	setAuthCookie(w, AuthCookieName, token, expires)
+	setAuthCookie(w, RefreshCookieName, refreshToken, time.Now().Add(h.service.refreshTokenTTL))
+	return nil
 }
 
-func (h *Handler) GetProblemBySlug(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	problem, err := h.service.GetProblemBySlug(r.Context(), slug)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+// RefreshSession trades the refresh token cookie for a new access token and
+// a new refresh token.
+func (h *Handler) RefreshSession(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(RefreshCookieName)
+	if err != nil || cookie.Value == "" {
+		http.Error(w, "Login required", http.StatusUnauthorized)
 		return
 	}
-	json.NewEncoder(w).Encode(problem)
-}
 
-func (h *Handler) GetProblems(w http.ResponseWriter, r *http.Request) {
-	problems, err := h.service.GetProblems(r.Context())
+	userID, role, sessionID, refreshToken, err := h.service.RefreshSession(r.Context(), cookie.Value, r.UserAgent(), r.RemoteAddr)
 	if err != nil {
+		// The request that won the race set the new cookies, keep them
+		if errors.Is(err, ErrRefreshTokenRotated) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			clearAuthCookies(w)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(problems)
-}
 
-func (h *Handler) AddProblem(w http.ResponseWriter, r *http.Request) {
-	var p ProblemDetail
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.setSessionCookies(w, userID, role, sessionID, refreshToken); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	id, err := h.service.AddProblem(r.Context(), &p)
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
+}
+
+func (h *Handler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	tokens, err := h.service.GetAPITokens(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// h.ai.AddProblemExplanation(id)
-	json.NewEncoder(w).Encode(map[string]int{"id": id})
+	json.NewEncoder(w).Encode(tokens)
 }
 
-func (h *Handler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	var p ProblemDetail
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+// CreateAPIToken takes {"Name": "...", "Scopes": ["read", "submit"],
+// "ExpiresInDays": 90} and returns the token. ExpiresInDays is optional.
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	var body struct {
+		Name          string
+		Scopes        []TokenScope
+		ExpiresInDays int
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := h.service.UpdateProblemByID(r.Context(), id, &p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if body.ExpiresInDays < 0 {
+		http.Error(w, "ExpiresInDays must not be negative", http.StatusBadRequest)
 		return
 	}
 
-	// h.ai.AddProblemExplanation(id)
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// --- CODE EXECUTION / SUBMISSION ---
-
-func (h *Handler) RunCode(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(ContextUserIDKey).(int)
+	var expiresAt *time.Time
+	if body.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		expiresAt = &t
+	}
 
-	var payload RunCodePayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	apiToken, token, err := h.service.CreateAPIToken(r.Context(), userID, body.Name, body.Scopes, expiresAt)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]any{"token": token, "api_token": apiToken})
+}
 
-	if strings.TrimSpace(payload.Code) == "" {
-		http.Error(w, "empty code provided", http.StatusBadRequest)
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid token id", http.StatusBadRequest)
 		return
 	}
+	if err := h.service.RevokeAPIToken(r.Context(), userID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
+}
 
-	runID, err := h.service.RunCode(r.Context(), userID, payload.ProblemID, payload.Language, payload.Code, payload.Cases)
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	sessionID, _ := r.Context().Value(ContextSessionIDKey).(string)
+	sessions, err := h.service.GetSessions(r.Context(), userID, sessionID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]int{"run_id": runID})
+	json.NewEncoder(w).Encode(sessions)
 }
 
-func (h *Handler) GetRunResult(w http.ResponseWriter, r *http.Request) {
-	runID, _ := strconv.Atoi(chi.URLParam(r, "runID"))
-	result, err := h.service.GetRunResult(r.Context(), runID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id := chi.URLParam(r, "id")
+	if err := h.service.RevokeSession(r.Context(), userID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	json.NewEncoder(w).Encode(result)
+	if current, _ := r.Context().Value(ContextSessionIDKey).(string); current == id {
+		clearAuthCookies(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) SubmitCode(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(ContextUserIDKey).(int)
-	if !ok {
-		http.Error(w, "unauthorized: missing user_id in context", http.StatusUnauthorized)
+// RevokeAllSessions logs the user out everywhere, this device included.
+func (h *Handler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	if err := h.service.RevokeAllSessions(r.Context(), userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	var sub SubmissionPayload
-	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var payload LoginPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if strings.TrimSpace(sub.Code) == "" {
-		http.Error(w, "empty code provided", http.StatusBadRequest)
+	userId, role, err := h.service.Login(r.Context(), payload.Username, payload.Password)
+	if err != nil {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	id, err := h.service.SubmitCode(r.Context(), userID, sub.ProblemID, sub.ContestID, sub.Language, sub.Code)
+	// With 2FA the password only earns a challenge, see CompleteTwoFactorLogin
+	enabled, err := h.service.TwoFactorEnabled(r.Context(), userId)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	json.NewEncoder(w).Encode(map[string]int{"run_id": id})
-}
-
-func (h *Handler) GetSubmissionResult(w http.ResponseWriter, r *http.Request) {
-	runID, _ := strconv.Atoi(chi.URLParam(r, "runID"))
-	sub, err := h.service.GetSubmissionResult(r.Context(), runID)
+	perms, err := h.service.GetUserPermissions(r.Context(), userId)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// sub.Results = make([]TestResult, 0)
-	json.NewEncoder(w).Encode(sub)
-}
-
-func (h *Handler) GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(ContextUserIDKey).(int)
-	if !ok {
-		http.Error(w, "unauthorized: missing user_id in context", http.StatusUnauthorized)
+	if enabled || requiresTwoFactor(perms) {
+		challenge, err := h.service.CreateLoginChallenge(r.Context(), LoginChallenge{
+			UserID: userId, Role: role, SetupRequired: !enabled,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"two_factor_required": true,
+			"setup_required":      !enabled,
+			"challenge":           challenge,
+		})
 		return
 	}
 
-	problemID, _ := strconv.Atoi(chi.URLParam(r, "problemID"))
-
-	subs, err := h.service.GetUserSubmissions(r.Context(), userID, problemID)
-	if err != nil {
+	if err := h.startSession(w, r, userId, role); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	json.NewEncoder(w).Encode(subs)
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
 }
 
-// --- CONTESTS ---
-
-func (h *Handler) CreateContest(w http.ResponseWriter, r *http.Request) {
-	var c Contest
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+// BeginTwoFactorLoginSetup takes {"Challenge": "..."} of a login that must
+// enroll first and returns the secret to add to an authenticator app.
+func (h *Handler) BeginTwoFactorLoginSetup(w http.ResponseWriter, r *http.Request) {
+	var body struct{ Challenge string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	id, err := h.service.CreateContest(r.Context(), &c)
+	challenge, err := h.service.GetLoginChallenge(r.Context(), body.Challenge)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !challenge.SetupRequired {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusBadRequest)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]int{"contest_id": id})
+	secret, uri, err := h.service.BeginTwoFactorSetup(r.Context(), challenge.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"secret": secret, "uri": uri})
 }
 
-func (h *Handler) UpdateContest(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	var c Contest
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+// CompleteTwoFactorLogin takes {"Challenge": "...", "Code": "..."} and
+// finishes the login. Recovery codes are included when the login enrolled
+// the user.
+func (h *Handler) CompleteTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Challenge string
+		Code      string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.UpdateContest(r.Context(), id, &c); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	challenge, codes, err := h.service.CompleteLoginChallenge(r.Context(), body.Challenge, body.Code)
+	if err != nil {
+		// 401 means the password step has to be redone
+		if errors.Is(err, ErrInvalidChallenge) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, ErrTooManyAttempts) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	if err := h.startSession(w, r, challenge.UserID, challenge.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok", "recovery_codes": codes})
 }
 
-func (h *Handler) GetAllContests(w http.ResponseWriter, r *http.Request) {
-	contests, err := h.service.GetAllContests(r.Context())
+func (h *Handler) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	enabled, err := h.service.TwoFactorEnabled(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(contests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"enabled":  enabled,
+		"required": requiresTwoFactor(permissionsFromContext(r.Context())),
+	})
 }
 
-func (h *Handler) GetContestByID(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	contest, err := h.service.GetContestByID(r.Context(), id)
+func (h *Handler) BeginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	secret, uri, err := h.service.BeginTwoFactorSetup(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	json.NewEncoder(w).Encode(contest)
+	json.NewEncoder(w).Encode(map[string]any{"secret": secret, "uri": uri})
 }
 
-func (h *Handler) JoinContest(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(ContextUserIDKey).(int)
-	if !ok {
-		http.Error(w, "unauthorized: missing user_id in context", http.StatusUnauthorized)
+// EnableTwoFactor takes {"Code": "..."} from the authenticator app and
+// returns the recovery codes.
+func (h *Handler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	var body struct{ Code string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	err := h.service.JoinContestByID(r.Context(), userID, contestID)
+	codes, err := h.service.EnableTwoFactor(r.Context(), userID, body.Code)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// DisableTwoFactor takes {"Code": "..."}, a TOTP or recovery code.
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	var body struct{ Code string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DisableTwoFactor(r.Context(), userID, body.Code); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"message": "ok"})
 }
 
-func (h *Handler) StartContest(w http.ResponseWriter, r *http.Request) {
-	contestID, err := strconv.Atoi(chi.URLParam(r, "id"))
-	if err != nil {
-		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+// RegenerateRecoveryCodes takes {"Code": "..."} and returns new recovery
+// codes, voiding the old ones.
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	var body struct{ Code string }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Retrieve the contest data
-	contest, err := h.service.GetContestByID(r.Context(), contestID)
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), userID, body.Code)
 	if err != nil {
-		http.Error(w, "Failed to fetch contest: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
 
-	// Cache each problem's max points in Redis
+func (h *Handler) GetCurrentUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+
+	user, err := h.service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) GetUserProfile(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	user, err := h.service.GetUserProfile(r.Context(), username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) GetCurrentUserPermissions(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(permissionsFromContext(r.Context()))
+}
+
+// --- ROLES ---
+
+func (h *Handler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	roles, err := h.service.GetUserRoles(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(roles)
+}
+
+// SetUserRole takes {"Role": "..."} and replaces the user's primary role.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if id == userID {
+		http.Error(w, "you can't change your own role", http.StatusBadRequest)
+		return
+	}
+
+	var body struct{ Role UserRole }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetUserRole(r.Context(), id, body.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddRoleGrant takes {"Role": "...", "ResourceType": "contest", "ResourceID": 3};
+// leave out the resource for a global grant.
+func (h *Handler) AddRoleGrant(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if id == userID {
+		http.Error(w, "you can't change your own grants", http.StatusBadRequest)
+		return
+	}
+
+	var grant RoleGrant
+	if err := json.NewDecoder(r.Body).Decode(&grant); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	grant.UserID = id
+	grant.GrantedBy = &userID
+
+	grantID, err := h.service.AddRoleGrant(r.Context(), &grant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"id": grantID})
+}
+
+func (h *Handler) RemoveRoleGrant(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	grantID, _ := strconv.Atoi(chi.URLParam(r, "grantID"))
+	if id == userID {
+		http.Error(w, "you can't change your own grants", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RemoveRoleGrant(r.Context(), id, grantID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- PROBLEMS ---
+
+func (h *Handler) AdminGetProblemBySlug(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	problem, err := h.service.AdminGetProblemBySlug(r.Context(), slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(problem)
+}
+
+func (h *Handler) AdminGetProblems(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	problems, err := h.service.AdminGetProblems(r.Context(), userID, permissionsFromContext(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(problems)
+}
+
+func (h *Handler) GetProblemBySlug(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	problem, err := h.service.GetProblemBySlug(r.Context(), slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(problem)
+}
+
+func (h *Handler) GetProblems(w http.ResponseWriter, r *http.Request) {
+	problems, err := h.service.GetProblems(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(problems)
+}
+
+func (h *Handler) AddProblem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	var p ProblemDetail
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.AuthorID = userID
+	id, err := h.service.AddProblem(r.Context(), &p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// h.ai.AddProblemExplanation(id)
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+func (h *Handler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	var p ProblemDetail
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.service.UpdateProblemByID(r.Context(), id, userID, &p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// h.ai.AddProblemExplanation(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ImportProblemPackage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxProblemPackageSize)
+	file, _, err := r.FormFile("package")
+	if err != nil {
+		http.Error(w, "missing package file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.service.ImportProblemPackage(r.Context(), userID, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+// UploadTestArchive takes a multipart "tests" zip. Tests are appended unless
+// the "mode" form value is "replace".
+func (h *Handler) UploadTestArchive(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTestArchiveSize)
+	file, _, err := r.FormFile("tests")
+	if err != nil {
+		http.Error(w, "missing tests file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := h.service.UploadTestArchive(r.Context(), id, userID, data, r.FormValue("mode") == "replace")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"uploaded": count})
+}
+
+// StartTestGeneration runs the problem's generator script, validator and
+// reference solution to produce its tests. Tests are replaced unless the
+// body sets "Replace" to false.
+func (h *Handler) StartTestGeneration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	body := struct{ Replace bool }{Replace: true}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobID, err := h.service.StartTestGeneration(r.Context(), id, userID, body.Replace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"job_id": jobID})
+}
+
+// StartTestProposals asks the AI provider for edge-case tests. It answers
+// with an AI job to poll; the proposals are listed once it completes.
+func (h *Handler) StartTestProposals(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body struct{ Count int }
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobID, err := h.service.StartTestProposals(r.Context(), id, userID, body.Count)
+	if err != nil {
+		if writeAIQuotaError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"job_id": jobID})
+}
+
+func (h *Handler) GetTestProposals(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	proposals, err := h.service.GetTestProposals(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(proposals)
+}
+
+func (h *Handler) AcceptTestProposals(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body struct{ IDs []int }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	added, err := h.service.AcceptTestProposals(r.Context(), id, userID, body.IDs)
+	if err != nil {
+		if errors.Is(err, ErrNoReadyProposals) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"added": added})
+}
+
+func (h *Handler) DismissTestProposals(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body struct{ IDs []int }
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DismissTestProposals(r.Context(), id, body.IDs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetTestGenerationJob(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	job, err := h.service.GetTestGenerationJob(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	p, err := h.service.GetProblemOwnership(r.Context(), job.ProblemID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !canAccessProblem(r, p, false) {
+		http.Error(w, ErrProblemForbidden.Error(), http.StatusForbidden)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handler) ExportProblemPackage(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	data, err := h.service.ExportProblemPackage(r.Context(), slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", slug+".zip"))
+	w.Write(data)
+}
+
+func (h *Handler) GetProblemRevisions(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	revisions, err := h.service.GetProblemRevisions(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (h *Handler) GetProblemRevision(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	rev, err := h.service.GetProblemRevision(r.Context(), id, revision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rev)
+}
+
+func (h *Handler) DiffProblemRevisions(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid 'from' revision", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid 'to' revision", http.StatusBadRequest)
+		return
+	}
+
+	diff, err := h.service.DiffProblemRevisions(r.Context(), id, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(diff)
+}
+
+func (h *Handler) RollbackProblem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RollbackProblem(r.Context(), id, revision, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// problemAccess only lets through users who may view the problem named by
+// the {id} or {slug} URL parameter, or edit it when edit is set.
+func (h *Handler) problemAccess(edit bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p *ProblemOwnership
+			var err error
+			if slug := chi.URLParam(r, "slug"); slug != "" {
+				p, err = h.service.GetProblemOwnershipBySlug(r.Context(), slug)
+			} else {
+				id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+				p, err = h.service.GetProblemOwnership(r.Context(), id)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if !canAccessProblem(r, p, edit) {
+				http.Error(w, ErrProblemForbidden.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func canAccessProblem(r *http.Request, p *ProblemOwnership, edit bool) bool {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	perms := permissionsFromContext(r.Context())
+	if edit {
+		return canEditProblem(p, userID, perms)
+	}
+	return canViewProblem(p, userID, perms)
+}
+
+func (h *Handler) SubmitProblemForReview(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body struct{ Comment string }
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.service.SubmitProblemForReview(r.Context(), id, userID, body.Comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReviewProblem takes {"Action": "comment" | "approved" | "changes_requested",
+// "Comment": "..."}. Approving makes the problem active.
+func (h *Handler) ReviewProblem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body struct {
+		Action  ReviewAction
+		Comment string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.service.ReviewProblem(r.Context(), id, userID, permissionsFromContext(r.Context()), body.Action, body.Comment)
+	if err != nil {
+		if errors.Is(err, ErrProblemForbidden) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Action == REVIEW_ACTION_APPROVED {
+		if _, err := h.service.EnqueueAIJob(r.Context(), AI_JOB_EXPLANATION, 0, id, AIJobInput{}); err != nil {
+			log.Printf("Error queueing the explanation of problem %d: %v", id, err)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]ProblemStatus{"status": status})
+}
+
+func (h *Handler) GetProblemReviews(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	reviews, err := h.service.GetProblemReviews(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// TestProblem runs a tester's solution against all tests of a problem in
+// review. Poll GET /run/{runID} for the result.
+func (h *Handler) TestProblem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var payload RunCodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(payload.Code) == "" {
+		http.Error(w, "empty code provided", http.StatusBadRequest)
+		return
+	}
+
+	runID, err := h.service.TestProblem(r.Context(), userID, id, payload.Language, payload.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"run_id": runID})
+}
+
+// --- CODE EXECUTION / SUBMISSION ---
+
+func (h *Handler) RunCode(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+
+	var payload RunCodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(payload.Code) == "" {
+		http.Error(w, "empty code provided", http.StatusBadRequest)
+		return
+	}
+
+	runID, err := h.service.RunCode(r.Context(), userID, payload.ProblemID, payload.Language, payload.Code, payload.Cases)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"run_id": runID})
+}
+
+func (h *Handler) GetRunResult(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	runID, _ := strconv.Atoi(chi.URLParam(r, "runID"))
+	result, err := h.service.GetRunResult(r.Context(), userID, runID)
+	if err != nil {
+		if errors.Is(err, ErrSubmissionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) SubmitCode(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ContextUserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized: missing user_id in context", http.StatusUnauthorized)
+		return
+	}
+
+	var sub SubmissionPayload
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(sub.Code) == "" {
+		http.Error(w, "empty code provided", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.service.SubmitCode(r.Context(), userID, sub.ProblemID, sub.ContestID, sub.Language, sub.Code)
+	if err != nil {
+		if errors.Is(err, ErrEmailNotVerified) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"run_id": id})
+}
+
+func (h *Handler) GetSubmissionResult(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	runID, _ := strconv.Atoi(chi.URLParam(r, "runID"))
+	sub, err := h.service.GetSubmissionResult(r.Context(), userID, runID)
+	if err != nil {
+		if errors.Is(err, ErrSubmissionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// sub.Results = make([]TestResult, 0)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (h *Handler) GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ContextUserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized: missing user_id in context", http.StatusUnauthorized)
+		return
+	}
+
+	problemID, _ := strconv.Atoi(chi.URLParam(r, "problemID"))
+
+	subs, err := h.service.GetUserSubmissions(r.Context(), userID, problemID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(subs)
+}
+
+// --- CONTESTS ---
+
+func (h *Handler) CreateContest(w http.ResponseWriter, r *http.Request) {
+	var c Contest
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.service.CreateContest(r.Context(), &c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"contest_id": id})
+}
+
+func (h *Handler) UpdateContest(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	var c Contest
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UpdateContest(r.Context(), id, &c); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetAllContests(w http.ResponseWriter, r *http.Request) {
+	contests, err := h.service.GetAllContests(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(contests)
+}
+
+func (h *Handler) GetContestByID(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	contest, err := h.service.GetContestByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(contest)
+}
+
+func (h *Handler) JoinContest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(ContextUserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized: missing user_id in context", http.StatusUnauthorized)
+		return
+	}
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := h.service.JoinContestByID(r.Context(), userID, contestID)
+	if err != nil {
+		if errors.Is(err, ErrEmailNotVerified) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) StartContest(w http.ResponseWriter, r *http.Request) {
+	contestID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the contest data
+	contest, err := h.service.GetContestByID(r.Context(), contestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch contest: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Cache each problem's max points in Redis
 	for _, problem := range contest.Problems {
 		key := GetContestProblemKey(contestID, problem.ID)
 		value := CachePoints{Points: problem.MaxPoints}
@@ -449,36 +1406,231 @@ func (h *Handler) StartContest(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) EndContest(w http.ResponseWriter, r *http.Request) {
-	contestID, err := strconv.Atoi(chi.URLParam(r, "id"))
+func (h *Handler) EndContest(w http.ResponseWriter, r *http.Request) {
+	contestID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	// Optionally: remove cached contest problem data from Redis
+	contest, err := h.service.GetContestByID(r.Context(), contestID)
+	if err == nil {
+		for _, problem := range contest.Problems {
+			key := GetContestProblemKey(contestID, problem.ID)
+			_ = h.redis.Delete(r.Context(), key)
+			// if err != nil {
+			// 	log.Printf("Failed to delete key: %v", err)
+			// }
+		}
+	}
+
+	// Look for copied code now that the submissions are in
+	if _, err := h.service.StartPlagiarismCheck(r.Context(), contestID, 0); err != nil {
+		log.Printf("Failed to start plagiarism check for contest %d: %v", contestID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	lb, err := h.service.GetLeaderboard(r.Context(), contestID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(lb)
+}
+
+func (h *Handler) RejudgeSubmission(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	h.rejudge(w, r, RejudgeFilter{SubmissionID: id})
+}
+
+func (h *Handler) RejudgeProblem(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	h.rejudge(w, r, RejudgeFilter{ProblemID: id})
+}
+
+func (h *Handler) RejudgeContest(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	h.rejudge(w, r, RejudgeFilter{ContestID: id})
+}
+
+// rejudge requeues the submissions in scope, only those with the verdict
+// given in the body if there is one.
+func (h *Handler) rejudge(w http.ResponseWriter, r *http.Request, filter RejudgeFilter) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+
+	var body struct{ Verdict string }
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	filter.Verdict = body.Verdict
+
+	rejudge, err := h.service.Rejudge(r.Context(), filter, userID)
+	if err != nil {
+		if errors.Is(err, ErrNothingToRejudge) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rejudge)
+}
+
+func (h *Handler) GetRejudge(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	rejudge, err := h.service.GetRejudge(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrRejudgeNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	perms := permissionsFromContext(r.Context())
+	if !perms.Has(PERMISSION_PROBLEM_MANAGE) &&
+		(rejudge.ContestID == nil || !perms.HasOn(PERMISSION_CONTEST_MANAGE, RESOURCE_CONTEST, *rejudge.ContestID)) {
+		http.Error(w, ErrRejudgeNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rejudge)
+}
+
+func (h *Handler) GetSubmissionVerdicts(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	verdicts, err := h.service.GetSubmissionVerdicts(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(verdicts)
+}
+
+func (h *Handler) StartPlagiarismCheck(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	checkID, err := h.service.StartPlagiarismCheck(r.Context(), contestID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"check_id": checkID})
+}
+
+func (h *Handler) GetPlagiarismChecks(w http.ResponseWriter, r *http.Request) {
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	checks, err := h.service.GetPlagiarismChecks(r.Context(), contestID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(checks)
+}
+
+func (h *Handler) GetPlagiarismCheck(w http.ResponseWriter, r *http.Request) {
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	checkID, _ := strconv.Atoi(chi.URLParam(r, "checkID"))
+
+	check, err := h.service.GetPlagiarismCheck(r.Context(), contestID, checkID)
+	if err != nil {
+		if errors.Is(err, ErrPlagiarismCheckNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(check)
+}
+
+func (h *Handler) ReviewPlagiarismPair(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	pairID, _ := strconv.Atoi(chi.URLParam(r, "pairID"))
+
+	var body struct {
+		Review PlagiarismReview
+		Note   string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ReviewPlagiarismPair(r.Context(), contestID, pairID, userID, body.Review, body.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPlagiarismReview):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrPlagiarismPairNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetDisqualifications(w http.ResponseWriter, r *http.Request) {
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	disqualified, err := h.service.GetDisqualifications(r.Context(), contestID)
 	if err != nil {
-		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	json.NewEncoder(w).Encode(disqualified)
+}
 
-	// Optionally: remove cached contest problem data from Redis
-	contest, err := h.service.GetContestByID(r.Context(), contestID)
-	if err == nil {
-		for _, problem := range contest.Problems {
-			key := GetContestProblemKey(contestID, problem.ID)
-			_ = h.redis.Delete(r.Context(), key)
-			// if err != nil {
-			// 	log.Printf("Failed to delete key: %v", err)
-			// }
-		}
+func (h *Handler) DisqualifyParticipant(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body struct {
+		UserID int
+		Reason string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.UserID <= 0 {
+		http.Error(w, "UserID is required", http.StatusBadRequest)
+		return
 	}
 
+	if err := h.service.DisqualifyParticipant(r.Context(), contestID, body.UserID, userID, body.Reason); err != nil {
+		if errors.Is(err, ErrParticipantNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ReinstateParticipant(w http.ResponseWriter, r *http.Request) {
 	contestID, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	lb, err := h.service.GetLeaderboard(r.Context(), contestID)
-	if err != nil {
+	userID, _ := strconv.Atoi(chi.URLParam(r, "userID"))
+
+	if err := h.service.ReinstateParticipant(r.Context(), contestID, userID); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(lb)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // --- DISCUSSION ---
@@ -505,13 +1657,27 @@ func (h *Handler) CreateDiscussion(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]int{"discussion_id": id})
 }
 
+// UpdateDiscussion lets authors edit their own discussions and moderators
+// any of them.
 func (h *Handler) UpdateDiscussion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+
 	var d Discussion
 	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	existing, err := h.service.GetDiscussionByID(r.Context(), d.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if existing.AuthorID != userID && !permissionsFromContext(r.Context()).Has(PERMISSION_DISCUSSION_MODERATE) {
+		http.Error(w, "unauthorized: not your discussion", http.StatusForbidden)
+		return
+	}
+
 	if err := h.service.UpdateDiscussion(r.Context(), &d); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -588,6 +1754,36 @@ func (h *Handler) AddCommentToDiscussion(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]int{"id": id})
 }
 
+// --- SEARCH ---
+
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "missing search query", http.StatusBadRequest)
+		return
+	}
+
+	entityType := SearchEntityType(r.URL.Query().Get("type"))
+	switch entityType {
+	case "", SEARCH_ENTITY_PROBLEM, SEARCH_ENTITY_DISCUSSION:
+	default:
+		http.Error(w, "invalid search type", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxSearchLimit)
+	}
+
+	results, err := h.service.Search(r.Context(), query, entityType, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
 func (h *Handler) AIFeedback(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		ProblemID int
@@ -599,17 +1795,348 @@ func (h *Handler) AIFeedback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	feedback := h.ai.GetFeedback(r.Context(), payload.ProblemID, payload.Code)
+	if strings.TrimSpace(payload.Code) == "" {
+		http.Error(w, ErrEmptyCode.Error(), http.StatusBadRequest)
+		return
+	}
+	// The prompt holds the statement and the explanation of the solution
+	if !h.canSolveProblem(w, r, payload.ProblemID) {
+		return
+	}
+
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	if err := h.service.checkFeedbackAllowed(r.Context(), userID, payload.ProblemID); err != nil {
+		if errors.Is(err, ErrFeedbackDisabled) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobID, err := h.service.EnqueueAIJob(r.Context(), AI_JOB_FEEDBACK, userID, payload.ProblemID, AIJobInput{Code: payload.Code})
+	if err != nil {
+		if writeAIQuotaError(w, err) {
+			return
+		}
+		if errors.Is(err, ErrProblemNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"job_id": jobID})
+}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"Feedback": feedback})
+// solvableProblem loads the problem of the {id} URL parameter if the user
+// may solve it: it is active, or the user can view it as an author, tester
+// or reviewer. Otherwise it answers 404.
+func (h *Handler) solvableProblem(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	return id, h.canSolveProblem(w, r, id)
+}
+
+// canSolveProblem is solvableProblem for a problem ID given some other way,
+// like in the request body.
+func (h *Handler) canSolveProblem(w http.ResponseWriter, r *http.Request, id int) bool {
+	p, err := h.service.GetProblemOwnership(r.Context(), id)
+	if err != nil || (p.Status != PROBLEM_STATUS_ACTIVE && !canAccessProblem(r, p, false)) {
+		http.Error(w, ErrProblemNotFound.Error(), http.StatusNotFound)
+		return false
+	}
+	return true
 }
 
-func (h *Handler) ResetDB(w http.ResponseWriter, r *http.Request) {
-	err := h.service.ResetDB(r.Context())
+func (h *Handler) GetHintLadder(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.solvableProblem(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	ladder, err := h.service.GetHintLadder(r.Context(), userID, id)
 	if err != nil {
-		log.Println("Error Resetting the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	json.NewEncoder(w).Encode(ladder)
+}
 
-	w.WriteHeader(http.StatusOK)
+func (h *Handler) RevealHint(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.solvableProblem(w, r)
+	if !ok {
+		return
+	}
+	level, err := strconv.Atoi(chi.URLParam(r, "level"))
+	if err != nil {
+		http.Error(w, ErrInvalidHintLevel.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	hint, err := h.ai.RevealHint(r.Context(), userID, id, level)
+	if err != nil {
+		if writeAIQuotaError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, ErrInvalidHintLevel), errors.Is(err, ErrHintLocked):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrHintsDisabled):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrProblemNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrLLMUnavailable):
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(hint)
+}
+
+func (h *Handler) GetProblemHints(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	hints, err := h.service.GetProblemHints(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(hints)
+}
+
+// SetProblemHints takes [{Level, Content}]; empty content clears a level.
+func (h *Handler) SetProblemHints(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	var hints []ProblemHint
+	if err := json.NewDecoder(r.Body).Decode(&hints); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetProblemHints(r.Context(), id, hints); err != nil {
+		if errors.Is(err, ErrInvalidHintLevel) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StreamAIFeedback sends the feedback as server-sent events while it is
+// generated: "chunk" events carry {"text"} pieces and a final "done" event
+// the whole {"feedback", "prompt_version"}. Errors after the stream started come as an "error"
+// event. Closing the connection stops the generation.
+func (h *Handler) StreamAIFeedback(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ProblemID int
+		Code      string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.canSolveProblem(w, r, payload.ProblemID) {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	started := false
+	send := func(event string, data any) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		body, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	feedback, promptVersion, err := h.ai.StreamFeedback(r.Context(), userID, payload.ProblemID, payload.Code, func(chunk string) error {
+		return send("chunk", map[string]string{"text": chunk})
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // the client went away
+		}
+		if started {
+			send("error", map[string]string{"error": err.Error()})
+			return
+		}
+		if writeAIQuotaError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, ErrEmptyCode):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrFeedbackDisabled):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrProblemNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrLLMUnavailable):
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	send("done", map[string]string{"feedback": feedback, "prompt_version": promptVersion})
+}
+
+// GetAIJob reports a feedback job to the user who asked for it. Poll it
+// until the status is completed or failed.
+func (h *Handler) GetAIJob(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	job, err := h.service.GetAIJob(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrAIJobNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	if job.UserID == nil || *job.UserID != userID {
+		http.Error(w, ErrAIJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
+
+// writeAIQuotaError answers 429 with the reset time if err is an exceeded
+// AI quota, and reports whether it did.
+func writeAIQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *AIQuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	retryAfter := int(time.Until(quotaErr.ResetAt).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// GetAIUsageStatus reports the user's AI calls against their quota.
+func (h *Handler) GetAIUsageStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextUserIDKey).(int)
+	status, err := h.service.GetAIUsageStatus(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// GetAIUsageReport sums AI calls and tokens between the from and to query
+// parameters, dates or RFC 3339 times. It defaults to the current month.
+func (h *Handler) GetAIUsageReport(w http.ResponseWriter, r *http.Request) {
+	_, _, from, to := aiQuotaWindows(time.Now())
+	for param, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			parsed, err = time.Parse(time.DateOnly, value)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s, expected a date or RFC 3339 time", param), http.StatusBadRequest)
+			return
+		}
+		*t = parsed
+	}
+
+	report, err := h.service.GetAIUsageReport(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) GetAIQuotas(w http.ResponseWriter, r *http.Request) {
+	quotas, err := h.service.GetAIQuotas(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(quotas)
+}
+
+// SetAIQuota sets the daily and monthly AI call limits of the {role}, null
+// for no limit.
+func (h *Handler) SetAIQuota(w http.ResponseWriter, r *http.Request) {
+	var quota AIQuota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	quota.Role = UserRole(chi.URLParam(r, "role"))
+
+	if err := h.service.SetAIQuota(r.Context(), quota); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPrompts lists the AI prompt templates in use with their source.
+func (h *Handler) GetPrompts(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(h.ai.prompts.List())
+}
+
+// PreviewPrompt renders a prompt against a problem without sending it. The
+// body fills in the fields the problem doesn't, like the code for feedback.
+func (h *Handler) PreviewPrompt(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	var data prompts.Data
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if data.HintLevel == 0 {
+		data.HintLevel = 1
+	}
+	if data.Count == 0 {
+		data.Count = defaultTestProposals
+	}
+
+	prompt, err := h.ai.PreviewPrompt(r.Context(), id, chi.URLParam(r, "name"), data)
+	if err != nil {
+		if errors.Is(err, ErrProblemNotFound) || errors.Is(err, prompts.ErrUnknownPrompt) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"name":    chi.URLParam(r, "name"),
+		"version": prompt.Version,
+		"prompt":  prompt.Text,
+	})
 }
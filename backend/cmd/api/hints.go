@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"oj-be/prompts"
+)
+
+// Hints come in three levels that are revealed in order. A level the author
+// didn't write is generated from the explanation and reference solution the
+// first time someone reveals it, and kept for everyone after.
+const maxHintLevel = 3
+
+var (
+	ErrInvalidHintLevel = fmt.Errorf("hint level must be between 1 and %d", maxHintLevel)
+	ErrHintLocked       = errors.New("reveal the previous hints first")
+	ErrHintsDisabled    = errors.New("hints are disabled during this contest")
+	errHintNotWritten   = errors.New("hint not written yet")
+)
+
+// hintContest finds the running contest with this problem that the user
+// takes part in. penalty is nil when the contest has hints turned off.
+func (s *serviceImpl) hintContest(ctx context.Context, userID, problemID int) (contestID, penalty *int, err error) {
+	err = s.db.QueryRowContext(ctx, `
+		SELECT c.id, c.hint_penalty
+		FROM contests c
+		JOIN contest_problems cp ON cp.contest_id = c.id AND cp.problem_id = $2
+		JOIN contest_participants pa ON pa.contest_id = c.id AND pa.user_id = $1
+		WHERE c.status NOT IN ('ended', 'cancelled')
+		  AND (c.status = 'running' OR CURRENT_TIMESTAMP BETWEEN c.start_time AND c.end_time)
+		ORDER BY c.start_time DESC
+		LIMIT 1`, userID, problemID,
+	).Scan(&contestID, &penalty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check for a running contest: %w", err)
+	}
+	return contestID, penalty, nil
+}
+
+// GetHintLadder lists the hint levels of a problem with the content of the
+// ones the user has revealed.
+func (s *serviceImpl) GetHintLadder(ctx context.Context, userID, problemID int) (*HintLadder, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	ladder := &HintLadder{Hints: make([]ProblemHint, maxHintLevel)}
+	for i := range ladder.Hints {
+		ladder.Hints[i].Level = i + 1
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.level, r.penalty, COALESCE(h.content, ''), COALESCE(h.source::TEXT, '')
+		FROM hint_reveals r
+		LEFT JOIN problem_hints h ON h.problem_id = r.problem_id AND h.level = r.level
+		WHERE r.user_id = $1 AND r.problem_id = $2`, userID, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revealed hints: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var level int
+		var hint ProblemHint
+		if err := rows.Scan(&level, &hint.Penalty, &hint.Content, &hint.Source); err != nil {
+			return nil, err
+		}
+		hint.Level = level
+		hint.Revealed = true
+		ladder.Hints[level-1] = hint
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	contestID, penalty, err := s.hintContest(ctx, userID, problemID)
+	if err != nil {
+		return nil, err
+	}
+	ladder.ContestID = contestID
+	if contestID != nil {
+		ladder.Disabled = penalty == nil
+		if penalty != nil {
+			ladder.Penalty = *penalty
+		}
+	}
+	return ladder, nil
+}
+
+// GetProblemHints returns the stored hints of a problem, written or
+// generated, for its authors.
+func (s *serviceImpl) GetProblemHints(ctx context.Context, problemID int) ([]ProblemHint, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT level, content, source, COALESCE(prompt_version, '') FROM problem_hints
+		WHERE problem_id = $1 ORDER BY level`, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hints: %w", err)
+	}
+	defer rows.Close()
+
+	hints := []ProblemHint{}
+	for rows.Next() {
+		var hint ProblemHint
+		if err := rows.Scan(&hint.Level, &hint.Content, &hint.Source, &hint.PromptVersion); err != nil {
+			return nil, err
+		}
+		hints = append(hints, hint)
+	}
+	return hints, rows.Err()
+}
+
+// SetProblemHints stores author-written hints. A level with empty content
+// is cleared, so it gets generated again; levels not listed are kept.
+func (s *serviceImpl) SetProblemHints(ctx context.Context, problemID int, hints []ProblemHint) error {
+	for _, hint := range hints {
+		if hint.Level < 1 || hint.Level > maxHintLevel {
+			return ErrInvalidHintLevel
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, hint := range hints {
+		content := strings.TrimSpace(hint.Content)
+		if content == "" {
+			_, err = tx.ExecContext(ctx, `DELETE FROM problem_hints WHERE problem_id = $1 AND level = $2`, problemID, hint.Level)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO problem_hints (problem_id, level, content, source)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (problem_id, level)
+				DO UPDATE SET content = EXCLUDED.content, source = EXCLUDED.source, prompt_version = NULL,
+				              updated_at = CURRENT_TIMESTAMP`,
+				problemID, hint.Level, content, HINT_SOURCE_AUTHOR)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save hint %d: %w", hint.Level, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// hintReveal is what revealing a hint would cost the user.
+type hintReveal struct {
+	revealed  bool
+	contestID *int
+	penalty   int
+}
+
+// checkHintReveal makes sure the user may reveal the hint: the levels below
+// it are revealed and the contest the user is in, if any, allows hints.
+func (s *serviceImpl) checkHintReveal(ctx context.Context, userID, problemID, level int) (*hintReveal, error) {
+	if level < 1 || level > maxHintLevel {
+		return nil, ErrInvalidHintLevel
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var below int
+	var revealed bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE level < $3), COUNT(*) FILTER (WHERE level = $3) > 0
+		FROM hint_reveals WHERE user_id = $1 AND problem_id = $2`, userID, problemID, level,
+	).Scan(&below, &revealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revealed hints: %w", err)
+	}
+	if revealed {
+		return &hintReveal{revealed: true}, nil
+	}
+	if below < level-1 {
+		return nil, ErrHintLocked
+	}
+
+	contestID, penalty, err := s.hintContest(ctx, userID, problemID)
+	if err != nil {
+		return nil, err
+	}
+	reveal := &hintReveal{contestID: contestID}
+	if contestID != nil {
+		if penalty == nil {
+			return nil, ErrHintsDisabled
+		}
+		reveal.penalty = *penalty
+	}
+	return reveal, nil
+}
+
+func (s *serviceImpl) recordHintReveal(ctx context.Context, userID, problemID, level int, reveal *hintReveal) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO hint_reveals (user_id, problem_id, level, contest_id, penalty)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`, userID, problemID, level, reveal.contestID, reveal.penalty)
+	if err != nil {
+		return fmt.Errorf("failed to record hint: %w", err)
+	}
+	return nil
+}
+
+func (s *serviceImpl) getProblemHint(ctx context.Context, problemID, level int) (*ProblemHint, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	hint := ProblemHint{Level: level}
+	err := s.db.QueryRowContext(ctx, `SELECT content, source FROM problem_hints WHERE problem_id = $1 AND level = $2`,
+		problemID, level).Scan(&hint.Content, &hint.Source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errHintNotWritten
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hint: %w", err)
+	}
+	return &hint, nil
+}
+
+// saveGeneratedHint keeps a generated hint unless an author wrote one in the
+// meantime, and returns the stored hint.
+func (s *serviceImpl) saveGeneratedHint(ctx context.Context, problemID, level int, content, promptVersion string) (*ProblemHint, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO problem_hints (problem_id, level, content, source, prompt_version)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`, problemID, level, content, HINT_SOURCE_AI, promptVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save hint: %w", err)
+	}
+	return s.getProblemHint(ctx, problemID, level)
+}
+
+// contestHintPenalties sums the hint penalties of each participant.
+func (s *serviceImpl) contestHintPenalties(ctx context.Context, contestID int) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT user_id, SUM(penalty) FROM hint_reveals
+		WHERE contest_id = $1 AND penalty > 0
+		GROUP BY user_id`, contestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hint penalties: %w", err)
+	}
+	defer rows.Close()
+
+	penalties := map[int]int{}
+	for rows.Next() {
+		var userID, penalty int
+		if err := rows.Scan(&userID, &penalty); err != nil {
+			return nil, err
+		}
+		penalties[userID] = penalty
+	}
+	return penalties, rows.Err()
+}
+
+// RevealHint returns a hint level to the user, generating it if nobody
+// wrote it yet, and records the reveal along with its contest penalty.
+func (ai *AI) RevealHint(ctx context.Context, userID, problemID, level int) (*ProblemHint, error) {
+	reveal, err := ai.service.checkHintReveal(ctx, userID, problemID, level)
+	if err != nil {
+		return nil, err
+	}
+
+	hint, err := ai.service.getProblemHint(ctx, problemID, level)
+	if errors.Is(err, errHintNotWritten) {
+		hint, err = ai.generateHint(ctx, userID, problemID, level)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !reveal.revealed {
+		if err := ai.service.recordHintReveal(ctx, userID, problemID, level, reveal); err != nil {
+			return nil, err
+		}
+	}
+	hint.Revealed = true
+	hint.Penalty = reveal.penalty
+	return hint, nil
+}
+
+// generateHint writes a missing hint level. The call counts against the AI
+// quota of the user who revealed it first.
+func (ai *AI) generateHint(ctx context.Context, userID, problemID, level int) (*ProblemHint, error) {
+	problem, err := ai.problemForPrompt(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+	prompt, err := ai.prompts.Render(prompts.Hint, prompts.Data{Problem: problem, HintLevel: level})
+	if err != nil {
+		return nil, err
+	}
+
+	call := aiCall{feature: AI_FEATURE_HINT, userID: userID, problemID: problemID, promptVersion: prompt.Version}
+	content, err := ai.generate(ctx, call, LLMRequest{Prompt: prompt.Text, Temperature: 0})
+	if err != nil {
+		return nil, err
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("%w: empty hint", ErrLLMUnavailable)
+	}
+	log.Printf("Generated hint %d for problem %d", level, problemID)
+	return ai.service.saveGeneratedHint(ctx, problemID, level, content, prompt.Version)
+}
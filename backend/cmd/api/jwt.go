@@ -11,82 +11,129 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// CreateJWTToken creates a signed JWT token with user_id and role
-func CreateJWTToken(userID int, role string) (string, error) {
+// TokenIssuer signs short-lived access tokens. Each token names its signing
+// key in the kid header, so keys can be rotated without logging everyone out.
+type TokenIssuer struct {
+	keys      map[string][]byte
+	keyID     string
+	accessTTL time.Duration
+}
+
+func NewTokenIssuer(cfg *Config) *TokenIssuer {
+	return &TokenIssuer{keys: cfg.JWT_KEYS, keyID: cfg.JWT_KEY_ID, accessTTL: cfg.ACCESS_TOKEN_TTL}
+}
+
+// CreateAccessToken creates a signed JWT token with user_id, role and the
+// session it belongs to
+func (t *TokenIssuer) CreateAccessToken(userID int, role, sessionID string) (string, time.Time, error) {
+	expires := time.Now().Add(t.accessTTL)
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"sid":     sessionID,
+		"exp":     expires.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token.Header["kid"] = t.keyID
+	signed, err := token.SignedString(t.keys[t.keyID])
+	return signed, expires, err
+}
+
+func (t *TokenIssuer) keyFunc(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, errors.New("invalid signing method")
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := t.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
 }
 
-// AuthMiddleware validates JWT in the auth_token cookie and sets user_id and role in context
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(AuthCookieName)
-		if err != nil || strings.TrimSpace(cookie.Value) == "" {
-			// http.Error(w, "unauthorized: missing auth token", http.StatusUnauthorized)
-			http.Error(w, "Login required", http.StatusUnauthorized)
-			return
-		}
-
-		tokenStr := strings.TrimSpace(cookie.Value)
-
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("invalid signing method")
+// AuthMiddleware validates JWT in the auth_token cookie, rejects tokens of
+// revoked sessions and sets user_id, role and the session id in context.
+// A personal API token in the Authorization header is accepted instead, and
+// set in context in place of the session id.
+func AuthMiddleware(tokens *TokenIssuer, service *serviceImpl) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if header := r.Header.Get("Authorization"); header != "" {
+				bearer, ok := strings.CutPrefix(header, "Bearer ")
+				if !ok {
+					http.Error(w, "unauthorized: expected a Bearer token", http.StatusUnauthorized)
+					return
+				}
+				apiToken, err := service.AuthenticateAPIToken(r.Context(), strings.TrimSpace(bearer))
+				if err != nil {
+					if errors.Is(err, ErrInvalidAPIToken) {
+						http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+						return
+					}
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), ContextUserIDKey, apiToken.UserID)
+				ctx = context.WithValue(ctx, ContextRoleKey, apiToken.Role)
+				ctx = context.WithValue(ctx, ContextAPITokenKey, apiToken)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
 			}
-			return jwtSecret, nil
-		})
 
-		if err != nil || !token.Valid {
-			http.Error(w, "unauthorized: invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "unauthorized: invalid claims", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract claims
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			http.Error(w, "unauthorized: missing user_id", http.StatusUnauthorized)
-			return
-		}
-
-		roleStr, ok := claims["role"].(string)
-		if !ok {
-			http.Error(w, "unauthorized: missing role", http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), ContextUserIDKey, int(userIDFloat))
-		ctx = context.WithValue(ctx, ContextRoleKey, roleStr)
-
-		fmt.Println("Auth middleware: ", int(userIDFloat), roleStr)
-
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
+			cookie, err := r.Cookie(AuthCookieName)
+			if err != nil || strings.TrimSpace(cookie.Value) == "" {
+				// http.Error(w, "unauthorized: missing auth token", http.StatusUnauthorized)
+				http.Error(w, "Login required", http.StatusUnauthorized)
+				return
+			}
+
+			tokenStr := strings.TrimSpace(cookie.Value)
+
+			token, err := jwt.Parse(tokenStr, tokens.keyFunc)
+
+			if err != nil || !token.Valid {
+				http.Error(w, "unauthorized: invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "unauthorized: invalid claims", http.StatusUnauthorized)
+				return
+			}
+
+			// Extract claims
+			userIDFloat, ok := claims["user_id"].(float64)
+			if !ok {
+				http.Error(w, "unauthorized: missing user_id", http.StatusUnauthorized)
+				return
+			}
+
+			roleStr, ok := claims["role"].(string)
+			if !ok {
+				http.Error(w, "unauthorized: missing role", http.StatusUnauthorized)
+				return
+			}
 
-// AdminOnlyMiddleware ensures the user has the "admin" role.
-func AdminOnlyMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Retrieve role from context (set by AuthMiddleware)
-		roleStr, ok := r.Context().Value(ContextRoleKey).(string)
-		fmt.Println("Admin only middleware: ", ok, roleStr)
-		if !ok || roleStr != "admin" {
-			http.Error(w, "unauthorized: insufficient role", http.StatusUnauthorized)
-			return
-		}
-
-		// If role is "admin", allow access
-		next.ServeHTTP(w, r)
-	})
+			sessionID, ok := claims["sid"].(string)
+			if !ok {
+				http.Error(w, "unauthorized: missing session", http.StatusUnauthorized)
+				return
+			}
+			if service.IsSessionRevoked(r.Context(), sessionID) {
+				http.Error(w, "unauthorized: session revoked", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ContextUserIDKey, int(userIDFloat))
+			ctx = context.WithValue(ctx, ContextRoleKey, roleStr)
+			ctx = context.WithValue(ctx, ContextSessionIDKey, sessionID)
+
+			fmt.Println("Auth middleware: ", int(userIDFloat), roleStr)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
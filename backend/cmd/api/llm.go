@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// LLMProvider generates text for the AI features. Gemini is the hosted
+// default; the OpenAI-compatible provider also covers local servers such as
+// Ollama or llama.cpp, and the stub answers offline for development and
+// tests. Without a key or provider the AI features are disabled.
+type LLMProvider interface {
+	Generate(ctx context.Context, req LLMRequest) (LLMResponse, error)
+}
+
+type LLMRequest struct {
+	Prompt      string
+	Temperature float32
+}
+
+// LLMResponse is the generated text and what it cost, as reported by the
+// provider.
+type LLMResponse struct {
+	Text  string
+	Usage LLMUsage
+}
+
+type LLMUsage struct {
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+// LLMStreamer is implemented by providers that can hand out the response
+// while it is generated. onChunk gets each piece of text in order; an error
+// from it stops the generation. The full response is returned at the end,
+// or with the error what was generated until then, so it can be paid for.
+type LLMStreamer interface {
+	GenerateStream(ctx context.Context, req LLMRequest, onChunk func(string) error) (LLMResponse, error)
+}
+
+var ErrLLMUnavailable = errors.New("AI provider unavailable")
+
+// errAIDisabled is what every call gets when no provider is configured.
+// Unlike an outage, retrying won't help.
+var errAIDisabled = fmt.Errorf("%w: AI features are disabled, set AI_API_KEY or AI_PROVIDER", ErrLLMUnavailable)
+
+// generateStream streams when the provider supports it and otherwise sends
+// the whole response as one chunk.
+func generateStream(ctx context.Context, llm LLMProvider, req LLMRequest, onChunk func(string) error) (LLMResponse, error) {
+	if s, ok := llm.(LLMStreamer); ok {
+		return s.GenerateStream(ctx, req, onChunk)
+	}
+	resp, err := llm.Generate(ctx, req)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	return resp, onChunk(resp.Text)
+}
+
+func NewLLMProvider(ctx context.Context, cfg *Config) (LLMProvider, error) {
+	switch cfg.AI_PROVIDER {
+	case "gemini":
+		return NewGeminiProvider(ctx, cfg.AI_API_KEY, cfg.AI_MODEL_NAME)
+	case "openai":
+		return NewOpenAIProvider(cfg.AI_BASE_URL, cfg.AI_API_KEY, cfg.AI_MODEL_NAME), nil
+	case "stub":
+		return StubProvider{}, nil
+	case "disabled":
+		return DisabledProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI_PROVIDER %q", cfg.AI_PROVIDER)
+	}
+}
+
+type GeminiProvider struct {
+	client *genai.Client
+	model  string
+}
+
+// NewGeminiProvider doesn't contact the API, so the server boots offline.
+func NewGeminiProvider(ctx context.Context, apiKey, model string) (*GeminiProvider, error) {
+	if apiKey == "" {
+		return nil, errors.New("AI_API_KEY is required for the gemini provider")
+	}
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &GeminiProvider{client: client, model: model}, nil
+}
+
+func (p *GeminiProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	config := &genai.GenerateContentConfig{Temperature: genai.Ptr(req.Temperature)}
+	result, err := p.client.Models.GenerateContent(ctx, p.model, genai.Text(req.Prompt), config)
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("%w: %v", ErrLLMUnavailable, err)
+	}
+	usage := LLMUsage{Model: p.model}
+	p.addUsage(&usage, result)
+	return LLMResponse{Text: result.Text(), Usage: usage}, nil
+}
+
+func (p *GeminiProvider) GenerateStream(ctx context.Context, req LLMRequest, onChunk func(string) error) (LLMResponse, error) {
+	config := &genai.GenerateContentConfig{Temperature: genai.Ptr(req.Temperature)}
+	var text strings.Builder
+	usage := LLMUsage{Model: p.model}
+	for result, err := range p.client.Models.GenerateContentStream(ctx, p.model, genai.Text(req.Prompt), config) {
+		if err != nil {
+			partial := LLMResponse{Text: text.String(), Usage: usage}
+			if ctx.Err() != nil {
+				return partial, ctx.Err()
+			}
+			return partial, fmt.Errorf("%w: %v", ErrLLMUnavailable, err)
+		}
+		// Every chunk reports the usage so far
+		p.addUsage(&usage, result)
+		chunk := result.Text()
+		if chunk == "" {
+			continue
+		}
+		text.WriteString(chunk)
+		if err := onChunk(chunk); err != nil {
+			return LLMResponse{Text: text.String(), Usage: usage}, err
+		}
+	}
+	return LLMResponse{Text: text.String(), Usage: usage}, nil
+}
+
+// addUsage takes the token counts of a response. Thinking tokens are billed
+// as output.
+func (p *GeminiProvider) addUsage(usage *LLMUsage, result *genai.GenerateContentResponse) {
+	if result.ModelVersion != "" {
+		usage.Model = result.ModelVersion
+	}
+	if m := result.UsageMetadata; m != nil {
+		usage.InputTokens = int(m.PromptTokenCount)
+		usage.OutputTokens = int(m.CandidatesTokenCount + m.ThoughtsTokenCount)
+	}
+}
+
+// OpenAIProvider calls a /chat/completions endpoint.
+type OpenAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	http    *http.Client
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		http:    &http.Client{Timeout: 2 * time.Minute}, // local models can be slow
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatUsage is the token count of a completion, sent with the response or,
+// when streaming, in a last event without choices.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (p *OpenAIProvider) usage(model string, u *chatUsage) LLMUsage {
+	usage := LLMUsage{Model: p.model}
+	if model != "" {
+		usage.Model = model
+	}
+	if u != nil {
+		usage.InputTokens = u.PromptTokens
+		usage.OutputTokens = u.CompletionTokens
+	}
+	return usage
+}
+
+func (p *OpenAIProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	resp, err := p.post(ctx, req, false)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+		Usage *chatUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return LLMResponse{}, fmt.Errorf("%w: invalid response: %v", ErrLLMUnavailable, err)
+	}
+	if len(result.Choices) == 0 {
+		return LLMResponse{}, fmt.Errorf("%w: empty response", ErrLLMUnavailable)
+	}
+	return LLMResponse{Text: result.Choices[0].Message.Content, Usage: p.usage(result.Model, result.Usage)}, nil
+}
+
+// GenerateStream reads the server-sent events of a streamed completion,
+// one "data:" line per delta, ending with "data: [DONE]".
+func (p *OpenAIProvider) GenerateStream(ctx context.Context, req LLMRequest, onChunk func(string) error) (LLMResponse, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var model string
+	var usage *chatUsage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return LLMResponse{Text: text.String(), Usage: p.usage(model, usage)}, nil
+		}
+
+		var event struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta chatMessage `json:"delta"`
+			} `json:"choices"`
+			Usage *chatUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return LLMResponse{Text: text.String(), Usage: p.usage(model, usage)}, fmt.Errorf("%w: invalid stream event: %v", ErrLLMUnavailable, err)
+		}
+		if event.Model != "" {
+			model = event.Model
+		}
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+		if len(event.Choices) == 0 || event.Choices[0].Delta.Content == "" {
+			continue
+		}
+		chunk := event.Choices[0].Delta.Content
+		text.WriteString(chunk)
+		if err := onChunk(chunk); err != nil {
+			return LLMResponse{Text: text.String(), Usage: p.usage(model, usage)}, err
+		}
+	}
+	partial := LLMResponse{Text: text.String(), Usage: p.usage(model, usage)}
+	if ctx.Err() != nil {
+		return partial, ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return partial, fmt.Errorf("%w: %v", ErrLLMUnavailable, err)
+	}
+	return partial, fmt.Errorf("%w: stream ended early", ErrLLMUnavailable)
+}
+
+// post sends the completion request and returns the response when its
+// status is OK.
+func (p *OpenAIProvider) post(ctx context.Context, req LLMRequest, stream bool) (*http.Response, error) {
+	params := map[string]any{
+		"model":       p.model,
+		"messages":    []chatMessage{{Role: "user", Content: req.Prompt}},
+		"temperature": req.Temperature,
+		"stream":      stream,
+	}
+	if stream {
+		// Without it streamed completions don't report their usage
+		params["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.http.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrLLMUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%w: %s: %s", ErrLLMUnavailable, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// DisabledProvider fails every call. Nothing is generated, so nothing
+// made up gets stored as a problem's explanation or hints.
+type DisabledProvider struct{}
+
+func (DisabledProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	return LLMResponse{}, errAIDisabled
+}
+
+// StubProvider answers without a model. The same prompt always gets the
+// same answer. Its token counts are estimates, about four characters each.
+type StubProvider struct{}
+
+func (StubProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return LLMResponse{}, err
+	}
+	sum := sha256.Sum256([]byte(req.Prompt))
+	text := fmt.Sprintf("Stub AI response %s for a %d character prompt.", hex.EncodeToString(sum[:4]), len(req.Prompt))
+	usage := LLMUsage{Model: "stub", InputTokens: (len(req.Prompt) + 3) / 4, OutputTokens: (len(text) + 3) / 4}
+	return LLMResponse{Text: text, Usage: usage}, nil
+}
+
+// GenerateStream sends the stub response a word at a time.
+func (p StubProvider) GenerateStream(ctx context.Context, req LLMRequest, onChunk func(string) error) (LLMResponse, error) {
+	resp, err := p.Generate(ctx, req)
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	var sent strings.Builder
+	for _, word := range strings.SplitAfter(resp.Text, " ") {
+		partial := LLMResponse{Text: sent.String(), Usage: resp.Usage}
+		if err := ctx.Err(); err != nil {
+			return partial, err
+		}
+		if err := onChunk(word); err != nil {
+			return partial, err
+		}
+		sent.WriteString(word)
+	}
+	return resp, nil
+}
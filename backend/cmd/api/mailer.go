@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain text emails. SMTP is for real delivery (or a local
+// stand-in such as MailHog); the file and log mailers keep messages local
+// for development.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func NewMailer(cfg *Config) (Mailer, error) {
+	switch cfg.MAILER {
+	case "", "log":
+		return LogMailer{from: cfg.MAIL_FROM}, nil
+	case "file":
+		return NewFileMailer(cfg.MAIL_DIR, cfg.MAIL_FROM)
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTP_ADDR, cfg.MAIL_FROM, cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", cfg.MAILER)
+	}
+}
+
+// formatMail renders the message in RFC 5322 form.
+func formatMail(from string, mail Mail) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mail.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// checkHeader rejects values that would let a caller inject headers.
+func checkHeader(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid mail header value %q", v)
+		}
+	}
+	return nil
+}
+
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	if err := checkHeader(mail.To, mail.Subject); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{mail.To}, formatMail(m.from, mail)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// FileMailer writes every message to dir as a .eml file.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mail dir: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, mail Mail) error {
+	if err := checkHeader(mail.To, mail.Subject); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(mail.To))
+	if err := os.WriteFile(filepath.Join(m.dir, name), formatMail(m.from, mail), 0644); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
+
+// LogMailer prints messages to the server log.
+type LogMailer struct {
+	from string
+}
+
+func (m LogMailer) Send(ctx context.Context, mail Mail) error {
+	if err := checkHeader(mail.To, mail.Subject); err != nil {
+		return err
+	}
+	log.Printf("mail from %s to %s: %s\n%s", m.from, mail.To, mail.Subject, mail.Body)
+	return nil
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"sync"
+
+	"oj-be/prompts"
 )
 
 func main() {
@@ -13,6 +16,13 @@ func main() {
 		LoadDotEnv()
 	}
 
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	cfg, err := GetConfig()
 	if err != nil {
 		log.Fatal("Error loading the config: ", err)
@@ -36,45 +46,61 @@ func main() {
 	ctx, cancel := context.WithCancel(context.TODO())
 	defer cancel()
 
-	srv := NewService(db, redisService)
+	if cfg.MIGRATE_ON_START {
+		if err := migrateUp(ctx, postgres); err != nil {
+			log.Fatalf("Error migrating the database: %v", err)
+		}
+	}
+
+	blobStore, err := NewBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("Error initializing the test data store: %v", err)
+	}
 
-	aiClient, err := NewAI(ctx, cfg.AI_API_KEY, *srv, cfg.AI_MODEL_NAME, cfg.FEEDBACK_TEMPLATE, cfg.EXPLANATION_TEMPLATE)
+	mailer, err := NewMailer(cfg)
 	if err != nil {
-		log.Fatal("Error initializing AI Client : ", err)
+		log.Fatalf("Error initializing the mailer: %v", err)
 	}
 
-	h := NewHandler(srv, redisService, aiClient)
+	srv := NewService(db, redisService, blobStore, mailer, cfg)
+
+	llm, err := NewLLMProvider(ctx, cfg)
+	if err != nil {
+		log.Fatal("Error initializing the AI provider: ", err)
+	}
+	if _, disabled := llm.(DisabledProvider); disabled {
+		log.Println("No AI provider configured, the AI features are disabled")
+	}
+	promptSet, err := prompts.Load(cfg.PROMPTS_DIR)
+	if err != nil {
+		log.Fatal("Error loading the AI prompts: ", err)
+	}
+	aiClient := NewAI(llm, srv, promptSet)
+
+	h := NewHandler(srv, redisService, aiClient, NewTokenIssuer(cfg))
 	// Set up the routes
 	r := h.Routes()
 
 	var wg sync.WaitGroup
 
 	redisService.StartResultWorker(ctx, func(er *ExecutionResponse) {
-		status, runtime, memory := "Accepted", 0, 0
-		for i, v := range er.Results {
+		status, runtime, memory := submissionStatus(er.Results), 0, 0
+		for _, v := range er.Results {
 			if v.RuntimeMS > runtime {
 				runtime = v.RuntimeMS
 			}
 			if v.MemoryKB > memory {
 				memory = v.MemoryKB
 			}
-			if v.Status != "Accepted" {
-				status = fmt.Sprintf("%s on Test Case : %d", v.Status, i+1)
-			}
 		}
 		if er.ExecutionType == EXECUTION_RUN || er.ExecutionType == EXECUTION_SUBMIT {
-			if er.ExecutionType == EXECUTION_SUBMIT {
-				for i := range er.Results {
-					er.Results[i].Input = "<hidden>"
-					er.Results[i].Output = "<hidden>"
-					er.Results[i].ExpectedOutput = "<hidden>"
-				}
-			}
+			// Keep the compiler or runtime error, for feedback; the
+			// submission hides it along with its tests if it should
 			err := srv.UpdateSubmission(ctx, &Submission{
 				ID:     er.SubmissionID,
 				Status: status,
 				// Status:  "accepted",
-				Message: "",
+				Message: judgeError(er.Results),
 				Results: er.Results,
 			})
 			if err != nil {
@@ -83,26 +109,30 @@ func main() {
 				log.Println("\n\n\nSumission updated successfully for ID : ", er.SubmissionID)
 			}
 		} else if er.ExecutionType == EXECUTION_VALIDATE {
-			log.Println("\n\n\nResponse:")
-			log.Println(er)
-			var problemStatus ProblemStatus = PROBLEM_STATUS_ACTIVE
-			for _, res := range er.Results {
-				log.Println(res.Status)
-				log.Println(res.Output)
-				if res.Status != string(SUBMISSION_STATUS_ACCEPTED) {
-					problemStatus = PROBLEM_STATUS_REJECTED
-				}
-			}
-			log.Println("Status : ", problemStatus, er.ProblemID, er.SubmissionID)
-			err := srv.UpdateProblemStatus(ctx, er.SubmissionID, problemStatus)
-			if err != nil || problemStatus != PROBLEM_STATUS_ACTIVE {
-				log.Println(err)
+			// Each validation run is one solution; the status is only set
+			// once every run of the problem's validation is back
+			problemID, problemStatus, err := srv.HandleValidationResult(ctx, er)
+			if err != nil {
+				log.Println("Error handling validation result: ", err.Error())
 				return
 			}
-			aiClient.AddProblemExplanation(er.SubmissionID)
+			log.Println("Status : ", problemStatus, problemID, er.SubmissionID)
+		} else if er.ExecutionType == EXECUTION_GENERATE || er.ExecutionType == EXECUTION_VALIDATE_INPUT ||
+			er.ExecutionType == EXECUTION_GENERATE_OUTPUT {
+			if err := srv.HandleGenerationResult(ctx, er); err != nil {
+				log.Println("Error handling test generation result: ", err.Error())
+			}
+		} else if er.ExecutionType == EXECUTION_PROPOSE_VALIDATE || er.ExecutionType == EXECUTION_PROPOSE_OUTPUT {
+			if err := srv.HandleProposalResult(ctx, er); err != nil {
+				log.Println("Error handling test proposal result: ", err.Error())
+			}
 		}
 	}, &wg)
 
+	// AI jobs run apart from the result worker so slow model calls never
+	// hold up verdicts
+	aiClient.StartJobWorkers(ctx, cfg.AI_WORKERS, &wg)
+
 	// Set up the server
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.SERVER_PORT),
@@ -1,8 +1,14 @@
 package main
 
-import "time"
+import (
+	"time"
+
+	"oj-be/plagiarism"
+)
 
 type UserRole string
+type Permission string
+type ResourceType string
 type ProblemStatus string
 type SubmissionStatus string
 type ContestStatus string
@@ -10,6 +16,18 @@ type Language string
 type Difficulty string
 type ExecutionType string
 type Vote int
+type GenerationStatus string
+type ReviewAction string
+type UserTokenPurpose string
+type SearchEntityType string
+type TokenScope string
+type AIJobKind string
+type AIJobStatus string
+type HintSource string
+type TestProposalStatus string
+type AIFeature string
+type PlagiarismCheckStatus string
+type PlagiarismReview string
 
 type User struct {
 	ID             int           `json:"ID,omitempty"`
@@ -18,9 +36,49 @@ type User struct {
 	Email          string        `json:"Email,omitempty"`
 	Role           UserRole      `json:"Role,omitempty"`
 	Rating         int           `json:"Rating,omitempty"`
+	EmailVerified  bool          `json:"EmailVerified,omitempty"`
 	SolvedProblems []ProblemInfo `json:"SolvedProblems,omitempty"`
 }
 
+// RoleGrant gives a user a role on top of their own, everywhere or only on
+// one resource.
+type RoleGrant struct {
+	ID           int
+	UserID       int
+	Role         UserRole
+	ResourceType *ResourceType `json:"ResourceType,omitempty"` // nil for a global grant
+	ResourceID   *int          `json:"ResourceID,omitempty"`
+	GrantedBy    *int          `json:"GrantedBy,omitempty"`
+	CreatedAt    time.Time
+}
+
+type UserRoles struct {
+	UserID int
+	Role   UserRole
+	Grants []RoleGrant
+}
+
+type Session struct {
+	ID         string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	Current    bool
+}
+
+type APIToken struct {
+	ID         int
+	UserID     int    `json:"-"`
+	Role       string `json:"-"`
+	Name       string
+	Scopes     []TokenScope
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+}
+
 type ProblemInfo struct {
 	ID         int
 	Title      string
@@ -38,9 +96,19 @@ type ProblemExample struct {
 }
 
 type TestCase struct {
-	ID             int
-	Input          string
-	ExpectedOutput string
+	ID                 int
+	Input              string
+	ExpectedOutput     string
+	InputHash          string   `json:"InputHash,omitempty"` // blob store reference, see BlobStore
+	ExpectedOutputHash string   `json:"ExpectedOutputHash,omitempty"`
+	Args               []string `json:"Args,omitempty"` // command-line arguments, used to run generators
+}
+
+// ProblemProgram is an author-supplied helper program such as a test
+// generator or an input validator.
+type ProblemProgram struct {
+	Language Language
+	Code     string
 }
 
 type Limits struct {
@@ -51,34 +119,288 @@ type Limits struct {
 }
 
 type ProblemDetail struct {
-	ID               int              `json:"ID,omitempty"`
-	Title            string           `json:"Title,omitempty"`
-	Description      string           `json:"Description,omitempty"`
-	Constraints      []string         `json:"Constraints,omitempty"`
-	Slug             string           `json:"Slug,omitempty"`
-	Tags             []string         `json:"Tags,omitempty"`
-	Difficulty       Difficulty       `json:"Difficulty,omitempty"`
-	AuthorID         int              `json:"AuthorId,omitempty"`
-	Status           ProblemStatus    `json:"Status,omitempty"`
-	SolutionLanguage Language         `json:"SolutionLanguage,omitempty"`
-	SolutionCode     string           `json:"SolutionCode,omitempty"`
-	Explanation      string           `json:"Explanation,omitempty"`
-	TestCases        []TestCase       `json:"TestCases,omitempty"`
-	Examples         []ProblemExample `json:"Examples,omitempty"`
-	Limits           []Limits         `json:"Limits,omitempty"`
-	FailureReason    *string          `json:"FailureReason,omitempty"`
+	ID               int               `json:"ID,omitempty"`
+	Title            string            `json:"Title,omitempty"`
+	Description      string            `json:"Description,omitempty"`
+	Constraints      []string          `json:"Constraints,omitempty"`
+	Slug             string            `json:"Slug,omitempty"`
+	Tags             []string          `json:"Tags,omitempty"`
+	Difficulty       Difficulty        `json:"Difficulty,omitempty"`
+	AuthorID         int               `json:"AuthorId,omitempty"`
+	Status           ProblemStatus     `json:"Status,omitempty"`
+	SolutionLanguage Language          `json:"SolutionLanguage,omitempty"`
+	SolutionCode     string            `json:"SolutionCode,omitempty"`
+	Generator        *ProblemProgram   `json:"Generator,omitempty"`
+	GeneratorScript  string            `json:"GeneratorScript,omitempty"` // one line of generator arguments per test
+	Validator        *ProblemProgram   `json:"Validator,omitempty"`       // reads a test input, exits non-zero if it is invalid
+	Solutions        []ProblemSolution `json:"Solutions,omitempty"`       // checked alongside SolutionCode during validation
+	Explanation      string            `json:"Explanation,omitempty"`
+	TestCases        []TestCase        `json:"TestCases,omitempty"`
+	Examples         []ProblemExample  `json:"Examples,omitempty"`
+	Limits           []Limits          `json:"Limits,omitempty"`
+	FailureReason    *string           `json:"FailureReason,omitempty"`
+	ValidationReport *ValidationReport `json:"ValidationReport,omitempty"`
 }
 
-type Submission struct {
+// ProblemSolution is an author solution with the verdicts it is expected to
+// get: [accepted] for correct ones, e.g. [wrong answer] for known-wrong ones,
+// or several verdicts when any of them will do. A solution's verdict is the
+// status of its first failing test, or accepted when none fails.
+type ProblemSolution struct {
+	ID               int `json:"ID,omitempty"`
+	Name             string
+	Language         Language
+	Code             string
+	ExpectedVerdicts []SubmissionStatus
+}
+
+type SolutionReport struct {
+	Name             string
+	Language         Language
+	ExpectedVerdicts []SubmissionStatus
+	Verdict          SubmissionStatus
+	Passed           bool
+	Results          []TestResult
+}
+
+// ValidationReport is the outcome of the last validation run of a problem.
+type ValidationReport struct {
+	ValidationID int
+	Passed       bool
+	Solutions    []SolutionReport
+}
+
+type ProblemRevision struct {
 	ID        int
-	ProblemID *int
-	UserID    int
-	ContestID *int
-	Language  Language
-	Code      string
-	Status    string
-	Message   string
-	Results   []TestResult
+	ProblemID int
+	Revision  int
+	AuthorID  *int
+	CreatedAt time.Time
+	Snapshot  *ProblemDetail `json:"Snapshot,omitempty"`
+}
+
+type RevisionChange struct {
+	Field string
+	From  any
+	To    any
+}
+
+type ProblemRevisionDiff struct {
+	ProblemID    int
+	FromRevision int
+	ToRevision   int
+	Changes      []RevisionChange
+}
+
+type ProblemReview struct {
+	ID        int
+	ProblemID int
+	UserID    *int
+	Username  string
+	Action    ReviewAction
+	Comment   string
+	Revision  int
+	CreatedAt time.Time
+}
+
+type TestGenerationJob struct {
+	ID        int
+	ProblemID int
+	CreatedBy *int
+	Status    GenerationStatus
+	Replace   bool
+	TestCount int
+	Report    []TestResult `json:"Report,omitempty"` // results of the failing stage
+	Error     *string      `json:"Error,omitempty"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type AIJob struct {
+	ID        int
+	Kind      AIJobKind
+	UserID    *int `json:"-"`
+	ProblemID int
+	Input     AIJobInput `json:"-"`
+	Status    AIJobStatus
+	Attempts  int
+	RunAt     time.Time // when a queued job is next tried
+	Result    *string   `json:"Result,omitempty"`
+	Error     *string   `json:"Error,omitempty"` // last failure, kept while retrying
+	// PromptVersion names the prompt template that produced the result
+	PromptVersion *string `json:"PromptVersion,omitempty"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// AIJobInput holds what a job needs beyond its problem.
+type AIJobInput struct {
+	Code  string `json:"code,omitempty"`
+	Count int    `json:"count,omitempty"` // test cases to propose
+}
+
+// TestProposal is a candidate test the AI provider suggested for a problem.
+type TestProposal struct {
+	ID             int
+	ProblemID      int
+	AIJobID        *int
+	Input          string
+	ExpectedOutput string `json:",omitempty"` // set once the reference solution ran
+	Rationale      string
+	Status         TestProposalStatus
+	Message        *string `json:",omitempty"`
+	PromptVersion  string  `json:",omitempty"`
+	CreatedAt      time.Time
+}
+
+// AIQuota is how many AI calls a role may make, nil for no limit.
+type AIQuota struct {
+	Role         UserRole
+	DailyLimit   *int
+	MonthlyLimit *int
+}
+
+// AIQuotaUsage is a user's AI calls in the current day or month.
+type AIQuotaUsage struct {
+	Used    int
+	Limit   *int // nil when unlimited
+	ResetAt time.Time
+}
+
+// AIUsageStatus is what a user has used of their AI quota.
+type AIUsageStatus struct {
+	Daily        AIQuotaUsage
+	Monthly      AIQuotaUsage
+	InputTokens  int // this month
+	OutputTokens int
+}
+
+// AIUsageTotals sums AI calls, in total or for one user or feature.
+type AIUsageTotals struct {
+	UserID       *int      `json:",omitempty"`
+	Username     string    `json:",omitempty"`
+	Feature      AIFeature `json:",omitempty"`
+	Calls        int
+	InputTokens  int
+	OutputTokens int
+}
+
+type AIUsageReport struct {
+	From      time.Time
+	To        time.Time
+	Total     AIUsageTotals
+	ByFeature []AIUsageTotals
+	ByUser    []AIUsageTotals
+}
+
+// PlagiarismCheck compares the submissions of a contest, see plagiarism.go.
+type PlagiarismCheck struct {
+	ID          int
+	ContestID   int
+	CreatedBy   *int // nil when the contest ending started it
+	Status      PlagiarismCheckStatus
+	Submissions int     // compared
+	Error       *string `json:"Error,omitempty"`
+	CreatedAt   time.Time
+	CompletedAt *time.Time       `json:",omitempty"`
+	Pairs       []PlagiarismPair `json:",omitempty"` // most similar first
+}
+
+// PlagiarismPair is two participants' submissions to a problem that share
+// code, with the matching line ranges of both.
+type PlagiarismPair struct {
+	ID         int
+	CheckID    int
+	ProblemID  int
+	Language   Language
+	Similarity float64 // 0 to 1
+	A, B       PlagiarismSubmission
+	Regions    []plagiarism.Region
+	Review     PlagiarismReview
+	ReviewedBy *int       `json:",omitempty"`
+	ReviewNote *string    `json:",omitempty"`
+	ReviewedAt *time.Time `json:",omitempty"`
+}
+
+type PlagiarismSubmission struct {
+	SubmissionID int
+	UserID       int
+	Username     string
+	Code         string // as it was when compared
+}
+
+// Rejudge requeued submissions after a fix, see rejudge.go. One of
+// SubmissionID, ProblemID and ContestID is its scope.
+type Rejudge struct {
+	ID           int
+	SubmissionID *int   `json:",omitempty"`
+	ProblemID    *int   `json:",omitempty"`
+	ContestID    *int   `json:",omitempty"`
+	Verdict      string `json:",omitempty"` // only submissions with it were requeued
+	RequestedBy  *int
+	Submissions  int // requeued
+	Changed      int // of the verdicts back so far
+	CreatedAt    time.Time
+	Verdicts     []VerdictChange
+}
+
+// VerdictChange is a submission's verdict before and after a rejudge.
+type VerdictChange struct {
+	ID           int
+	SubmissionID int
+	RejudgeID    *int
+	UserID       int
+	ProblemID    int
+	ContestID    *int `json:",omitempty"`
+	OldStatus    string
+	NewStatus    string
+	Changed      bool
+	CreatedAt    time.Time
+}
+
+// ContestDisqualification leaves a participant out of the standings.
+type ContestDisqualification struct {
+	ContestID      int
+	UserID         int
+	Username       string
+	Reason         string
+	DisqualifiedBy *int
+	DisqualifiedAt time.Time
+}
+
+type ProblemHint struct {
+	Level    int
+	Content  string     `json:",omitempty"` // only once revealed
+	Source   HintSource `json:",omitempty"`
+	Revealed bool
+	Penalty  int `json:",omitempty"` // points it cost in a contest
+
+	PromptVersion string `json:",omitempty"` // of a generated hint, shown to authors
+}
+
+// HintLadder is what a solver sees of a problem's hints.
+type HintLadder struct {
+	Hints     []ProblemHint
+	ContestID *int `json:",omitempty"` // the running contest the user takes part in
+	Disabled  bool // hints are off in that contest
+	Penalty   int  // points the next hint costs
+}
+
+type Submission struct {
+	ID              int
+	ProblemID       *int
+	UserID          int
+	ContestID       *int
+	Language        Language
+	Code            string
+	Status          string
+	Message         string
+	ProblemRevision int // revision of the problem the submission was judged against
+	Results         []TestResult
+	CreatedAt       time.Time
+
+	// Submissions and review runs don't show their tests, see hideTestData.
+	hideTests bool
 }
 
 type TestResult struct {
@@ -94,7 +416,8 @@ type TestResult struct {
 type ContestParticipant struct {
 	UserID         int
 	Username       string
-	Score          int
+	Score          int // after hint penalties
+	HintPenalty    int `json:",omitempty"`
 	ProblemsSolved []ContestProblem
 	RatingChange   int // for ELO system
 }
@@ -110,6 +433,7 @@ type Contest struct {
 	Status      string
 	StartTime   time.Time
 	EndTime     time.Time
+	HintPenalty *int // points a hint costs, nil when hints are off
 	Problems    []ContestProblem
 	Leaderboard []ContestParticipant
 }
@@ -199,3 +523,13 @@ type ContestSolvedProblems struct {
 	SolvedAt   int
 	ScoreDelta int
 }
+
+type SearchResult struct {
+	EntityType SearchEntityType
+	ID         int
+	Title      string
+	Slug       string `json:"Slug,omitempty"`      // problems only
+	ProblemID  int    `json:"ProblemID,omitempty"` // discussions only
+	Snippet    string // HTML escaped matched text with <mark></mark> around the hits
+	Rank       float64
+}
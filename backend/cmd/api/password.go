@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are stored as bcrypt hashes, which carry their own salt and cost.
+// Accounts created before that still hold the old "<password>_hash" format;
+// they are rehashed with bcrypt on their next successful login, as are
+// hashes made with a lower cost than bcryptCost.
+
+const (
+	bcryptCost        = 12
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything past 72 bytes
+	legacyHashSuffix  = "_hash"
+)
+
+var ErrWeakPassword = errors.New("weak password")
+
+// Compared against when the user doesn't exist, so a login takes as long
+// whether or not the username is taken.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcryptCost)
+
+func hashPassword(pw string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// verifyPassword checks the password against a stored hash and reports
+// whether the hash should be replaced with a fresh one.
+func verifyPassword(hash, pw string) (ok, rehash bool) {
+	if !isBcryptHash(hash) {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(pw+legacyHashSuffix)) == 1
+		return ok, ok
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cost < bcryptCost
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// checkPasswordStrength enforces the password policy for new passwords:
+// 8 to 72 bytes, at least one letter and one digit or symbol, and not the
+// username or email.
+func checkPasswordStrength(pw, username, email string) error {
+	if len(pw) < minPasswordLength {
+		return fmt.Errorf("%w: must be at least %d characters long", ErrWeakPassword, minPasswordLength)
+	}
+	if len(pw) > maxPasswordLength {
+		return fmt.Errorf("%w: must be at most %d bytes long", ErrWeakPassword, maxPasswordLength)
+	}
+
+	var letter, other bool
+	for _, r := range pw {
+		if unicode.IsLetter(r) {
+			letter = true
+		} else if !unicode.IsSpace(r) {
+			other = true
+		}
+	}
+	if !letter || !other {
+		return fmt.Errorf("%w: must contain a letter and a digit or symbol", ErrWeakPassword)
+	}
+
+	lower := strings.ToLower(pw)
+	if lower == strings.ToLower(username) || lower == strings.ToLower(email) {
+		return fmt.Errorf("%w: must not be your username or email", ErrWeakPassword)
+	}
+	return nil
+}
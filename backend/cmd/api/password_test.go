@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	current, err := hashPassword("correct horse 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheap, err := bcrypt.GenerateFromPassword([]byte("correct horse 1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hash       string
+		pw         string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{"bcrypt", current, "correct horse 1", true, false},
+		{"bcrypt wrong password", current, "correct horse 2", false, false},
+		{"bcrypt lower cost", string(cheap), "correct horse 1", true, true},
+		{"bcrypt lower cost wrong password", string(cheap), "wrong", false, false},
+		{"legacy", "correct horse 1" + legacyHashSuffix, "correct horse 1", true, true},
+		{"legacy wrong password", "correct horse 1" + legacyHashSuffix, "correct horse", false, false},
+		{"legacy suffix typed in", "secret" + legacyHashSuffix, "secret" + legacyHashSuffix, false, false},
+		{"legacy hash typed in", "secret" + legacyHashSuffix, "secret_hash_hash", false, false},
+		{"empty hash", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := verifyPassword(tt.hash, tt.pw)
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("verifyPassword = %v, %v, want %v, %v", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordStrength(t *testing.T) {
+	tests := []struct {
+		name    string
+		pw      string
+		wantErr bool
+	}{
+		{"letters and digits", "abcdefg1", false},
+		{"letters and symbols", "abcdefg!", false},
+		{"non-ASCII letters", "пароль-пароль", false},
+		{"72 bytes", strings.Repeat("a", 71) + "1", false},
+		{"too short", "abcdef1", true},
+		{"too long", strings.Repeat("a", 72) + "1", true},
+		{"too long in bytes", strings.Repeat("é", 36) + "1", true},
+		{"only letters", "abcdefgh", true},
+		{"only digits", "12345678", true},
+		{"letters and spaces", "abcd efgh", true},
+		{"the username", "Alice_1234", true},
+		{"the email", "ALICE@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPasswordStrength(tt.pw, "alice_1234", "alice@example.com")
+			if tt.wantErr && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("checkPasswordStrength(%q) = %v, want ErrWeakPassword", tt.pw, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("checkPasswordStrength(%q) = %v", tt.pw, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"oj-be/plagiarism"
+)
+
+// A plagiarism check compares the contest's submissions to each problem
+// with the plagiarism package and stores the suspicious pairs, most similar
+// first, for the contest managers to review. Ending a contest starts one.
+// Confirming a pair doesn't change the standings by itself, managers
+// disqualify the participants they decide copied.
+
+var (
+	ErrPlagiarismCheckNotFound = errors.New("plagiarism check not found")
+	ErrPlagiarismPairNotFound  = errors.New("plagiarism pair not found")
+	ErrInvalidPlagiarismReview = errors.New("review must be pending, confirmed or dismissed")
+	ErrParticipantNotFound     = errors.New("user is not a participant of this contest")
+)
+
+// StartPlagiarismCheck snapshots the contest's submissions and compares
+// them in the background. userID is 0 when the system starts it.
+func (s *serviceImpl) StartPlagiarismCheck(ctx context.Context, contestID, userID int) (int, error) {
+	if _, err := s.GetContestByID(ctx, contestID); err != nil {
+		return 0, err
+	}
+
+	byProblem := map[int][]plagiarism.Submission{}
+	count := 0
+	s.submissionsMu.Lock()
+	for _, sub := range s.submissions {
+		if sub.ContestID == nil || *sub.ContestID != contestID || sub.ProblemID == nil || sub.Code == "" {
+			continue
+		}
+		byProblem[*sub.ProblemID] = append(byProblem[*sub.ProblemID], plagiarism.Submission{
+			ID: sub.ID, Owner: sub.UserID, Language: string(sub.Language), Code: sub.Code,
+		})
+		count++
+	}
+	s.submissionsMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var checkID int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO plagiarism_checks (contest_id, created_by, status, submissions)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+		RETURNING id`, contestID, userID, PLAGIARISM_CHECK_RUNNING, count,
+	).Scan(&checkID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start plagiarism check: %w", err)
+	}
+
+	go s.runPlagiarismCheck(context.WithoutCancel(ctx), checkID, byProblem)
+	return checkID, nil
+}
+
+func (s *serviceImpl) runPlagiarismCheck(ctx context.Context, checkID int, byProblem map[int][]plagiarism.Submission) {
+	err := s.savePlagiarismPairs(ctx, checkID, byProblem)
+
+	status, message := PLAGIARISM_CHECK_COMPLETED, ""
+	if err != nil {
+		log.Printf("Plagiarism check %d failed: %v", checkID, err)
+		status, message = PLAGIARISM_CHECK_FAILED, err.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE plagiarism_checks
+		SET status = $2, error = NULLIF($3, ''), completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, checkID, status, message)
+	if err != nil {
+		log.Printf("Error finishing plagiarism check %d: %v", checkID, err)
+	}
+}
+
+func (s *serviceImpl) savePlagiarismPairs(ctx context.Context, checkID int, byProblem map[int][]plagiarism.Submission) error {
+	problemIDs := make([]int, 0, len(byProblem))
+	for id := range byProblem {
+		problemIDs = append(problemIDs, id)
+	}
+	slices.Sort(problemIDs)
+
+	// Comparing is the slow part, the transaction only covers the inserts
+	type pair struct {
+		problemID int
+		match     plagiarism.Match
+	}
+	var pairs []pair
+	for _, problemID := range problemIDs {
+		for _, m := range plagiarism.Compare(byProblem[problemID]) {
+			pairs = append(pairs, pair{problemID, m})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range pairs {
+		regions, err := json.Marshal(p.match.Regions)
+		if err != nil {
+			return err
+		}
+		a, b := p.match.A, p.match.B
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO plagiarism_pairs (check_id, problem_id, language, similarity,
+			                              submission_a, user_a, code_a, submission_b, user_b, code_b, regions)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			checkID, p.problemID, a.Language, p.match.Similarity,
+			a.ID, a.Owner, a.Code, b.ID, b.Owner, b.Code, regions)
+		if err != nil {
+			return fmt.Errorf("failed to save plagiarism pair: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+const plagiarismCheckColumns = `id, contest_id, created_by, status, submissions, error, created_at, completed_at`
+
+func scanPlagiarismCheck(row interface{ Scan(...any) error }) (PlagiarismCheck, error) {
+	var c PlagiarismCheck
+	err := row.Scan(&c.ID, &c.ContestID, &c.CreatedBy, &c.Status, &c.Submissions, &c.Error, &c.CreatedAt, &c.CompletedAt)
+	return c, err
+}
+
+// GetPlagiarismChecks lists the contest's checks, newest first, without
+// their pairs.
+func (s *serviceImpl) GetPlagiarismChecks(ctx context.Context, contestID int) ([]PlagiarismCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+plagiarismCheckColumns+` FROM plagiarism_checks
+		WHERE contest_id = $1 ORDER BY id DESC`, contestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plagiarism checks: %w", err)
+	}
+	defer rows.Close()
+
+	checks := []PlagiarismCheck{}
+	for rows.Next() {
+		c, err := scanPlagiarismCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+// GetPlagiarismCheck returns a check of the contest with its pairs, most
+// similar first.
+func (s *serviceImpl) GetPlagiarismCheck(ctx context.Context, contestID, checkID int) (*PlagiarismCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	c, err := scanPlagiarismCheck(s.db.QueryRowContext(ctx, `
+		SELECT `+plagiarismCheckColumns+` FROM plagiarism_checks
+		WHERE id = $1 AND contest_id = $2`, checkID, contestID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlagiarismCheckNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plagiarism check: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.problem_id, p.language, p.similarity,
+		       p.submission_a, p.user_a, ua.username, p.code_a,
+		       p.submission_b, p.user_b, ub.username, p.code_b,
+		       p.regions, p.review, p.reviewed_by, p.review_note, p.reviewed_at
+		FROM plagiarism_pairs p
+		JOIN users ua ON ua.id = p.user_a
+		JOIN users ub ON ub.id = p.user_b
+		WHERE p.check_id = $1
+		ORDER BY p.similarity DESC, p.id`, checkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plagiarism pairs: %w", err)
+	}
+	defer rows.Close()
+
+	c.Pairs = []PlagiarismPair{}
+	for rows.Next() {
+		var p PlagiarismPair
+		var regions []byte
+		err := rows.Scan(&p.ID, &p.ProblemID, &p.Language, &p.Similarity,
+			&p.A.SubmissionID, &p.A.UserID, &p.A.Username, &p.A.Code,
+			&p.B.SubmissionID, &p.B.UserID, &p.B.Username, &p.B.Code,
+			&regions, &p.Review, &p.ReviewedBy, &p.ReviewNote, &p.ReviewedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(regions, &p.Regions); err != nil {
+			return nil, err
+		}
+		p.CheckID = c.ID
+		c.Pairs = append(c.Pairs, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ReviewPlagiarismPair records a manager's verdict on a pair of the contest.
+func (s *serviceImpl) ReviewPlagiarismPair(ctx context.Context, contestID, pairID, reviewerID int, review PlagiarismReview, note string) error {
+	switch review {
+	case PLAGIARISM_REVIEW_PENDING, PLAGIARISM_REVIEW_CONFIRMED, PLAGIARISM_REVIEW_DISMISSED:
+	default:
+		return ErrInvalidPlagiarismReview
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE plagiarism_pairs p
+		SET review = $3, review_note = NULLIF($4, ''), reviewed_by = $5, reviewed_at = CURRENT_TIMESTAMP
+		FROM plagiarism_checks c
+		WHERE p.id = $1 AND c.id = p.check_id AND c.contest_id = $2`,
+		pairID, contestID, review, note, reviewerID)
+	if err != nil {
+		return fmt.Errorf("failed to review plagiarism pair: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPlagiarismPairNotFound
+	}
+	return nil
+}
+
+// DisqualifyParticipant leaves the user out of the contest's standings. Only
+// users who joined the contest can be disqualified.
+func (s *serviceImpl) DisqualifyParticipant(ctx context.Context, contestID, userID, by int, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE contest_participants
+		SET disqualified_at = CURRENT_TIMESTAMP, disqualified_by = $3, disqualified_reason = NULLIF($4, '')
+		WHERE contest_id = $1 AND user_id = $2`, contestID, userID, by, reason)
+	if err != nil {
+		return fmt.Errorf("failed to disqualify participant: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrParticipantNotFound
+	}
+	return nil
+}
+
+// ReinstateParticipant undoes a disqualification.
+func (s *serviceImpl) ReinstateParticipant(ctx context.Context, contestID, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE contest_participants
+		SET disqualified_at = NULL, disqualified_by = NULL, disqualified_reason = NULL
+		WHERE contest_id = $1 AND user_id = $2`, contestID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reinstate participant: %w", err)
+	}
+	return nil
+}
+
+func (s *serviceImpl) GetDisqualifications(ctx context.Context, contestID int) ([]ContestDisqualification, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT cp.user_id, u.username, COALESCE(cp.disqualified_reason, ''), cp.disqualified_by, cp.disqualified_at
+		FROM contest_participants cp
+		JOIN users u ON u.id = cp.user_id
+		WHERE cp.contest_id = $1 AND cp.disqualified_at IS NOT NULL
+		ORDER BY cp.disqualified_at`, contestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disqualifications: %w", err)
+	}
+	defer rows.Close()
+
+	disqualified := []ContestDisqualification{}
+	for rows.Next() {
+		d := ContestDisqualification{ContestID: contestID}
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Reason, &d.DisqualifiedBy, &d.DisqualifiedAt); err != nil {
+			return nil, err
+		}
+		disqualified = append(disqualified, d)
+	}
+	return disqualified, rows.Err()
+}
+
+// contestDisqualified returns the users left out of the standings.
+func (s *serviceImpl) contestDisqualified(ctx context.Context, contestID int) (map[int]bool, error) {
+	disqualifications, err := s.GetDisqualifications(ctx, contestID)
+	if err != nil {
+		return nil, err
+	}
+	disqualified := map[int]bool{}
+	for _, d := range disqualifications {
+		disqualified[d.UserID] = true
+	}
+	return disqualified, nil
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem packages follow the Kattis problem package layout:
+//
+//	problem.yaml
+//	problem_statement/problem.md
+//	data/sample/*.in, *.ans, *.desc   -> Examples
+//	data/secret/*.in, *.ans           -> TestCases
+//	submissions/accepted/*            -> SolutionCode, then Solutions
+//	submissions/wrong_answer/* etc.   -> Solutions expecting that verdict
+//
+// Things Kattis has no place for (slug, difficulty, per-language limits) are
+// kept under the "oj" key of problem.yaml, which other tools ignore.
+
+const (
+	packageConfigFile      = "problem.yaml"
+	packageStatementDir    = "problem_statement"
+	packageSampleDir       = "data/sample"
+	packageSecretDir       = "data/secret"
+	packageAcceptedDir     = "submissions/accepted"
+	packageConstraintsHead = "## Constraints"
+)
+
+type problemPackageConfig struct {
+	Name       string          `yaml:"name"`
+	Author     string          `yaml:"author,omitempty"`
+	Source     string          `yaml:"source,omitempty"`
+	Keywords   packageKeywords `yaml:"keywords,omitempty"`
+	Validation string          `yaml:"validation,omitempty"`
+	Limits     struct {
+		TimeLimit float64 `yaml:"time_limit,omitempty"` // seconds
+		Memory    int     `yaml:"memory,omitempty"`     // MiB
+	} `yaml:"limits,omitempty"`
+	OJ *problemPackageExtension `yaml:"oj,omitempty"`
+}
+
+type problemPackageExtension struct {
+	Slug       string                `yaml:"slug,omitempty"`
+	Difficulty Difficulty            `yaml:"difficulty,omitempty"`
+	Limits     []problemPackageLimit `yaml:"limits,omitempty"`
+}
+
+type problemPackageLimit struct {
+	Language      Language `yaml:"language"`
+	TimeLimitMS   int      `yaml:"time_limit_ms"`
+	MemoryLimitKB int      `yaml:"memory_limit_kb"`
+}
+
+// packageKeywords accepts both a YAML list and the older space separated string.
+type packageKeywords []string
+
+func (k *packageKeywords) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*k = strings.Fields(node.Value)
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*k = list
+	return nil
+}
+
+var allLanguages = []Language{LANGUAGE_GO, LANGUAGE_PYTHON, LANGUAGE_CPP, LANGUAGE_JAVA, LANGUAGE_C}
+
+var packageSolutionLanguages = map[string]Language{
+	".py":   LANGUAGE_PYTHON,
+	".cpp":  LANGUAGE_CPP,
+	".cc":   LANGUAGE_CPP,
+	".java": LANGUAGE_JAVA,
+	".c":    LANGUAGE_C,
+	".go":   LANGUAGE_GO,
+}
+
+// Kattis submission directories and the verdict their solutions must get.
+// Solutions expecting several verdicts, or verdicts Kattis has no directory
+// for, are left out of exported packages.
+var packageSubmissionDirs = []struct {
+	dir     string
+	verdict SubmissionStatus
+}{
+	{packageAcceptedDir, SUBMISSION_STATUS_ACCEPTED},
+	{"submissions/wrong_answer", SUBMISSION_STATUS_WRONG_ANSWER},
+	{"submissions/time_limit_exceeded", SUBMISSION_STATUS_TLE},
+	{"submissions/run_time_error", SUBMISSION_STATUS_RUNTIME_ERROR},
+}
+
+var packageSolutionFiles = map[Language]string{
+	LANGUAGE_PYTHON: "solution.py",
+	LANGUAGE_CPP:    "solution.cpp",
+	LANGUAGE_JAVA:   "Main.java",
+	LANGUAGE_C:      "solution.c",
+	LANGUAGE_GO:     "solution.go",
+}
+
+var errUnzippedTooLarge = errors.New("archive is too large once unzipped")
+
+// unzipBudget reads the files of an archive up to a total size. The request
+// size limit only applies to the compressed archive.
+type unzipBudget struct {
+	left int64
+}
+
+func (b *unzipBudget) read(f *zip.File) (string, error) {
+	// The size in the header is checked first, but it's only trusted as far
+	// as the reader stops there
+	if f.UncompressedSize64 > uint64(b.left) {
+		return "", fmt.Errorf("%s: %w", f.Name, errUnzippedTooLarge)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, b.left+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if int64(len(data)) > b.left {
+		return "", fmt.Errorf("%s: %w", f.Name, errUnzippedTooLarge)
+	}
+	b.left -= int64(len(data))
+	return string(data), nil
+}
+
+// parseProblemPackage maps a zipped problem package onto a ProblemDetail.
+// The package may be wrapped in a single top-level directory.
+func parseProblemPackage(data []byte) (*ProblemDetail, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File)
+	root := ""
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files[f.Name] = f
+		if path.Base(f.Name) == packageConfigFile && (root == "" || len(f.Name) < len(root)+len(packageConfigFile)) {
+			root = strings.TrimSuffix(f.Name, packageConfigFile)
+		}
+	}
+	if _, ok := files[root+packageConfigFile]; !ok {
+		return nil, errors.New("package is missing problem.yaml")
+	}
+
+	budget := unzipBudget{left: maxUnzippedPackage}
+	read := func(name string) (string, error) {
+		return budget.read(files[name])
+	}
+
+	// list returns the package files under dir, relative to it and sorted.
+	list := func(dir string) []string {
+		prefix := root + dir + "/"
+		var names []string
+		for name := range files {
+			if strings.HasPrefix(name, prefix) && !strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+				names = append(names, strings.TrimPrefix(name, prefix))
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	rawConfig, err := read(root + packageConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var cfg problemPackageConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid problem.yaml: %w", err)
+	}
+	if strings.TrimSpace(cfg.Name) == "" {
+		return nil, errors.New("problem.yaml: name is required")
+	}
+	if cfg.Validation != "" && cfg.Validation != "default" {
+		return nil, fmt.Errorf("problem.yaml: validation %q is not supported, only exact output comparison is", cfg.Validation)
+	}
+
+	problem := &ProblemDetail{
+		Title:      cfg.Name,
+		Slug:       CreateSlug(cfg.Name),
+		Tags:       cfg.Keywords,
+		Difficulty: DIFFICULTY_MEDIUM,
+	}
+
+	// Statement
+	for _, name := range []string{"problem.md", "problem.en.md", "problem.en.tex", "problem.tex"} {
+		if _, ok := files[root+packageStatementDir+"/"+name]; !ok {
+			continue
+		}
+		statement, err := read(root + packageStatementDir + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		problem.Description, problem.Constraints = splitPackageStatement(statement)
+		break
+	}
+	if problem.Description == "" {
+		return nil, errors.New("package is missing problem_statement/problem.md")
+	}
+
+	// Samples become examples, secret data becomes the judged test cases
+	for _, name := range list(packageSampleDir) {
+		if !strings.HasSuffix(name, ".in") {
+			continue
+		}
+		base := root + packageSampleDir + "/" + strings.TrimSuffix(name, ".in")
+		input, expected, err := readPackageTest(files, read, base)
+		if err != nil {
+			return nil, err
+		}
+		example := ProblemExample{Input: input, ExpectedOutput: expected}
+		if _, ok := files[base+".desc"]; ok {
+			if example.Explanation, err = read(base + ".desc"); err != nil {
+				return nil, err
+			}
+		}
+		problem.Examples = append(problem.Examples, example)
+	}
+	for _, name := range list(packageSecretDir) {
+		if !strings.HasSuffix(name, ".in") {
+			continue
+		}
+		input, expected, err := readPackageTest(files, read, root+packageSecretDir+"/"+strings.TrimSuffix(name, ".in"))
+		if err != nil {
+			return nil, err
+		}
+		problem.TestCases = append(problem.TestCases, TestCase{Input: input, ExpectedOutput: expected})
+	}
+	if len(problem.TestCases) == 0 {
+		return nil, errors.New("package has no test data in data/secret")
+	}
+
+	// The first accepted submission is the reference solution, the rest are
+	// checked against their directory's verdict during validation
+	for _, sub := range packageSubmissionDirs {
+		for _, name := range list(sub.dir) {
+			language, ok := packageSolutionLanguages[path.Ext(name)]
+			if !ok {
+				continue
+			}
+			code, err := read(root + sub.dir + "/" + name)
+			if err != nil {
+				return nil, err
+			}
+			if problem.SolutionCode == "" && sub.verdict == SUBMISSION_STATUS_ACCEPTED {
+				problem.SolutionCode, problem.SolutionLanguage = code, language
+				continue
+			}
+			problem.Solutions = append(problem.Solutions, ProblemSolution{
+				Name:             strings.TrimPrefix(sub.dir, "submissions/") + "/" + name,
+				Language:         language,
+				Code:             code,
+				ExpectedVerdicts: []SubmissionStatus{sub.verdict},
+			})
+		}
+	}
+	if problem.SolutionCode == "" {
+		return nil, errors.New("package has no supported solution in submissions/accepted")
+	}
+
+	// Limits: a Kattis limit applies to every language unless the oj
+	// extension lists them per language.
+	if cfg.Limits.TimeLimit > 0 || cfg.Limits.Memory > 0 {
+		timeLimitMS, memoryLimitKB := defaultTimeLimitMS, defaultMemoryLimitKB
+		if cfg.Limits.TimeLimit > 0 {
+			timeLimitMS = int(cfg.Limits.TimeLimit * 1000)
+		}
+		if cfg.Limits.Memory > 0 {
+			memoryLimitKB = cfg.Limits.Memory * 1024
+		}
+		for _, lang := range allLanguages {
+			problem.Limits = append(problem.Limits, Limits{Language: lang, TimeLimitMS: timeLimitMS, MemoryLimitKB: memoryLimitKB})
+		}
+	}
+
+	if cfg.OJ != nil {
+		if cfg.OJ.Slug != "" {
+			problem.Slug = cfg.OJ.Slug
+		}
+		if cfg.OJ.Difficulty != "" {
+			problem.Difficulty = cfg.OJ.Difficulty
+		}
+		if len(cfg.OJ.Limits) > 0 {
+			problem.Limits = nil
+			for _, l := range cfg.OJ.Limits {
+				problem.Limits = append(problem.Limits, Limits{Language: l.Language, TimeLimitMS: l.TimeLimitMS, MemoryLimitKB: l.MemoryLimitKB})
+			}
+		}
+	}
+
+	return problem, nil
+}
+
+func readPackageTest(files map[string]*zip.File, read func(string) (string, error), base string) (string, string, error) {
+	if _, ok := files[base+".ans"]; !ok {
+		return "", "", fmt.Errorf("%s.in has no matching .ans file", base)
+	}
+	input, err := read(base + ".in")
+	if err != nil {
+		return "", "", err
+	}
+	expected, err := read(base + ".ans")
+	if err != nil {
+		return "", "", err
+	}
+	return input, expected, nil
+}
+
+// splitPackageStatement separates a trailing "## Constraints" bullet list
+// from the rest of the statement.
+func splitPackageStatement(statement string) (string, []string) {
+	description, rest, found := strings.Cut(statement, packageConstraintsHead)
+	if !found {
+		return strings.TrimSpace(statement), nil
+	}
+
+	var constraints []string
+	for _, line := range strings.Split(rest, "\n") {
+		line = strings.TrimSpace(line)
+		if c, ok := strings.CutPrefix(line, "- "); ok {
+			constraints = append(constraints, c)
+		}
+	}
+	return strings.TrimSpace(description), constraints
+}
+
+// buildProblemPackage writes a problem out in the same layout
+// parseProblemPackage reads.
+func buildProblemPackage(problem *ProblemDetail) ([]byte, error) {
+	cfg := problemPackageConfig{
+		Name:     problem.Title,
+		Keywords: problem.Tags,
+		OJ: &problemPackageExtension{
+			Slug:       problem.Slug,
+			Difficulty: problem.Difficulty,
+		},
+	}
+	for _, l := range problem.Limits {
+		cfg.OJ.Limits = append(cfg.OJ.Limits, problemPackageLimit{Language: l.Language, TimeLimitMS: l.TimeLimitMS, MemoryLimitKB: l.MemoryLimitKB})
+		// Other judges only understand a single limit; export the solution language's.
+		if l.Language == problem.SolutionLanguage {
+			cfg.Limits.TimeLimit = float64(l.TimeLimitMS) / 1000
+			cfg.Limits.Memory = l.MemoryLimitKB / 1024
+		}
+	}
+
+	rawConfig, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode problem.yaml: %w", err)
+	}
+
+	statement := problem.Description + "\n"
+	if len(problem.Constraints) > 0 {
+		statement += "\n" + packageConstraintsHead + "\n\n"
+		for _, c := range problem.Constraints {
+			statement += "- " + c + "\n"
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		_, err = io.WriteString(w, content)
+		return err
+	}
+
+	if err := write(packageConfigFile, string(rawConfig)); err != nil {
+		return nil, err
+	}
+	if err := write(packageStatementDir+"/problem.md", statement); err != nil {
+		return nil, err
+	}
+	for i, ex := range problem.Examples {
+		base := fmt.Sprintf("%s/%03d", packageSampleDir, i+1)
+		if err := write(base+".in", ex.Input); err != nil {
+			return nil, err
+		}
+		if err := write(base+".ans", ex.ExpectedOutput); err != nil {
+			return nil, err
+		}
+		if ex.Explanation != "" {
+			if err := write(base+".desc", ex.Explanation); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, tc := range problem.TestCases {
+		base := fmt.Sprintf("%s/%03d", packageSecretDir, i+1)
+		if err := write(base+".in", tc.Input); err != nil {
+			return nil, err
+		}
+		if err := write(base+".ans", tc.ExpectedOutput); err != nil {
+			return nil, err
+		}
+	}
+	written := make(map[string]bool)
+	if file, ok := packageSolutionFiles[problem.SolutionLanguage]; ok && problem.SolutionCode != "" {
+		if err := write(packageAcceptedDir+"/"+file, problem.SolutionCode); err != nil {
+			return nil, err
+		}
+		written[packageAcceptedDir+"/"+file] = true
+	}
+	for _, sol := range problem.Solutions {
+		name := packageSolutionPath(sol)
+		if name == "" || written[name] {
+			continue
+		}
+		if err := write(name, sol.Code); err != nil {
+			return nil, err
+		}
+		written[name] = true
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize package: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// packageSolutionPath returns where a solution goes in a package, or "" when
+// the package layout has no place for it.
+func packageSolutionPath(sol ProblemSolution) string {
+	if len(sol.ExpectedVerdicts) != 1 {
+		return ""
+	}
+	for _, sub := range packageSubmissionDirs {
+		if sub.verdict != sol.ExpectedVerdicts[0] {
+			continue
+		}
+		name := path.Base(sol.Name)
+		if packageSolutionLanguages[path.Ext(name)] != sol.Language {
+			file, ok := packageSolutionFiles[sol.Language]
+			if !ok {
+				return ""
+			}
+			name = strings.TrimSuffix(name, path.Ext(name)) + path.Ext(file)
+		}
+		return sub.dir + "/" + name
+	}
+	return ""
+}
+
+// parseTestArchive reads a zip of NAME.in files paired with NAME.ans (or
+// NAME.out) files, in any directory, ordered by name.
+func parseTestArchive(data []byte) ([]TestCase, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File)
+	var inputs []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files[f.Name] = f
+		if strings.HasSuffix(f.Name, ".in") {
+			inputs = append(inputs, strings.TrimSuffix(f.Name, ".in"))
+		}
+	}
+	sort.Strings(inputs)
+
+	budget := unzipBudget{left: maxUnzippedTests}
+	read := budget.read
+
+	var testCases []TestCase
+	for _, base := range inputs {
+		out, ok := files[base+".ans"]
+		if !ok {
+			if out, ok = files[base+".out"]; !ok {
+				return nil, fmt.Errorf("%s.in has no matching .ans or .out file", base)
+			}
+		}
+
+		input, err := read(files[base+".in"])
+		if err != nil {
+			return nil, err
+		}
+		expected, err := read(out)
+		if err != nil {
+			return nil, err
+		}
+		testCases = append(testCases, TestCase{Input: input, ExpectedOutput: expected})
+	}
+
+	if len(testCases) == 0 {
+		return nil, errors.New("archive has no .in files")
+	}
+	return testCases, nil
+}
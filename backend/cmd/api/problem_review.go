@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Problems pass through a human review before going live. Setters own the
+// problems they create (and co-setters are granted the role on a problem);
+// once a problem passes validation its setter submits it for review, testers
+// try it against the hidden tests, and a reviewer either approves it (it
+// becomes active) or requests changes. Editing a problem sends it back to
+// draft, so it has to be revalidated and resubmitted.
+
+var ErrProblemForbidden = errors.New("unauthorized: no access to this problem")
+
+// ProblemOwnership is what the access checks need to know about a problem.
+type ProblemOwnership struct {
+	ID       int
+	AuthorID *int
+	Status   ProblemStatus
+}
+
+func (p *ProblemOwnership) isAuthor(userID int) bool {
+	return p.AuthorID != nil && *p.AuthorID == userID
+}
+
+// canViewProblem: whoever may edit the problem, its author, and testers and
+// reviewers once it is in review.
+func canViewProblem(p *ProblemOwnership, userID int, perms *Permissions) bool {
+	switch {
+	case canEditProblem(p, userID, perms), p.isAuthor(userID):
+		return true
+	case perms.HasOn(PERMISSION_PROBLEM_TEST, RESOURCE_PROBLEM, p.ID),
+		perms.HasOn(PERMISSION_PROBLEM_REVIEW, RESOURCE_PROBLEM, p.ID):
+		return p.Status == PROBLEM_STATUS_IN_REVIEW
+	}
+	return false
+}
+
+// canEditProblem: problem managers, the problem's setter and co-setters.
+func canEditProblem(p *ProblemOwnership, userID int, perms *Permissions) bool {
+	return perms.Has(PERMISSION_PROBLEM_MANAGE) ||
+		perms.hasScoped(PERMISSION_PROBLEM_AUTHOR, RESOURCE_PROBLEM, p.ID) ||
+		(perms.Has(PERMISSION_PROBLEM_AUTHOR) && p.isAuthor(userID))
+}
+
+func (s *serviceImpl) GetProblemOwnership(ctx context.Context, problemID int) (*ProblemOwnership, error) {
+	return s.getProblemOwnership(ctx, `id = $1`, problemID)
+}
+
+func (s *serviceImpl) GetProblemOwnershipBySlug(ctx context.Context, slug string) (*ProblemOwnership, error) {
+	return s.getProblemOwnership(ctx, `slug = $1`, slug)
+}
+
+func (s *serviceImpl) getProblemOwnership(ctx context.Context, where string, arg any) (*ProblemOwnership, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var p ProblemOwnership
+	err := s.db.QueryRowContext(ctx, `SELECT id, author_id, status FROM problems WHERE `+where, arg).
+		Scan(&p.ID, &p.AuthorID, &p.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("problem not found")
+		}
+		return nil, fmt.Errorf("failed to get problem: %w", err)
+	}
+	return &p, nil
+}
+
+// SubmitProblemForReview hands a validated problem over to the reviewers.
+func (s *serviceImpl) SubmitProblemForReview(ctx context.Context, problemID, userID int, comment string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status ProblemStatus
+	var revision int
+	err = tx.QueryRowContext(ctx, `SELECT status, current_revision FROM problems WHERE id = $1 FOR UPDATE`, problemID).
+		Scan(&status, &revision)
+	if err != nil {
+		return fmt.Errorf("failed to get problem: %w", err)
+	}
+	if status != PROBLEM_STATUS_VALIDATED {
+		return fmt.Errorf("only validated problems can be submitted for review, this one is %s", status)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE problems SET status = $2 WHERE id = $1`, problemID, PROBLEM_STATUS_IN_REVIEW); err != nil {
+		return fmt.Errorf("failed to update problem status: %w", err)
+	}
+	if err := insertProblemReview(ctx, tx, problemID, userID, REVIEW_ACTION_SUBMITTED, comment, revision); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ReviewProblem records a comment or a reviewer decision and returns the
+// problem's resulting status.
+func (s *serviceImpl) ReviewProblem(ctx context.Context, problemID, userID int, perms *Permissions, action ReviewAction, comment string) (ProblemStatus, error) {
+	comment = strings.TrimSpace(comment)
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var p ProblemOwnership
+	var revision int
+	err = tx.QueryRowContext(ctx, `SELECT id, author_id, status, current_revision FROM problems WHERE id = $1 FOR UPDATE`, problemID).
+		Scan(&p.ID, &p.AuthorID, &p.Status, &revision)
+	if err != nil {
+		return "", fmt.Errorf("failed to get problem: %w", err)
+	}
+
+	status := p.Status
+	switch action {
+	case REVIEW_ACTION_COMMENT:
+		if comment == "" {
+			return "", errors.New("comment is required")
+		}
+	case REVIEW_ACTION_APPROVED, REVIEW_ACTION_CHANGES_REQUESTED:
+		if !perms.HasOn(PERMISSION_PROBLEM_REVIEW, RESOURCE_PROBLEM, problemID) {
+			return "", ErrProblemForbidden
+		}
+		if !perms.Has(PERMISSION_PROBLEM_MANAGE) && p.isAuthor(userID) {
+			return "", errors.New("reviewers can't review their own problems")
+		}
+		if p.Status != PROBLEM_STATUS_IN_REVIEW {
+			return "", fmt.Errorf("problem is %s, not in review", p.Status)
+		}
+		status = PROBLEM_STATUS_ACTIVE
+		if action == REVIEW_ACTION_CHANGES_REQUESTED {
+			if comment == "" {
+				return "", errors.New("a comment explaining the requested changes is required")
+			}
+			status = PROBLEM_STATUS_CHANGES_REQUESTED
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE problems SET status = $2 WHERE id = $1`, problemID, status); err != nil {
+			return "", fmt.Errorf("failed to update problem status: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unknown review action %q", action)
+	}
+
+	if err := insertProblemReview(ctx, tx, problemID, userID, action, comment, revision); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return status, nil
+}
+
+func insertProblemReview(ctx context.Context, tx *sql.Tx, problemID, userID int, action ReviewAction, comment string, revision int) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO problem_reviews (problem_id, user_id, action, comment, revision)
+		VALUES ($1, $2, $3, $4, $5)`, problemID, userID, action, comment, revision)
+	if err != nil {
+		return fmt.Errorf("failed to record review: %w", err)
+	}
+	return nil
+}
+
+func (s *serviceImpl) GetProblemReviews(ctx context.Context, problemID int) ([]ProblemReview, error) {
+	const query = `
+		SELECT r.id, r.problem_id, r.user_id, COALESCE(u.username, ''), r.action,
+		       r.comment, r.revision, r.created_at
+		FROM problem_reviews r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.problem_id = $1
+		ORDER BY r.id;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := []ProblemReview{}
+	for rows.Next() {
+		var r ProblemReview
+		if err := rows.Scan(&r.ID, &r.ProblemID, &r.UserID, &r.Username, &r.Action,
+			&r.Comment, &r.Revision, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// TestProblem runs a tester's solution against all of the problem's tests,
+// hidden ones included. The result is fetched like any other run, with the
+// test data hidden as for a submission.
+func (s *serviceImpl) TestProblem(ctx context.Context, userID, problemID int, language Language, code string) (int, error) {
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return 0, err
+	}
+	return s.runCode(ctx, userID, problemID, language, code, executionTestCases(problem.TestCases), true)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Validation runs the reference solution and every extra author solution
+// against the problem's tests. Each run is a row in problem_validation_runs;
+// once all runs of the latest validation are back the problem is validated
+// (ready for review) if every solution got one of its expected verdicts, and
+// rejected otherwise.
+
+// Verdicts a solution can be expected to get
+var solutionVerdicts = map[SubmissionStatus]bool{
+	SUBMISSION_STATUS_ACCEPTED:          true,
+	SUBMISSION_STATUS_WRONG_ANSWER:      true,
+	SUBMISSION_STATUS_TLE:               true,
+	SUBMISSION_STATUS_MLE:               true,
+	SUBMISSION_STATUS_COMPILATION_ERROR: true,
+	SUBMISSION_STATUS_RUNTIME_ERROR:     true,
+}
+
+func checkProblemSolution(sol ProblemSolution) error {
+	if strings.TrimSpace(sol.Name) == "" {
+		return errors.New("solution name is required")
+	}
+	if strings.TrimSpace(sol.Code) == "" {
+		return fmt.Errorf("solution %q has no code", sol.Name)
+	}
+	if len(sol.ExpectedVerdicts) == 0 {
+		return fmt.Errorf("solution %q has no expected verdicts", sol.Name)
+	}
+	for _, v := range sol.ExpectedVerdicts {
+		if !solutionVerdicts[v] {
+			return fmt.Errorf("solution %q: unknown verdict %q", sol.Name, v)
+		}
+	}
+	return nil
+}
+
+func toSubmissionStatuses(values []string) []SubmissionStatus {
+	statuses := make([]SubmissionStatus, len(values))
+	for i, v := range values {
+		statuses[i] = SubmissionStatus(v)
+	}
+	return statuses
+}
+
+func fromSubmissionStatuses(statuses []SubmissionStatus) []string {
+	values := make([]string, len(statuses))
+	for i, s := range statuses {
+		values[i] = string(s)
+	}
+	return values
+}
+
+// solutionVerdict is the status of the first failing test, or accepted.
+func solutionVerdict(results []TestResult) SubmissionStatus {
+	for _, res := range results {
+		if res.Status != string(SUBMISSION_STATUS_ACCEPTED) {
+			return SubmissionStatus(res.Status)
+		}
+	}
+	return SUBMISSION_STATUS_ACCEPTED
+}
+
+// problemLimits returns the problem's limits for a language, falling back to
+// the defaults when it has none.
+func problemLimits(problem *ProblemDetail, language Language) (int, int) {
+	for _, limit := range problem.Limits {
+		if limit.Language == language {
+			return limit.TimeLimitMS, limit.MemoryLimitKB
+		}
+	}
+	return defaultTimeLimitMS, defaultMemoryLimitKB
+}
+
+// trimTestResults copies results with their data cut down to report size.
+func trimTestResults(results []TestResult) []TestResult {
+	trimmed := make([]TestResult, len(results))
+	for i, res := range results {
+		res.Input = truncate(res.Input, maxReportDataLen)
+		res.Output = truncate(res.Output, maxReportDataLen)
+		res.ExpectedOutput = truncate(res.ExpectedOutput, maxReportDataLen)
+		trimmed[i] = res
+	}
+	return trimmed
+}
+
+func (s *serviceImpl) validateCode(ctx context.Context, slug string) error {
+	problem, err := s.AdminGetProblemBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	solutions := append([]ProblemSolution{{
+		Name:             "reference",
+		Language:         problem.SolutionLanguage,
+		Code:             problem.SolutionCode,
+		ExpectedVerdicts: []SubmissionStatus{SUBMISSION_STATUS_ACCEPTED},
+	}}, problem.Solutions...)
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Starting a new validation supersedes any runs still in flight
+	var validationID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE problems SET validation_count = validation_count + 1
+		WHERE id = $1 RETURNING validation_count`, problem.ID,
+	).Scan(&validationID)
+	if err != nil {
+		return fmt.Errorf("failed to start validation: %w", err)
+	}
+
+	runIDs := make([]int, len(solutions))
+	for i, sol := range solutions {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO problem_validation_runs (problem_id, validation_id, solution_name, language, expected_verdicts)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			problem.ID, validationID, sol.Name, sol.Language, pq.Array(fromSubmissionStatuses(sol.ExpectedVerdicts)),
+		).Scan(&runIDs[i])
+		if err != nil {
+			return fmt.Errorf("failed to record validation run: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	testCases := executionTestCases(problem.TestCases)
+	for i, sol := range solutions {
+		timeLimitMS, memoryLimitKB := problemLimits(problem, sol.Language)
+		payload := ExecutionPayload{
+			ID:            runIDs[i],
+			Language:      sol.Language,
+			Code:          sol.Code,
+			TestCases:     testCases,
+			TimeLimitMS:   timeLimitMS,
+			MemoryLimitKB: memoryLimitKB,
+			ExecutionType: EXECUTION_VALIDATE,
+			ContestID:     0,
+			ProblemID:     problem.ID,
+		}
+		if err := s.redis.ExecuteCode(ctx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleValidationResult records one validation run. When it completes the
+// problem's latest validation, the problem's status and report are updated
+// and the new status is returned; otherwise the status is empty.
+func (s *serviceImpl) HandleValidationResult(ctx context.Context, er *ExecutionResponse) (int, ProblemStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	results, err := json.Marshal(trimTestResults(er.Results))
+	if err != nil {
+		return 0, "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var problemID, validationID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE problem_validation_runs SET verdict = $2, results = $3
+		WHERE id = $1 RETURNING problem_id, validation_id`,
+		er.SubmissionID, solutionVerdict(er.Results), string(results),
+	).Scan(&problemID, &validationID)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to record validation run %d: %w", er.SubmissionID, err)
+	}
+
+	// Lock the problem so the last of several concurrent results settles it
+	var latest int
+	err = tx.QueryRowContext(ctx, `SELECT validation_count FROM problems WHERE id = $1 FOR UPDATE`, problemID).Scan(&latest)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get problem: %w", err)
+	}
+	if latest != validationID {
+		return problemID, "", tx.Commit()
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT solution_name, language, expected_verdicts, verdict, results
+		FROM problem_validation_runs
+		WHERE problem_id = $1 AND validation_id = $2
+		ORDER BY id`, problemID, validationID)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get validation runs: %w", err)
+	}
+
+	report := ValidationReport{ValidationID: validationID, Passed: true}
+	var failures []string
+	for rows.Next() {
+		var sr SolutionReport
+		var expected []string
+		var verdict *string
+		var runResults []byte
+		if err := rows.Scan(&sr.Name, &sr.Language, pq.Array(&expected), &verdict, &runResults); err != nil {
+			rows.Close()
+			return 0, "", fmt.Errorf("failed to scan validation run: %w", err)
+		}
+		if verdict == nil {
+			// Other runs of this validation are still going
+			rows.Close()
+			return problemID, "", tx.Commit()
+		}
+		if err := json.Unmarshal(runResults, &sr.Results); err != nil {
+			rows.Close()
+			return 0, "", fmt.Errorf("failed to decode validation run: %w", err)
+		}
+
+		sr.ExpectedVerdicts = toSubmissionStatuses(expected)
+		sr.Verdict = SubmissionStatus(*verdict)
+		sr.Passed = slices.Contains(sr.ExpectedVerdicts, sr.Verdict)
+		if !sr.Passed {
+			report.Passed = false
+			failures = append(failures, solutionFailure(sr))
+		}
+		report.Solutions = append(report.Solutions, sr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	status := PROBLEM_STATUS_VALIDATED
+	var failureReason *string
+	if !report.Passed {
+		status = PROBLEM_STATUS_REJECTED
+		reason := strings.Join(failures, "; ")
+		failureReason = &reason
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return 0, "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE problems SET status = $2, validation_report = $3, failure_reason = $4
+		WHERE id = $1`, problemID, status, string(data), failureReason)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to update problem status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return problemID, status, nil
+}
+
+func solutionFailure(sr SolutionReport) string {
+	expected := string(sr.ExpectedVerdicts[0])
+	if len(sr.ExpectedVerdicts) > 1 {
+		expected = "any of " + strings.Join(fromSubmissionStatuses(sr.ExpectedVerdicts), ", ")
+	}
+	if sr.Verdict == SUBMISSION_STATUS_ACCEPTED {
+		return fmt.Sprintf("tests don't catch solution %q (expected %s)", sr.Name, expected)
+	}
+	return fmt.Sprintf("solution %q got %s, expected %s", sr.Name, sr.Verdict, expected)
+}
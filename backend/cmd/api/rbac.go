@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Access control is permission based. Every user has one global role
+// (users.role) and may hold extra role grants, either global or scoped to a
+// single resource, e.g. contest_manager of contest 12. A scoped grant gives
+// the role's permissions on that resource only.
+//
+// A user's permissions are resolved once per request from a short-lived
+// Redis cache and are dropped from it whenever their roles change.
+
+const permissionsCacheTTL = 5 * time.Minute
+
+var rolePermissions = map[UserRole][]Permission{
+	ROLE_USER:            {},
+	ROLE_PROBLEM_SETTER:  {PERMISSION_PROBLEM_AUTHOR},
+	ROLE_TESTER:          {PERMISSION_PROBLEM_TEST},
+	ROLE_REVIEWER:        {PERMISSION_PROBLEM_REVIEW},
+	ROLE_CONTEST_MANAGER: {PERMISSION_CONTEST_MANAGE},
+	ROLE_MODERATOR:       {PERMISSION_DISCUSSION_MODERATE},
+	ROLE_ADMIN: {
+		PERMISSION_PROBLEM_AUTHOR, PERMISSION_PROBLEM_TEST, PERMISSION_PROBLEM_REVIEW,
+		PERMISSION_PROBLEM_MANAGE, PERMISSION_CONTEST_MANAGE, PERMISSION_DISCUSSION_MODERATE,
+		PERMISSION_USER_MANAGE,
+	},
+}
+
+// Resources a role can be granted on
+var grantableResources = map[UserRole][]ResourceType{
+	ROLE_PROBLEM_SETTER:  {RESOURCE_PROBLEM},
+	ROLE_TESTER:          {RESOURCE_PROBLEM},
+	ROLE_REVIEWER:        {RESOURCE_PROBLEM},
+	ROLE_CONTEST_MANAGER: {RESOURCE_CONTEST},
+}
+
+// Permissions is what a user may do, globally and per resource.
+type Permissions struct {
+	Global    []Permission
+	Resources map[string][]Permission // keyed by resourceKey
+}
+
+func resourceKey(resourceType ResourceType, id int) string {
+	return fmt.Sprintf("%s:%d", resourceType, id)
+}
+
+func (p *Permissions) Has(perm Permission) bool {
+	return p != nil && slices.Contains(p.Global, perm)
+}
+
+// HasOn reports whether the permission is held globally or on the resource.
+func (p *Permissions) HasOn(perm Permission, resourceType ResourceType, id int) bool {
+	return p.Has(perm) || p.hasScoped(perm, resourceType, id)
+}
+
+func (p *Permissions) hasScoped(perm Permission, resourceType ResourceType, id int) bool {
+	return p != nil && slices.Contains(p.Resources[resourceKey(resourceType, id)], perm)
+}
+
+// ScopedIDs lists the resources of a type on which the permission was
+// granted specifically.
+func (p *Permissions) ScopedIDs(perm Permission, resourceType ResourceType) []int64 {
+	ids := []int64{}
+	if p == nil {
+		return ids
+	}
+	for key, perms := range p.Resources {
+		rest, ok := strings.CutPrefix(key, string(resourceType)+":")
+		if !ok || !slices.Contains(perms, perm) {
+			continue
+		}
+		if id, err := strconv.ParseInt(rest, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func addPermissions(dst []Permission, perms []Permission) []Permission {
+	for _, perm := range perms {
+		if !slices.Contains(dst, perm) {
+			dst = append(dst, perm)
+		}
+	}
+	return dst
+}
+
+func permissionsCacheKey(userID int) string {
+	return fmt.Sprintf("permissions:%d", userID)
+}
+
+// GetUserPermissions resolves the user's permissions, from the cache when
+// possible.
+func (s *serviceImpl) GetUserPermissions(ctx context.Context, userID int) (*Permissions, error) {
+	var perms Permissions
+	if err := s.redis.Get(ctx, permissionsCacheKey(userID), &perms); err == nil {
+		return &perms, nil
+	}
+
+	roles, err := s.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	perms = Permissions{
+		Global:    addPermissions(nil, rolePermissions[roles.Role]),
+		Resources: map[string][]Permission{},
+	}
+	for _, grant := range roles.Grants {
+		if grant.ResourceType == nil || grant.ResourceID == nil {
+			perms.Global = addPermissions(perms.Global, rolePermissions[grant.Role])
+			continue
+		}
+		key := resourceKey(*grant.ResourceType, *grant.ResourceID)
+		perms.Resources[key] = addPermissions(perms.Resources[key], rolePermissions[grant.Role])
+	}
+
+	// Caching is best effort, a miss only costs the lookup above
+	s.redis.Set(ctx, permissionsCacheKey(userID), perms, permissionsCacheTTL)
+	return &perms, nil
+}
+
+func (s *serviceImpl) GetUserRoles(ctx context.Context, userID int) (*UserRoles, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	roles := UserRoles{UserID: userID, Grants: []RoleGrant{}}
+	if err := s.db.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&roles.Role); err != nil {
+		return nil, fmt.Errorf("failed to get user role: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, role, resource_type, resource_id, granted_by, created_at
+		FROM role_grants WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role grants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g RoleGrant
+		if err := rows.Scan(&g.ID, &g.UserID, &g.Role, &g.ResourceType, &g.ResourceID, &g.GrantedBy, &g.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role grant: %w", err)
+		}
+		roles.Grants = append(roles.Grants, g)
+	}
+	return &roles, rows.Err()
+}
+
+func (s *serviceImpl) SetUserRole(ctx context.Context, userID int, role UserRole) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("user not found")
+	}
+	s.redis.Delete(ctx, permissionsCacheKey(userID))
+	return nil
+}
+
+func (s *serviceImpl) AddRoleGrant(ctx context.Context, grant *RoleGrant) (int, error) {
+	if _, ok := rolePermissions[grant.Role]; !ok {
+		return 0, fmt.Errorf("unknown role %q", grant.Role)
+	}
+	if (grant.ResourceType == nil) != (grant.ResourceID == nil) {
+		return 0, errors.New("a scoped grant needs both ResourceType and ResourceID")
+	}
+	if grant.ResourceType != nil && !slices.Contains(grantableResources[grant.Role], *grant.ResourceType) {
+		return 0, fmt.Errorf("role %q can't be granted on a %s", grant.Role, *grant.ResourceType)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO role_grants (user_id, role, resource_type, resource_id, granted_by)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		grant.UserID, grant.Role, grant.ResourceType, grant.ResourceID, grant.GrantedBy,
+	).Scan(&id)
+	if err != nil {
+		if isDuplicateErr(err) {
+			return 0, errors.New("user already has this grant")
+		}
+		return 0, fmt.Errorf("failed to add role grant: %w", err)
+	}
+	s.redis.Delete(ctx, permissionsCacheKey(grant.UserID))
+	return id, nil
+}
+
+func (s *serviceImpl) RemoveRoleGrant(ctx context.Context, userID, grantID int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM role_grants WHERE id = $1 AND user_id = $2`, grantID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove role grant: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("grant not found")
+	}
+	s.redis.Delete(ctx, permissionsCacheKey(userID))
+	return nil
+}
+
+// PermissionsMiddleware loads the permissions of the user set by
+// AuthMiddleware into the request context.
+func PermissionsMiddleware(service *serviceImpl) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := r.Context().Value(ContextUserIDKey).(int)
+			perms, err := service.GetUserPermissions(r.Context(), userID)
+			if err != nil {
+				http.Error(w, "failed to load permissions", http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), ContextPermissionsKey, perms)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func permissionsFromContext(ctx context.Context) *Permissions {
+	perms, _ := ctx.Value(ContextPermissionsKey).(*Permissions)
+	return perms
+}
+
+// RequirePermission only lets through users holding any of the permissions
+// globally.
+func RequirePermission(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			have := permissionsFromContext(r.Context())
+			if !slices.ContainsFunc(perms, have.Has) {
+				http.Error(w, "unauthorized: missing permission", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireResourcePermission lets through users holding the permission
+// globally or on the resource named by the given URL parameter.
+func RequireResourcePermission(perm Permission, resourceType ResourceType, param string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := strconv.Atoi(chi.URLParam(r, param))
+			if !permissionsFromContext(r.Context()).HasOn(perm, resourceType, id) {
+				http.Error(w, "unauthorized: missing permission", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
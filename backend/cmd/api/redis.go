@@ -90,6 +90,18 @@ func (r *RedisService) Get(ctx context.Context, key string, dest interface{}) er
 	return json.Unmarshal([]byte(data), dest)
 }
 
+// Increment adds one to a counter and returns the new value. The expiration
+// is set when the counter is created and isn't extended by later increments.
+func (r *RedisService) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
 // Delete removes a key from the Redis cache.
 func (r *RedisService) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
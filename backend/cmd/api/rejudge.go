@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// A rejudge sends submissions back through the execution service against
+// the problem's current tests, after a wrong test or checker was fixed. The
+// submissions show as pending until their results come back; each result
+// is recorded in submission_verdicts next to the verdict it replaced, and
+// the user's solved problems and contest score follow the new verdict.
+
+var (
+	ErrNothingToRejudge = errors.New("no judged submissions match")
+	ErrRejudgeNotFound  = errors.New("rejudge not found")
+)
+
+// submissionStatus is the overall status of judged tests: Accepted, or the
+// status of the first test that failed and its number.
+func submissionStatus(results []TestResult) string {
+	for i, result := range results {
+		if !strings.EqualFold(result.Status, "accepted") {
+			return fmt.Sprintf("%s on Test Case : %d", result.Status, i+1)
+		}
+	}
+	return "Accepted"
+}
+
+// verdictOf is a submission status without the failing test, lowercase,
+// like "wrong answer".
+func verdictOf(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if i := strings.Index(status, " on test case"); i >= 0 {
+		status = status[:i]
+	}
+	return status
+}
+
+// RejudgeFilter selects the submissions to rejudge: one submission, or
+// those to a problem or in a contest, with a verdict if Verdict is set.
+type RejudgeFilter struct {
+	SubmissionID int
+	ProblemID    int
+	ContestID    int
+	Verdict      string
+}
+
+func (f RejudgeFilter) matches(sub *Submission) bool {
+	// Runs aren't judged, only submissions have a contest (0 for practice)
+	if sub.ProblemID == nil || sub.ContestID == nil || verdictOf(sub.Status) == "pending" {
+		return false
+	}
+	switch {
+	case f.SubmissionID > 0 && sub.ID != f.SubmissionID:
+		return false
+	case f.ProblemID > 0 && *sub.ProblemID != f.ProblemID:
+		return false
+	case f.ContestID > 0 && *sub.ContestID != f.ContestID:
+		return false
+	}
+	return f.Verdict == "" || verdictOf(sub.Status) == verdictOf(f.Verdict)
+}
+
+// pendingRejudge is a submission waiting for its new verdict.
+type pendingRejudge struct {
+	rejudgeID int
+	oldStatus string
+}
+
+// Rejudge requeues the submissions the filter selects. userID is who asked.
+func (s *serviceImpl) Rejudge(ctx context.Context, filter RejudgeFilter, userID int) (*Rejudge, error) {
+	// Copies to prepare the payloads with, and their indices to update the
+	// submissions once that's done
+	var indices []int
+	var selected []Submission
+	s.submissionsMu.Lock()
+	for i := range s.submissions {
+		if filter.matches(&s.submissions[i]) {
+			indices = append(indices, i)
+			selected = append(selected, s.submissions[i])
+		}
+	}
+	s.submissionsMu.Unlock()
+	if len(selected) == 0 {
+		return nil, ErrNothingToRejudge
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	// One payload per problem and language, they share tests and limits
+	type payloadKey struct {
+		problemID int
+		language  Language
+	}
+	payloads := map[payloadKey]ExecutionPayload{}
+	revisions := map[int]int{}
+	for _, sub := range selected {
+		key := payloadKey{*sub.ProblemID, sub.Language}
+		if _, ok := payloads[key]; ok {
+			continue
+		}
+		payload, revision, err := s.submitPayload(ctx, key.problemID, key.language)
+		if err != nil {
+			return nil, err
+		}
+		payloads[key], revisions[key.problemID] = payload, revision
+	}
+
+	var rejudgeID int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO rejudges (submission_id, problem_id, contest_id, verdict, requested_by, submissions)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), NULLIF($3, 0), NULLIF($4, ''), $5, $6)
+		RETURNING id`, filter.SubmissionID, filter.ProblemID, filter.ContestID,
+		verdictOf(filter.Verdict), userID, len(selected),
+	).Scan(&rejudgeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejudge: %w", err)
+	}
+
+	// A submission is pending before it's queued, its result may come
+	// back right away
+	queued := 0
+	for n, i := range indices {
+		s.submissionsMu.Lock()
+		sub := &s.submissions[i]
+		// Judged again since it was selected, leave it to that result
+		if sub.Status != selected[n].Status {
+			s.submissionsMu.Unlock()
+			continue
+		}
+		old := *sub
+		s.rejudging[sub.ID] = pendingRejudge{rejudgeID: rejudgeID, oldStatus: sub.Status}
+		sub.Status = "pending"
+		sub.Message = ""
+		sub.Results = nil
+		sub.ProblemRevision = revisions[*sub.ProblemID]
+		s.submissionsMu.Unlock()
+
+		payload := payloads[payloadKey{*old.ProblemID, old.Language}]
+		payload.ID = old.ID
+		payload.Code = old.Code
+		payload.ContestID = *old.ContestID
+		if err := s.redis.ExecuteCode(ctx, payload); err != nil {
+			log.Printf("Failed to queue submission %d for rejudge: %v", old.ID, err)
+			s.submissionsMu.Lock()
+			delete(s.rejudging, old.ID)
+			s.submissions[i] = old
+			s.submissionsMu.Unlock()
+			continue
+		}
+		queued++
+	}
+
+	if queued < len(selected) {
+		_, err := s.db.ExecContext(ctx, `UPDATE rejudges SET submissions = $2 WHERE id = $1`, rejudgeID, queued)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update rejudge: %w", err)
+		}
+		if queued == 0 {
+			return nil, errors.New("failed to queue the submissions")
+		}
+	}
+	return s.GetRejudge(ctx, rejudgeID)
+}
+
+// finishRejudge records the new verdict of a rejudged submission and
+// recomputes what depends on it. Other submissions are left alone.
+func (s *serviceImpl) finishRejudge(ctx context.Context, sub Submission, pending pendingRejudge) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO submission_verdicts (submission_id, rejudge_id, user_id, problem_id, contest_id, old_status, new_status)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7)`,
+		sub.ID, pending.rejudgeID, sub.UserID, *sub.ProblemID, *sub.ContestID, pending.oldStatus, sub.Status)
+	if err != nil {
+		return fmt.Errorf("failed to record verdict: %w", err)
+	}
+
+	// Only gaining or losing Accepted changes the standings
+	if (verdictOf(pending.oldStatus) == "accepted") == (verdictOf(sub.Status) == "accepted") {
+		return nil
+	}
+	if err := s.recomputeSolved(ctx, sub); err != nil {
+		return err
+	}
+	if *sub.ContestID > 0 {
+		return s.recomputeContestScore(ctx, *sub.ContestID, sub.UserID, *sub.ProblemID)
+	}
+	return nil
+}
+
+// firstAccepted returns the user's first accepted submission to the
+// problem, in the contest when contestID isn't 0. The caller holds
+// submissionsMu.
+func (s *serviceImpl) firstAccepted(userID, problemID, contestID int) (Submission, bool) {
+	i := slices.IndexFunc(s.submissions, func(sub Submission) bool {
+		return sub.UserID == userID && sub.ProblemID != nil && *sub.ProblemID == problemID &&
+			sub.ContestID != nil && (contestID == 0 || *sub.ContestID == contestID) &&
+			verdictOf(sub.Status) == "accepted"
+	})
+	if i < 0 {
+		return Submission{}, false
+	}
+	return s.submissions[i], true
+}
+
+// recomputeSolved marks the problem solved or unsolved for the author of a
+// rejudged submission.
+func (s *serviceImpl) recomputeSolved(ctx context.Context, rejudged Submission) error {
+	s.submissionsMu.Lock()
+	first, accepted := s.firstAccepted(rejudged.UserID, *rejudged.ProblemID, 0)
+	s.submissionsMu.Unlock()
+
+	var err error
+	if accepted {
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO solved_problems (user_id, problem_id, solved_at) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, problem_id) DO UPDATE
+			SET solved_at = LEAST(solved_problems.solved_at, EXCLUDED.solved_at)`,
+			rejudged.UserID, *rejudged.ProblemID, first.CreatedAt)
+	} else {
+		// Submissions from before a restart aren't kept, a solve recorded
+		// before the rejudged submission was made came from one of them
+		_, err = s.db.ExecContext(ctx, `
+			DELETE FROM solved_problems WHERE user_id = $1 AND problem_id = $2 AND solved_at >= $3`,
+			rejudged.UserID, *rejudged.ProblemID, rejudged.CreatedAt)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update solved problems: %w", err)
+	}
+	return nil
+}
+
+// recomputeContestScore gives the user the problem's points when one of
+// their contest submissions to it is accepted, and takes them back when
+// none is anymore. The problem counts as solved when the first accepted
+// submission was made.
+func (s *serviceImpl) recomputeContestScore(ctx context.Context, contestID, userID, problemID int) error {
+	// Read the points first, the lock isn't held across queries
+	var points int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT max_points FROM contest_problems WHERE contest_id = $1 AND problem_id = $2`,
+		contestID, problemID).Scan(&points)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to fetch contest problem points: %w", err)
+	}
+
+	s.submissionsMu.Lock()
+	defer s.submissionsMu.Unlock()
+
+	solved := slices.IndexFunc(s.contestSubmission, func(c ContestSolvedProblems) bool {
+		return c.ContestID == contestID && c.UserID == userID && c.ProblemID == problemID
+	})
+	first, accepted := s.firstAccepted(userID, problemID, contestID)
+
+	switch {
+	case accepted && solved < 0:
+		s.contestSubmission = append(s.contestSubmission, ContestSolvedProblems{
+			ContestID:  contestID,
+			UserID:     userID,
+			ProblemID:  problemID,
+			SolvedAt:   int(first.CreatedAt.Unix()),
+			ScoreDelta: points,
+		})
+	case accepted:
+		// An earlier submission may be the accepted one now
+		s.contestSubmission[solved].SolvedAt = int(first.CreatedAt.Unix())
+	case solved >= 0:
+		s.contestSubmission = slices.Delete(s.contestSubmission, solved, solved+1)
+	}
+	return nil
+}
+
+// GetRejudge returns a rejudge with the verdicts that came back so far.
+func (s *serviceImpl) GetRejudge(ctx context.Context, rejudgeID int) (*Rejudge, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var rj Rejudge
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, submission_id, problem_id, contest_id, COALESCE(verdict, ''), requested_by, submissions, created_at
+		FROM rejudges WHERE id = $1`, rejudgeID,
+	).Scan(&rj.ID, &rj.SubmissionID, &rj.ProblemID, &rj.ContestID, &rj.Verdict, &rj.RequestedBy, &rj.Submissions, &rj.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRejudgeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rejudge: %w", err)
+	}
+
+	rj.Verdicts, err = s.getVerdictChanges(ctx, "rejudge_id", rejudgeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range rj.Verdicts {
+		if v.Changed {
+			rj.Changed++
+		}
+	}
+	return &rj, nil
+}
+
+// GetSubmissionVerdicts is the verdict history of a submission, oldest
+// first.
+func (s *serviceImpl) GetSubmissionVerdicts(ctx context.Context, submissionID int) ([]VerdictChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+	return s.getVerdictChanges(ctx, "submission_id", submissionID)
+}
+
+func (s *serviceImpl) getVerdictChanges(ctx context.Context, column string, id int) ([]VerdictChange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, submission_id, rejudge_id, user_id, problem_id, contest_id, old_status, new_status, created_at
+		FROM submission_verdicts WHERE `+column+` = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verdicts: %w", err)
+	}
+	defer rows.Close()
+
+	verdicts := []VerdictChange{}
+	for rows.Next() {
+		var v VerdictChange
+		err := rows.Scan(&v.ID, &v.SubmissionID, &v.RejudgeID, &v.UserID, &v.ProblemID, &v.ContestID,
+			&v.OldStatus, &v.NewStatus, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		v.Changed = v.OldStatus != v.NewStatus
+		verdicts = append(verdicts, v)
+	}
+	return verdicts, rows.Err()
+}
@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestSubmissionStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []TestResult
+		want    string
+	}{
+		{"no tests", nil, "Accepted"},
+		{"all accepted", []TestResult{{Status: "Accepted"}, {Status: "accepted"}}, "Accepted"},
+		{"first failing", []TestResult{{Status: "Wrong Answer"}, {Status: "Accepted"}}, "Wrong Answer on Test Case : 1"},
+		{"later failing", []TestResult{{Status: "Accepted"}, {Status: "Time Limit Exceeded"}, {Status: "Wrong Answer"}},
+			"Time Limit Exceeded on Test Case : 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := submissionStatus(tt.results); got != tt.want {
+				t.Errorf("submissionStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerdictOf(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"Accepted", "accepted"},
+		{"Wrong Answer on Test Case : 3", "wrong answer"},
+		{"  Time Limit Exceeded on test case : 12 ", "time limit exceeded"},
+		{"pending", "pending"},
+		{"wrong answer", "wrong answer"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := verdictOf(tt.status); got != tt.want {
+				t.Errorf("verdictOf(%q) = %q, want %q", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejudgeFilterMatches(t *testing.T) {
+	problem, otherProblem := 1, 2
+	practice, contest := 0, 5
+	submission := func(id int, problemID, contestID *int, status string) *Submission {
+		return &Submission{ID: id, ProblemID: problemID, ContestID: contestID, Status: status}
+	}
+
+	tests := []struct {
+		name   string
+		filter RejudgeFilter
+		sub    *Submission
+		want   bool
+	}{
+		{"everything", RejudgeFilter{}, submission(1, &problem, &practice, "Accepted"), true},
+		{"run", RejudgeFilter{}, submission(1, &problem, nil, "Accepted"), false},
+		{"no problem", RejudgeFilter{}, submission(1, nil, &practice, "Accepted"), false},
+		{"pending", RejudgeFilter{}, submission(1, &problem, &practice, "pending"), false},
+		{"submission", RejudgeFilter{SubmissionID: 1}, submission(1, &problem, &practice, "Accepted"), true},
+		{"other submission", RejudgeFilter{SubmissionID: 2}, submission(1, &problem, &practice, "Accepted"), false},
+		{"problem", RejudgeFilter{ProblemID: problem}, submission(1, &problem, &practice, "Accepted"), true},
+		{"other problem", RejudgeFilter{ProblemID: problem}, submission(1, &otherProblem, &practice, "Accepted"), false},
+		{"contest", RejudgeFilter{ContestID: contest}, submission(1, &problem, &contest, "Accepted"), true},
+		{"practice in contest filter", RejudgeFilter{ContestID: contest}, submission(1, &problem, &practice, "Accepted"), false},
+		{"verdict", RejudgeFilter{Verdict: "Wrong Answer"}, submission(1, &problem, &practice, "Wrong Answer on Test Case : 2"), true},
+		{"verdict lowercase", RejudgeFilter{Verdict: "wrong answer"}, submission(1, &problem, &practice, "Wrong Answer on Test Case : 2"), true},
+		{"other verdict", RejudgeFilter{Verdict: "Accepted"}, submission(1, &problem, &practice, "Wrong Answer on Test Case : 2"), false},
+		{"all set", RejudgeFilter{SubmissionID: 1, ProblemID: problem, ContestID: contest, Verdict: "accepted"},
+			submission(1, &problem, &contest, "Accepted"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(tt.sub); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"log"
-	migrate "oj-be/migrations"
+	"reflect"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -22,18 +28,31 @@ type serviceImpl struct {
 	db                *sql.DB
 	submissions       []Submission
 	contestSubmission []ContestSolvedProblems
-	redis             *RedisService
+	// submissionsMu guards submissions, contestSubmission and rejudging.
+	// Keep indices, not pointers, into submissions across I/O, an append
+	// may move it.
+	submissionsMu   sync.Mutex
+	rejudging       map[int]pendingRejudge // by submission, see rejudge.go
+	redis           *RedisService
+	blobs           BlobStore
+	mailer          Mailer
+	appURL          string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
 }
 
-func NewService(db *sql.DB, redis *RedisService) *serviceImpl {
-	return &serviceImpl{db: db, redis: redis, submissions: make([]Submission, 0)}
-}
-
-func (s *serviceImpl) ResetDB(ctx context.Context) error {
-	return migrate.ResetDB(s.db)
+func NewService(db *sql.DB, redis *RedisService, blobs BlobStore, mailer Mailer, cfg *Config) *serviceImpl {
+	return &serviceImpl{
+		db: db, redis: redis, blobs: blobs, mailer: mailer, submissions: make([]Submission, 0),
+		rejudging: map[int]pendingRejudge{}, appURL: cfg.APP_URL, accessTokenTTL: cfg.ACCESS_TOKEN_TTL, refreshTokenTTL: cfg.REFRESH_TOKEN_TTL,
+	}
 }
 
 func (s *serviceImpl) Register(ctx context.Context, username, email, password string) (int, string, error) {
+	if err := checkPasswordStrength(password, username, email); err != nil {
+		return 0, "", err
+	}
+
 	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		return 0, "", fmt.Errorf("failed to hash the password: %w", err)
@@ -64,32 +83,44 @@ func (s *serviceImpl) Register(ctx context.Context, username, email, password st
 }
 
 func (s *serviceImpl) Login(ctx context.Context, username, password string) (int, string, error) {
-	hashedPassword, err := hashPassword(password)
-	if err != nil {
-		return 0, "", fmt.Errorf("failed to hash the password: %w", err)
-	}
-
-	query := `Select id, role FROM users WHERE username=$1 and hashed_password=$2;`
+	query := `SELECT id, role, hashed_password FROM users WHERE username = $1;`
 
 	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
 	defer cancel()
 
 	var userID int
 	var role string
+	var hashedPassword string
 
-	log.Println("\n\n Query: ", query)
-	log.Println("\n Params: ", username, hashedPassword)
-	err = s.db.QueryRowContext(ctx, query, username, hashedPassword).Scan(&userID, &role)
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&userID, &role, &hashedPassword)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+			return 0, "", errors.New("invalid credentials")
+		}
 		return 0, "", fmt.Errorf("failed to authenticate user: %w", err)
 	}
 
+	ok, rehash := verifyPassword(hashedPassword, password)
+	if !ok {
+		return 0, "", errors.New("invalid credentials")
+	}
+	if rehash {
+		// Failing to upgrade the hash shouldn't fail the login, it's retried next time
+		if newHash, err := hashPassword(password); err == nil {
+			_, err = s.db.ExecContext(ctx, `UPDATE users SET hashed_password = $2 WHERE id = $1`, userID, newHash)
+			if err != nil {
+				log.Printf("failed to upgrade password hash of user %d: %v", userID, err)
+			}
+		}
+	}
+
 	return userID, role, nil
 }
 
 func (s *serviceImpl) GetUserByID(ctx context.Context, userID int) (*User, error) {
 	const query = `
-		SELECT id, username, email, role, rating
+		SELECT id, username, email, role, rating, email_verified_at IS NOT NULL
 		FROM users WHERE id = $1;
 	`
 
@@ -98,7 +129,7 @@ func (s *serviceImpl) GetUserByID(ctx context.Context, userID int) (*User, error
 
 	var user User
 	err := s.db.QueryRowContext(ctx, query, userID).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Role, &user.Rating,
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.Rating, &user.EmailVerified,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user profile: %w", err)
@@ -174,21 +205,31 @@ func (s *serviceImpl) GetUserProfile(ctx context.Context, username string) (*Use
 }
 
 func (s *serviceImpl) AdminGetProblemBySlug(ctx context.Context, slug string) (*ProblemDetail, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+	return s.getProblemBySlug(ctx, s.db, slug)
+}
+
+// getProblemBySlug reads the problem and everything it owns through db, a
+// transaction when the read must be consistent with a write.
+func (s *serviceImpl) getProblemBySlug(ctx context.Context, db queryer, slug string) (*ProblemDetail, error) {
 	const problemQuery = `
 		SELECT id, title, description, constraints, difficulty, author_id, status, 
-		       failure_reason, slug, solution_language, solution_code
+		       failure_reason, slug, solution_language, solution_code,
+		       generator_language, generator_code, generator_script,
+		       validator_language, validator_code, validation_report
 		FROM problems WHERE slug = $1;
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
-	defer cancel()
-
 	var pd ProblemDetail
-	var constraints *string
-	err := s.db.QueryRowContext(ctx, problemQuery, slug).Scan(
+	var constraints, generatorScript *string
+	var generatorLanguage, generatorCode, validatorLanguage, validatorCode *string
+	var validationReport []byte
+	err := db.QueryRowContext(ctx, problemQuery, slug).Scan(
 		&pd.ID, &pd.Title, &pd.Description, &constraints, &pd.Difficulty,
 		&pd.AuthorID, &pd.Status, &pd.FailureReason, &pd.Slug, &pd.SolutionLanguage,
-		&pd.SolutionCode,
+		&pd.SolutionCode, &generatorLanguage, &generatorCode, &generatorScript,
+		&validatorLanguage, &validatorCode, &validationReport,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -200,6 +241,17 @@ func (s *serviceImpl) AdminGetProblemBySlug(ctx context.Context, slug string) (*
 	if constraints != nil && len(*constraints) > 0 {
 		pd.Constraints = strings.Split(*constraints, "\n")
 	}
+	pd.Generator = scanProblemProgram(generatorLanguage, generatorCode)
+	pd.Validator = scanProblemProgram(validatorLanguage, validatorCode)
+	if generatorScript != nil {
+		pd.GeneratorScript = *generatorScript
+	}
+	if validationReport != nil {
+		pd.ValidationReport = &ValidationReport{}
+		if err := json.Unmarshal(validationReport, pd.ValidationReport); err != nil {
+			return nil, fmt.Errorf("failed to decode validation report: %w", err)
+		}
+	}
 
 	// Initialize slices to prevent null JSON
 	pd.Tags = []string{}
@@ -208,35 +260,40 @@ func (s *serviceImpl) AdminGetProblemBySlug(ctx context.Context, slug string) (*
 	pd.Examples = []ProblemExample{}
 
 	// Unified error handling
-	if err := s.loadProblemAssociations(ctx, &pd); err != nil {
+	if err := s.loadProblemAssociations(ctx, db, &pd); err != nil {
 		return nil, err
 	}
 
 	return &pd, nil
 }
 
-func (s *serviceImpl) loadProblemAssociations(ctx context.Context, pd *ProblemDetail) error {
+func (s *serviceImpl) loadProblemAssociations(ctx context.Context, db queryer, pd *ProblemDetail) error {
 	// Load tags
-	if err := s.loadTags(ctx, pd); err != nil {
+	if err := s.loadTags(ctx, db, pd); err != nil {
 		return err
 	}
 
 	// Load test cases
-	if err := s.loadTestCases(ctx, pd); err != nil {
+	if err := s.loadTestCases(ctx, db, pd); err != nil {
 		return err
 	}
 
 	// Load limits
-	if err := s.loadLimits(ctx, pd); err != nil {
+	if err := s.loadLimits(ctx, db, pd); err != nil {
+		return err
+	}
+
+	// Load solutions
+	if err := s.loadSolutions(ctx, db, pd); err != nil {
 		return err
 	}
 
 	// Load examples
-	return s.loadExamples(ctx, pd)
+	return s.loadExamples(ctx, db, pd)
 }
 
-func (s *serviceImpl) loadTags(ctx context.Context, pd *ProblemDetail) error {
-	rows, err := s.db.QueryContext(ctx, `SELECT tag FROM problem_tags WHERE problem_id = $1`, pd.ID)
+func (s *serviceImpl) loadTags(ctx context.Context, db queryer, pd *ProblemDetail) error {
+	rows, err := db.QueryContext(ctx, `SELECT tag FROM problem_tags WHERE problem_id = $1`, pd.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get tags: %w", err)
 	}
@@ -252,8 +309,12 @@ func (s *serviceImpl) loadTags(ctx context.Context, pd *ProblemDetail) error {
 	return rows.Err()
 }
 
-func (s *serviceImpl) loadTestCases(ctx context.Context, pd *ProblemDetail) error {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, input, expected_output FROM test_cases WHERE problem_id = $1`, pd.ID)
+func (s *serviceImpl) loadTestCases(ctx context.Context, db queryer, pd *ProblemDetail) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, COALESCE(input, ''), COALESCE(expected_output, ''),
+		       COALESCE(input_hash, ''), COALESCE(expected_output_hash, '')
+		FROM test_cases WHERE problem_id = $1 ORDER BY id
+	`, pd.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get test cases: %w", err)
 	}
@@ -261,7 +322,7 @@ func (s *serviceImpl) loadTestCases(ctx context.Context, pd *ProblemDetail) erro
 
 	for rows.Next() {
 		var tc TestCase
-		if err := rows.Scan(&tc.ID, &tc.Input, &tc.ExpectedOutput); err != nil {
+		if err := rows.Scan(&tc.ID, &tc.Input, &tc.ExpectedOutput, &tc.InputHash, &tc.ExpectedOutputHash); err != nil {
 			return fmt.Errorf("failed to scan test case: %w", err)
 		}
 		pd.TestCases = append(pd.TestCases, tc)
@@ -269,8 +330,8 @@ func (s *serviceImpl) loadTestCases(ctx context.Context, pd *ProblemDetail) erro
 	return rows.Err()
 }
 
-func (s *serviceImpl) loadLimits(ctx context.Context, pd *ProblemDetail) error {
-	rows, err := s.db.QueryContext(ctx, `
+func (s *serviceImpl) loadLimits(ctx context.Context, db queryer, pd *ProblemDetail) error {
+	rows, err := db.QueryContext(ctx, `
 		SELECT language, time_limit_ms, memory_limit_kb 
 		FROM limits WHERE problem_id = $1
 	`, pd.ID)
@@ -290,8 +351,30 @@ func (s *serviceImpl) loadLimits(ctx context.Context, pd *ProblemDetail) error {
 	return rows.Err()
 }
 
-func (s *serviceImpl) loadExamples(ctx context.Context, pd *ProblemDetail) error {
-	rows, err := s.db.QueryContext(ctx, `
+func (s *serviceImpl) loadSolutions(ctx context.Context, db queryer, pd *ProblemDetail) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, language, code, expected_verdicts
+		FROM problem_solutions WHERE problem_id = $1 ORDER BY id
+	`, pd.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get solutions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sol ProblemSolution
+		var verdicts []string
+		if err := rows.Scan(&sol.ID, &sol.Name, &sol.Language, &sol.Code, pq.Array(&verdicts)); err != nil {
+			return fmt.Errorf("failed to scan solution: %w", err)
+		}
+		sol.ExpectedVerdicts = toSubmissionStatuses(verdicts)
+		pd.Solutions = append(pd.Solutions, sol)
+	}
+	return rows.Err()
+}
+
+func (s *serviceImpl) loadExamples(ctx context.Context, db queryer, pd *ProblemDetail) error {
+	rows, err := db.QueryContext(ctx, `
 		SELECT id, input, expected_output, explanation 
 		FROM problem_examples WHERE problem_id = $1
 	`, pd.ID)
@@ -310,16 +393,26 @@ func (s *serviceImpl) loadExamples(ctx context.Context, pd *ProblemDetail) error
 	return rows.Err()
 }
 
-func (s *serviceImpl) AdminGetProblems(ctx context.Context) ([]ProblemInfo, error) {
+// AdminGetProblems lists the problems the user may view, see canViewProblem.
+func (s *serviceImpl) AdminGetProblems(ctx context.Context, userID int, perms *Permissions) ([]ProblemInfo, error) {
 	const query = `
 		SELECT id, title, difficulty, slug, status
-		FROM problems;
+		FROM problems
+		WHERE $1 OR author_id = $2 OR id = ANY($3)
+		   OR (status = 'in_review' AND ($4 OR id = ANY($5)));
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query)
+	reviewer := perms.Has(PERMISSION_PROBLEM_TEST) || perms.Has(PERMISSION_PROBLEM_REVIEW)
+	reviewing := append(perms.ScopedIDs(PERMISSION_PROBLEM_TEST, RESOURCE_PROBLEM),
+		perms.ScopedIDs(PERMISSION_PROBLEM_REVIEW, RESOURCE_PROBLEM)...)
+	rows, err := s.db.QueryContext(ctx, query,
+		perms.Has(PERMISSION_PROBLEM_MANAGE), userID,
+		pq.Array(perms.ScopedIDs(PERMISSION_PROBLEM_AUTHOR, RESOURCE_PROBLEM)),
+		reviewer, pq.Array(reviewing),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch problems: %w", err)
 	}
@@ -350,7 +443,7 @@ func (s *serviceImpl) AdminGetProblems(ctx context.Context) ([]ProblemInfo, erro
 
 func (s *serviceImpl) GetProblemForAIByID(ctx context.Context, problemID int) (*ProblemDetail, error) {
 	const problemQuery = `
-		SELECT description, constraints, solution_code, explanation
+		SELECT title, description, constraints, solution_language, solution_code, explanation
 		FROM problems WHERE id = $1;
 	`
 
@@ -360,7 +453,7 @@ func (s *serviceImpl) GetProblemForAIByID(ctx context.Context, problemID int) (*
 	var pd ProblemDetail
 	var constraints, explanation *string
 	err := s.db.QueryRowContext(ctx, problemQuery, problemID).Scan(
-		&pd.Description, &constraints, &pd.SolutionCode, &explanation,
+		&pd.Title, &pd.Description, &constraints, &pd.SolutionLanguage, &pd.SolutionCode, &explanation,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get problem by ID: %w", err)
@@ -401,13 +494,13 @@ func (s *serviceImpl) GetProblemBySlug(ctx context.Context, slug string) (*Probl
 	}
 
 	// Tags
-	_ = s.loadTags(ctx, &pd)
+	_ = s.loadTags(ctx, s.db, &pd)
 
 	// Test Cases
-	_ = s.loadExamples(ctx, &pd)
+	_ = s.loadExamples(ctx, s.db, &pd)
 
 	// Limits
-	_ = s.loadLimits(ctx, &pd)
+	_ = s.loadLimits(ctx, s.db, &pd)
 
 	return &pd, nil
 }
@@ -471,18 +564,24 @@ func (s *serviceImpl) AddProblem(ctx context.Context, problem *ProblemDetail) (i
 	const insertProblem = `
 		INSERT INTO problems (
 			title, description, constraints, slug, difficulty, 
-			author_id, status, solution_language, solution_code
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			author_id, status, solution_language, solution_code,
+			generator_language, generator_code, generator_script,
+			validator_language, validator_code
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id;
 	`
 
 	constraints := strings.Join(problem.Constraints, "\n")
+	generatorLanguage, generatorCode := problemProgramArgs(problem.Generator)
+	validatorLanguage, validatorCode := problemProgramArgs(problem.Validator)
 
 	var problemID int
 	err = tx.QueryRowContext(ctx, insertProblem,
 		problem.Title, problem.Description, constraints, problem.Slug,
 		problem.Difficulty, problem.AuthorID, problem.Status,
 		problem.SolutionLanguage, problem.SolutionCode,
+		generatorLanguage, generatorCode, problem.GeneratorScript,
+		validatorLanguage, validatorCode,
 	).Scan(&problemID)
 	if err != nil {
 		if isDuplicateErr(err) {
@@ -495,6 +594,10 @@ func (s *serviceImpl) AddProblem(ctx context.Context, problem *ProblemDetail) (i
 		return 0, err
 	}
 
+	if _, err := insertProblemRevision(ctx, tx, problemID, problem.AuthorID, problem); err != nil {
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -504,6 +607,53 @@ func (s *serviceImpl) AddProblem(ctx context.Context, problem *ProblemDetail) (i
 	return problemID, err
 }
 
+// ImportProblemPackage creates a problem from a zipped problem package and
+// queues it for validation like any other new problem.
+func (s *serviceImpl) ImportProblemPackage(ctx context.Context, authorID int, data []byte) (int, error) {
+	problem, err := parseProblemPackage(data)
+	if err != nil {
+		return 0, err
+	}
+	problem.AuthorID = authorID
+	return s.AddProblem(ctx, problem)
+}
+
+func (s *serviceImpl) ExportProblemPackage(ctx context.Context, slug string) ([]byte, error) {
+	problem, err := s.AdminGetProblemBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadTestCaseData(ctx, problem.TestCases); err != nil {
+		return nil, err
+	}
+	return buildProblemPackage(problem)
+}
+
+// UploadTestArchive adds the tests in a zip of NAME.in/NAME.ans pairs to a
+// problem, or replaces its tests with them. The problem is saved as a new
+// revision and revalidated.
+func (s *serviceImpl) UploadTestArchive(ctx context.Context, problemID, editorID int, data []byte, replace bool) (int, error) {
+	testCases, err := parseTestArchive(data)
+	if err != nil {
+		return 0, err
+	}
+
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return 0, err
+	}
+	if replace {
+		problem.TestCases = testCases
+	} else {
+		problem.TestCases = append(problem.TestCases, testCases...)
+	}
+
+	if err := s.UpdateProblemByID(ctx, problemID, editorID, problem); err != nil {
+		return 0, err
+	}
+	return len(testCases), nil
+}
+
 func (s *serviceImpl) insertProblemAssociations(ctx context.Context, tx *sql.Tx, problemID int, problem *ProblemDetail) error {
 	// Insert tags
 	if err := batchInsertTags(ctx, tx, problemID, problem.Tags); err != nil {
@@ -516,7 +666,12 @@ func (s *serviceImpl) insertProblemAssociations(ctx context.Context, tx *sql.Tx,
 	}
 
 	// Insert test cases
-	if err := batchInsertTestCases(ctx, tx, problemID, problem.TestCases); err != nil {
+	if err := s.batchInsertTestCases(ctx, tx, problemID, problem.TestCases); err != nil {
+		return err
+	}
+
+	// Insert solutions
+	if err := batchInsertSolutions(ctx, tx, problemID, problem.Solutions); err != nil {
 		return err
 	}
 
@@ -565,21 +720,116 @@ func batchInsertExamples(ctx context.Context, tx *sql.Tx, problemID int, example
 	return nil
 }
 
-func batchInsertTestCases(ctx context.Context, tx *sql.Tx, problemID int, testCases []TestCase) error {
+func batchInsertSolutions(ctx context.Context, tx *sql.Tx, problemID int, solutions []ProblemSolution) error {
+	const baseQuery = `
+		INSERT INTO problem_solutions (problem_id, name, language, code, expected_verdicts)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, sol := range solutions {
+		if err := checkProblemSolution(sol); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, baseQuery,
+			problemID, sol.Name, sol.Language, sol.Code, pq.Array(fromSubmissionStatuses(sol.ExpectedVerdicts)))
+		if err != nil {
+			return fmt.Errorf("failed to insert solution %q: %w", sol.Name, err)
+		}
+	}
+	return nil
+}
+
+// batchInsertTestCases writes the test data to the blob store and the rows
+// referencing it to the database. A blob written for a transaction that is
+// later rolled back is simply left unreferenced. The tests are updated to
+// what was stored, so a revision snapshot only keeps the hash of large data.
+func (s *serviceImpl) batchInsertTestCases(ctx context.Context, tx *sql.Tx, problemID int, testCases []TestCase) error {
 	if len(testCases) == 0 {
 		return nil
 	}
 
 	const baseQuery = `
-		INSERT INTO test_cases (problem_id, input, expected_output)
-		VALUES ($1, $2, $3)`
+		INSERT INTO test_cases (problem_id, input, expected_output, input_hash, expected_output_hash)
+		VALUES ($1, $2, $3, $4, $5)`
 
-	for _, tc := range testCases {
-		_, err := tx.ExecContext(ctx, baseQuery,
-			problemID, tc.Input, tc.ExpectedOutput)
+	for i := range testCases {
+		tc := &testCases[i]
+		input, inputHash, err := s.storeTestData(ctx, tc.Input, tc.InputHash)
+		if err != nil {
+			return err
+		}
+		expected, expectedHash, err := s.storeTestData(ctx, tc.ExpectedOutput, tc.ExpectedOutputHash)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, baseQuery,
+			problemID, input, expected, inputHash, expectedHash)
 		if err != nil {
 			return fmt.Errorf("failed to insert test case (input=%s): %w", shorten(tc.Input), err)
 		}
+		tc.InputHash, tc.ExpectedOutputHash = inputHash, expectedHash
+		if input == nil {
+			tc.Input = ""
+		}
+		if expected == nil {
+			tc.ExpectedOutput = ""
+		}
+	}
+	return nil
+}
+
+// storeTestData puts data in the blob store and returns the inline copy to
+// keep in the database (nil when it is too large) along with its hash.
+// Data that only comes as a hash, e.g. a large test restored from a
+// revision, is already stored and is passed through unchanged.
+func (s *serviceImpl) storeTestData(ctx context.Context, data, hash string) (*string, string, error) {
+	if data == "" && hash != "" {
+		return nil, hash, nil
+	}
+
+	hash, err := s.blobs.Put(ctx, []byte(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store test data: %w", err)
+	}
+	if len(data) > maxInlineTestDataSize {
+		return nil, hash, nil
+	}
+	return &data, hash, nil
+}
+
+// executionTestCases strips the inline data from tests that live in the
+// blob store, so the execution payload only carries their hashes.
+func executionTestCases(testCases []TestCase) []TestCase {
+	refs := make([]TestCase, len(testCases))
+	for i, tc := range testCases {
+		refs[i] = tc
+		if tc.InputHash != "" && tc.ExpectedOutputHash != "" {
+			refs[i].Input = ""
+			refs[i].ExpectedOutput = ""
+		}
+	}
+	return refs
+}
+
+// loadTestCaseData fills in the inline data of tests that are only kept in
+// the blob store.
+func (s *serviceImpl) loadTestCaseData(ctx context.Context, testCases []TestCase) error {
+	for i := range testCases {
+		tc := &testCases[i]
+		if tc.Input == "" && tc.InputHash != "" {
+			data, err := s.blobs.Get(ctx, tc.InputHash)
+			if err != nil {
+				return err
+			}
+			tc.Input = string(data)
+		}
+		if tc.ExpectedOutput == "" && tc.ExpectedOutputHash != "" {
+			data, err := s.blobs.Get(ctx, tc.ExpectedOutputHash)
+			if err != nil {
+				return err
+			}
+			tc.ExpectedOutput = string(data)
+		}
 	}
 	return nil
 }
@@ -608,6 +858,22 @@ func batchInsertLimits(ctx context.Context, tx *sql.Tx, problemID int, limits []
 	return nil
 }
 
+// problemProgramArgs returns the nullable language and code columns for an
+// optional helper program.
+func problemProgramArgs(p *ProblemProgram) (any, any) {
+	if p == nil || strings.TrimSpace(p.Code) == "" {
+		return nil, nil
+	}
+	return p.Language, p.Code
+}
+
+func scanProblemProgram(language, code *string) *ProblemProgram {
+	if language == nil || code == nil {
+		return nil
+	}
+	return &ProblemProgram{Language: Language(*language), Code: *code}
+}
+
 // Helper to truncate long input for error messages
 func shorten(s string) string {
 	const maxLen = 20
@@ -628,7 +894,9 @@ func isDuplicateErr(err error) bool {
 	return false
 }
 
-func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id int, problem *ProblemDetail) error {
+// UpdateProblemByID overwrites the problem and records the result as a new
+// revision, so the previous tests and solution can still be restored.
+func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id, editorID int, problem *ProblemDetail) error {
 	const problemQuery = `
 		UPDATE problems
 		SET title = $1,
@@ -637,8 +905,14 @@ func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id int, problem *Pr
 			status = $4,
 			solution_language = $5,
 			solution_code = $6,
-			failure_reason = $7
-		WHERE id = $8 returning slug;
+			failure_reason = $7,
+			difficulty = COALESCE(NULLIF($9, '')::difficulty, difficulty),
+			generator_language = $10,
+			generator_code = $11,
+			generator_script = $12,
+			validator_language = $13,
+			validator_code = $14
+		WHERE id = $8 returning slug, difficulty;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
@@ -649,19 +923,41 @@ func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id int, problem *Pr
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
+	// Problems created before revisions existed have no history yet; keep
+	// their current state as the first revision before it is overwritten.
+	// This locks the problem until the commit, so concurrent saves number
+	// their revisions one after the other.
+	baseline, err := s.getProblemForBaselineRevision(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if baseline != nil {
+		if _, err := insertProblemRevision(ctx, tx, id, baseline.AuthorID, baseline); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	slug := ""
 	constraints := strings.Join(problem.Constraints, "\n")
+	generatorLanguage, generatorCode := problemProgramArgs(problem.Generator)
+	validatorLanguage, validatorCode := problemProgramArgs(problem.Validator)
 	problem.Status = "draft"
 
 	err = tx.QueryRowContext(ctx, problemQuery,
 		problem.Title, problem.Description, constraints,
 		problem.Status, problem.SolutionLanguage, problem.SolutionCode,
-		problem.FailureReason, id,
-	).Scan(&slug)
+		problem.FailureReason, id, problem.Difficulty,
+		generatorLanguage, generatorCode, problem.GeneratorScript,
+		validatorLanguage, validatorCode,
+	).Scan(&slug, &problem.Difficulty)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to update problem: %w", err)
 	}
+	problem.Slug = slug
 
 	// Delete and insert tags
 	if _, err = tx.ExecContext(ctx, `DELETE FROM problem_tags WHERE problem_id = $1`, id); err != nil {
@@ -696,15 +992,19 @@ func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id int, problem *Pr
 		tx.Rollback()
 		return fmt.Errorf("failed to delete test cases: %w", err)
 	}
-	for _, tc := range problem.TestCases {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO test_cases (problem_id, input, expected_output)
-			VALUES ($1, $2, $3)
-		`, id, tc.Input, tc.ExpectedOutput)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to insert test case: %w", err)
-		}
+	if err = s.batchInsertTestCases(ctx, tx, id, problem.TestCases); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete and insert solutions
+	if _, err = tx.ExecContext(ctx, `DELETE FROM problem_solutions WHERE problem_id = $1`, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete solutions: %w", err)
+	}
+	if err = batchInsertSolutions(ctx, tx, id, problem.Solutions); err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	// Delete and insert limits
@@ -723,6 +1023,11 @@ func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id int, problem *Pr
 		}
 	}
 
+	if _, err := insertProblemRevision(ctx, tx, id, editorID, problem); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
@@ -732,7 +1037,235 @@ func (s *serviceImpl) UpdateProblemByID(ctx context.Context, id int, problem *Pr
 	return err
 }
 
+// problemSnapshot copies the parts of a problem that make up a revision,
+// leaving out row IDs and validation state that change on every save.
+func problemSnapshot(p *ProblemDetail) *ProblemDetail {
+	snap := &ProblemDetail{
+		Title:            p.Title,
+		Description:      p.Description,
+		Constraints:      p.Constraints,
+		Slug:             p.Slug,
+		Tags:             p.Tags,
+		Difficulty:       p.Difficulty,
+		SolutionLanguage: p.SolutionLanguage,
+		SolutionCode:     p.SolutionCode,
+		Generator:        p.Generator,
+		GeneratorScript:  p.GeneratorScript,
+		Validator:        p.Validator,
+	}
+	for _, tc := range p.TestCases {
+		tc.ID = 0
+		snap.TestCases = append(snap.TestCases, tc)
+	}
+	for _, ex := range p.Examples {
+		ex.ID = 0
+		snap.Examples = append(snap.Examples, ex)
+	}
+	for _, l := range p.Limits {
+		l.ProblemID = 0
+		snap.Limits = append(snap.Limits, l)
+	}
+	for _, sol := range p.Solutions {
+		sol.ID = 0
+		snap.Solutions = append(snap.Solutions, sol)
+	}
+	return snap
+}
+
+func insertProblemRevision(ctx context.Context, tx *sql.Tx, problemID, authorID int, problem *ProblemDetail) (int, error) {
+	const insertRevision = `
+		INSERT INTO problem_revisions (problem_id, revision, author_id, snapshot)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3
+		FROM problem_revisions WHERE problem_id = $1
+		RETURNING revision;
+	`
+
+	data, err := json.Marshal(problemSnapshot(problem))
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode problem revision: %w", err)
+	}
+
+	var author *int
+	if authorID > 0 {
+		author = &authorID
+	}
+
+	var revision int
+	if err := tx.QueryRowContext(ctx, insertRevision, problemID, author, string(data)).Scan(&revision); err != nil {
+		return 0, fmt.Errorf("failed to insert problem revision: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE problems SET current_revision = $2 WHERE id = $1`, problemID, revision); err != nil {
+		return 0, fmt.Errorf("failed to update current revision: %w", err)
+	}
+	return revision, nil
+}
+
+func (s *serviceImpl) AdminGetProblemByID(ctx context.Context, problemID int) (*ProblemDetail, error) {
+	var slug string
+	err := s.db.QueryRowContext(ctx, `SELECT slug FROM problems WHERE id = $1`, problemID).Scan(&slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("problem not found")
+		}
+		return nil, fmt.Errorf("failed to get problem by ID: %w", err)
+	}
+	return s.AdminGetProblemBySlug(ctx, slug)
+}
+
+// getProblemForBaselineRevision locks the problem and returns it when it
+// has no revisions yet, and nil otherwise.
+func (s *serviceImpl) getProblemForBaselineRevision(ctx context.Context, tx *sql.Tx, problemID int) (*ProblemDetail, error) {
+	var slug string
+	var revision int
+	err := tx.QueryRowContext(ctx, `SELECT slug, current_revision FROM problems WHERE id = $1 FOR UPDATE`, problemID).Scan(&slug, &revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("problem not found")
+		}
+		return nil, fmt.Errorf("failed to get problem revision: %w", err)
+	}
+	if revision > 0 {
+		return nil, nil
+	}
+	return s.getProblemBySlug(ctx, tx, slug)
+}
+
+func (s *serviceImpl) GetProblemRevisions(ctx context.Context, problemID int) ([]ProblemRevision, error) {
+	const query = `
+		SELECT id, problem_id, revision, author_id, created_at
+		FROM problem_revisions
+		WHERE problem_id = $1
+		ORDER BY revision DESC;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch problem revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []ProblemRevision{}
+	for rows.Next() {
+		var rev ProblemRevision
+		if err := rows.Scan(&rev.ID, &rev.ProblemID, &rev.Revision, &rev.AuthorID, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan problem revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *serviceImpl) GetProblemRevision(ctx context.Context, problemID, revision int) (*ProblemRevision, error) {
+	const query = `
+		SELECT id, problem_id, revision, author_id, created_at, snapshot
+		FROM problem_revisions
+		WHERE problem_id = $1 AND revision = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var rev ProblemRevision
+	var snapshot []byte
+	err := s.db.QueryRowContext(ctx, query, problemID, revision).Scan(
+		&rev.ID, &rev.ProblemID, &rev.Revision, &rev.AuthorID, &rev.CreatedAt, &snapshot,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("revision %d not found", revision)
+		}
+		return nil, fmt.Errorf("failed to get problem revision: %w", err)
+	}
+
+	rev.Snapshot = &ProblemDetail{}
+	if err := json.Unmarshal(snapshot, rev.Snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode problem revision: %w", err)
+	}
+	return &rev, nil
+}
+
+func (s *serviceImpl) DiffProblemRevisions(ctx context.Context, problemID, fromRevision, toRevision int) (*ProblemRevisionDiff, error) {
+	from, err := s.GetProblemRevision(ctx, problemID, fromRevision)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.GetProblemRevision(ctx, problemID, toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProblemRevisionDiff{
+		ProblemID:    problemID,
+		FromRevision: fromRevision,
+		ToRevision:   toRevision,
+		Changes:      diffProblemDetails(from.Snapshot, to.Snapshot),
+	}, nil
+}
+
+// RollbackProblem restores an earlier revision. The restored state is saved
+// as a new revision, so history is never rewritten.
+func (s *serviceImpl) RollbackProblem(ctx context.Context, problemID, revision, editorID int) error {
+	rev, err := s.GetProblemRevision(ctx, problemID, revision)
+	if err != nil {
+		return err
+	}
+	return s.UpdateProblemByID(ctx, problemID, editorID, rev.Snapshot)
+}
+
+// diffProblemDetails lists the fields that differ between two revisions.
+// Examples and test cases are compared position by position.
+func diffProblemDetails(from, to *ProblemDetail) []RevisionChange {
+	changes := []RevisionChange{}
+	compare := func(field string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, RevisionChange{Field: field, From: a, To: b})
+		}
+	}
+
+	compare("Title", from.Title, to.Title)
+	compare("Description", from.Description, to.Description)
+	compare("Constraints", from.Constraints, to.Constraints)
+	compare("Tags", from.Tags, to.Tags)
+	compare("Difficulty", from.Difficulty, to.Difficulty)
+	compare("SolutionLanguage", from.SolutionLanguage, to.SolutionLanguage)
+	compare("SolutionCode", from.SolutionCode, to.SolutionCode)
+	compare("Limits", from.Limits, to.Limits)
+	compare("Generator", from.Generator, to.Generator)
+	compare("GeneratorScript", from.GeneratorScript, to.GeneratorScript)
+	compare("Validator", from.Validator, to.Validator)
+
+	for i := range max(len(from.Examples), len(to.Examples)) {
+		compare(fmt.Sprintf("Examples[%d]", i), elementAt(from.Examples, i), elementAt(to.Examples, i))
+	}
+	for i := range max(len(from.TestCases), len(to.TestCases)) {
+		compare(fmt.Sprintf("TestCases[%d]", i), elementAt(from.TestCases, i), elementAt(to.TestCases, i))
+	}
+	for i := range max(len(from.Solutions), len(to.Solutions)) {
+		compare(fmt.Sprintf("Solutions[%d]", i), elementAt(from.Solutions, i), elementAt(to.Solutions, i))
+	}
+
+	return changes
+}
+
+// elementAt returns s[i], or nil when i is out of range.
+func elementAt[T any](s []T, i int) any {
+	if i < len(s) {
+		return s[i]
+	}
+	return nil
+}
+
 func (s *serviceImpl) RunCode(ctx context.Context, userID, problemID int, language Language, code string, testCases []TestCase) (int, error) {
+	return s.runCode(ctx, userID, problemID, language, code, testCases, false)
+}
+
+// runCode runs code on the given tests, hiding their data from the result
+// when the user may not see them.
+func (s *serviceImpl) runCode(ctx context.Context, userID, problemID int, language Language, code string, testCases []TestCase, hideTests bool) (int, error) {
 	const limitsQuery = `SELECT time_limit_ms, memory_limit_kb FROM limits WHERE problem_id=$1 and language=$2;`
 	// const insertSubmission = `
 	// 	INSERT INTO submissions (user_id, problem_id, language, code, status, message)
@@ -750,6 +1283,7 @@ func (s *serviceImpl) RunCode(ctx context.Context, userID, problemID int, langua
 	// }
 
 	// TODO: Add to the database
+	s.submissionsMu.Lock()
 	submissionID = len(s.submissions) + 1
 	s.submissions = append(s.submissions, Submission{
 		ID:        submissionID,
@@ -761,7 +1295,10 @@ func (s *serviceImpl) RunCode(ctx context.Context, userID, problemID int, langua
 		Status:    "pending",
 		Message:   "",
 		Results:   nil,
+		CreatedAt: time.Now(),
+		hideTests: hideTests,
 	})
+	s.submissionsMu.Unlock()
 
 	// Fetch time/memory limits from DB
 	var timeLimitMS, memoryLimitKB int
@@ -801,7 +1338,10 @@ func (s *serviceImpl) RunCode(ctx context.Context, userID, problemID int, langua
 	return submissionID, nil
 }
 
-func (s *serviceImpl) GetRunResult(ctx context.Context, runID int) (Submission, error) {
+var ErrSubmissionNotFound = errors.New("submission not found")
+
+// GetRunResult returns a run or submission to the user who made it.
+func (s *serviceImpl) GetRunResult(ctx context.Context, userID, runID int) (Submission, error) {
 	// const submissionQuery = `
 	// 	SELECT id, user_id, problem_id, contest_id, language, code, status, message
 	// 	FROM submissions WHERE id = $1;
@@ -841,6 +1381,11 @@ func (s *serviceImpl) GetRunResult(ctx context.Context, runID int) (Submission,
 	// }
 
 	// TODO: Fetch from the database
+	s.submissionsMu.Lock()
+	defer s.submissionsMu.Unlock()
+	if runID <= 0 || runID > len(s.submissions) || s.submissions[runID-1].UserID != userID {
+		return Submission{}, ErrSubmissionNotFound
+	}
 	sub := s.submissions[runID-1]
 
 	return sub, nil
@@ -852,19 +1397,21 @@ func (s *serviceImpl) SubmitCode(ctx context.Context, userID, problemID, contest
 	// 	VALUES ($1, $2, $3, $4, 'pending', '')
 	// 	RETURNING id;
 	// `
-	const getTestCases = `SELECT id, input, expected_output FROM test_cases WHERE problem_id = $1;`
-	const getLimits = `SELECT time_limit_ms, memory_limit_kb FROM limits WHERE problem_id = $1 AND language = $2;`
-
-	const (
-		defaultTimeLimitMS   = 2000
-		defaultMemoryLimitKB = 65536
-		maxTimeLimitMS       = 5000
-		maxMemoryLimitKB     = 131072
-	)
 
 	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
 	defer cancel()
 
+	if contestID > 0 {
+		if err := s.requireVerifiedEmail(ctx, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	payload, revision, err := s.submitPayload(ctx, problemID, language)
+	if err != nil {
+		return 0, err
+	}
+
 	// Insert the submission
 	submissionID := 0
 	// err := s.db.QueryRowContext(ctx, insertSubmission, userID, problemID, language, code).Scan(&submissionID)
@@ -873,31 +1420,71 @@ func (s *serviceImpl) SubmitCode(ctx context.Context, userID, problemID, contest
 	// }
 
 	// TODO: Add to the database
+	s.submissionsMu.Lock()
 	submissionID = len(s.submissions) + 1
 	s.submissions = append(s.submissions, Submission{
-		ID:        submissionID,
-		ProblemID: &problemID,
-		UserID:    userID,
-		ContestID: &contestID,
-		Language:  language,
-		Code:      code,
-		Status:    "pending",
-		Message:   "",
-		Results:   nil,
+		ID:              submissionID,
+		ProblemID:       &problemID,
+		UserID:          userID,
+		ContestID:       &contestID,
+		Language:        language,
+		Code:            code,
+		Status:          "pending",
+		Message:         "",
+		ProblemRevision: revision,
+		Results:         nil,
+		CreatedAt:       time.Now(),
+		hideTests:       true,
 	})
+	s.submissionsMu.Unlock()
+
+	payload.ID = submissionID
+	payload.Code = code
+	payload.ContestID = contestID
+
+	// Send for execution
+	s.redis.ExecuteCode(ctx, payload)
+
+	return submissionID, nil
+}
+
+// submitPayload prepares judging a submission against the problem's current
+// tests and limits, and returns the revision they belong to. The caller
+// sets the submission's ID, code and contest.
+func (s *serviceImpl) submitPayload(ctx context.Context, problemID int, language Language) (ExecutionPayload, int, error) {
+	const getTestCases = `
+		SELECT id, COALESCE(input, ''), COALESCE(expected_output, ''),
+		       COALESCE(input_hash, ''), COALESCE(expected_output_hash, '')
+		FROM test_cases WHERE problem_id = $1 ORDER BY id;
+	`
+	const getLimits = `SELECT time_limit_ms, memory_limit_kb FROM limits WHERE problem_id = $1 AND language = $2;`
+	const getRevision = `SELECT current_revision FROM problems WHERE id = $1;`
+
+	const (
+		defaultTimeLimitMS   = 2000
+		defaultMemoryLimitKB = 65536
+		maxTimeLimitMS       = 5000
+		maxMemoryLimitKB     = 131072
+	)
+
+	// Record the revision the tests below belong to
+	var revision int
+	if err := s.db.QueryRowContext(ctx, getRevision, problemID).Scan(&revision); err != nil {
+		return ExecutionPayload{}, 0, fmt.Errorf("failed to fetch problem revision: %w", err)
+	}
 
 	// Fetch test cases
 	rows, err := s.db.QueryContext(ctx, getTestCases, problemID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch test cases: %w", err)
+		return ExecutionPayload{}, 0, fmt.Errorf("failed to fetch test cases: %w", err)
 	}
 	defer rows.Close()
 
 	var testCases []TestCase
 	for rows.Next() {
 		var tc TestCase
-		if err := rows.Scan(&tc.ID, &tc.Input, &tc.ExpectedOutput); err != nil {
-			return 0, fmt.Errorf("failed to scan test case: %w", err)
+		if err := rows.Scan(&tc.ID, &tc.Input, &tc.ExpectedOutput, &tc.InputHash, &tc.ExpectedOutputHash); err != nil {
+			return ExecutionPayload{}, 0, fmt.Errorf("failed to scan test case: %w", err)
 		}
 		testCases = append(testCases, tc)
 	}
@@ -910,7 +1497,7 @@ func (s *serviceImpl) SubmitCode(ctx context.Context, userID, problemID, contest
 			timeLimitMS = defaultTimeLimitMS
 			memoryLimitKB = defaultMemoryLimitKB
 		} else {
-			return 0, fmt.Errorf("failed to fetch resource limits: %w", err)
+			return ExecutionPayload{}, 0, fmt.Errorf("failed to fetch resource limits: %w", err)
 		}
 	}
 
@@ -922,32 +1509,24 @@ func (s *serviceImpl) SubmitCode(ctx context.Context, userID, problemID, contest
 		memoryLimitKB = maxMemoryLimitKB
 	}
 
-	// Prepare payload
-	payload := ExecutionPayload{
-		ID:            submissionID,
+	return ExecutionPayload{
 		Language:      language,
-		Code:          code,
-		TestCases:     testCases,
+		TestCases:     executionTestCases(testCases),
 		TimeLimitMS:   timeLimitMS,
 		MemoryLimitKB: memoryLimitKB,
 		ExecutionType: EXECUTION_SUBMIT,
-		ContestID:     contestID,
 		ProblemID:     problemID,
-	}
-
-	// Send for execution
-	s.redis.ExecuteCode(ctx, payload)
-
-	return submissionID, nil
+	}, revision, nil
 }
 
-func (s *serviceImpl) GetSubmissionResult(ctx context.Context, runID int) (Submission, error) {
-	return s.GetRunResult(ctx, runID)
+func (s *serviceImpl) GetSubmissionResult(ctx context.Context, userID, runID int) (Submission, error) {
+	return s.GetRunResult(ctx, userID, runID)
 }
 
 func (s *serviceImpl) GetUserSubmissions(ctx context.Context, userID, problemID int) ([]Submission, error) {
 	const query = `
-		SELECT id, user_id, problem_id, contest_id, language, code, status, message
+		SELECT id, user_id, problem_id, contest_id, language, code, status, message,
+		       COALESCE(problem_revision, 0)
 		FROM submissions
 		WHERE user_id = $1 AND problem_id = $2
 		ORDER BY id DESC;
@@ -965,7 +1544,7 @@ func (s *serviceImpl) GetUserSubmissions(ctx context.Context, userID, problemID
 	var subs []Submission
 	for rows.Next() {
 		var s Submission
-		err := rows.Scan(&s.ID, &s.UserID, &s.ProblemID, &s.ContestID, &s.Language, &s.Code, &s.Status, &s.Message)
+		err := rows.Scan(&s.ID, &s.UserID, &s.ProblemID, &s.ContestID, &s.Language, &s.Code, &s.Status, &s.Message, &s.ProblemRevision)
 		if err != nil {
 			return nil, err
 		}
@@ -982,13 +1561,14 @@ func (s *serviceImpl) CreateContest(ctx context.Context, contest *Contest) (int,
 	defer tx.Rollback()
 
 	const insertContest = `
-		INSERT INTO contests (name, status, start_time, end_time)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO contests (name, status, start_time, end_time, hint_penalty)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id;
 	`
 
 	var contestID int
-	err = tx.QueryRowContext(ctx, insertContest, contest.Name, contest.Status, contest.StartTime, contest.EndTime).Scan(&contestID)
+	err = tx.QueryRowContext(ctx, insertContest, contest.Name, contest.Status, contest.StartTime, contest.EndTime,
+		contest.HintPenalty).Scan(&contestID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert contest: %w", err)
 	}
@@ -1015,11 +1595,12 @@ func (s *serviceImpl) CreateContest(ctx context.Context, contest *Contest) (int,
 func (s *serviceImpl) UpdateContest(ctx context.Context, id int, contest *Contest) error {
 	const updateQuery = `
 		UPDATE contests
-		SET name = $1, status = $2, start_time = $3, end_time = $4
-		WHERE id = $5;
+		SET name = $1, status = $2, start_time = $3, end_time = $4, hint_penalty = $5
+		WHERE id = $6;
 	`
 
-	_, err := s.db.ExecContext(ctx, updateQuery, contest.Name, contest.Status, contest.StartTime, contest.EndTime, id)
+	_, err := s.db.ExecContext(ctx, updateQuery, contest.Name, contest.Status, contest.StartTime, contest.EndTime,
+		contest.HintPenalty, id)
 	if err != nil {
 		return fmt.Errorf("failed to update contest: %w", err)
 	}
@@ -1052,12 +1633,13 @@ func (s *serviceImpl) GetAllContests(ctx context.Context) ([]Contest, error) {
 
 func (s *serviceImpl) GetContestByID(ctx context.Context, contestID int) (*Contest, error) {
 	const baseQuery = `
-		SELECT id, name, status, start_time, end_time
+		SELECT id, name, status, start_time, end_time, hint_penalty
 		FROM contests WHERE id = $1;
 	`
 
 	var c Contest
-	err := s.db.QueryRowContext(ctx, baseQuery, contestID).Scan(&c.ID, &c.Name, &c.Status, &c.StartTime, &c.EndTime)
+	err := s.db.QueryRowContext(ctx, baseQuery, contestID).Scan(&c.ID, &c.Name, &c.Status, &c.StartTime, &c.EndTime,
+		&c.HintPenalty)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contest: %w", err)
 	}
@@ -1096,6 +1678,10 @@ func (s *serviceImpl) JoinContestByID(ctx context.Context, userID, contestID int
 		ON CONFLICT DO NOTHING;
 	`
 
+	if err := s.requireVerifiedEmail(ctx, userID); err != nil {
+		return err
+	}
+
 	_, err := s.db.ExecContext(ctx, query, contestID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to join contest: %w", err)
@@ -1137,7 +1723,10 @@ func (s *serviceImpl) GetLeaderboard(ctx context.Context, contestID int) ([]Cont
 	participantMap := make(map[int]*ContestParticipant)
 
 	// Step 2: Loop through all contest submissions and populate participant data
-	for _, contestSolved := range s.contestSubmission {
+	s.submissionsMu.Lock()
+	contestSubmission := slices.Clone(s.contestSubmission)
+	s.submissionsMu.Unlock()
+	for _, contestSolved := range contestSubmission {
 		if contestSolved.ContestID == contestID {
 			// Check if the participant already exists in the map
 			participant, exists := participantMap[contestSolved.UserID]
@@ -1167,6 +1756,30 @@ func (s *serviceImpl) GetLeaderboard(ctx context.Context, contestID int) ([]Cont
 		}
 	}
 
+	// Hints taken during the contest cost points, see hints.go
+	penalties, err := s.contestHintPenalties(ctx, contestID)
+	if err != nil {
+		return nil, err
+	}
+	for userID, penalty := range penalties {
+		participant, exists := participantMap[userID]
+		if !exists {
+			participant = &ContestParticipant{UserID: userID, ProblemsSolved: []ContestProblem{}}
+			participantMap[userID] = participant
+		}
+		participant.HintPenalty = penalty
+		participant.Score -= penalty
+	}
+
+	// Participants disqualified for plagiarism, see plagiarism.go
+	disqualified, err := s.contestDisqualified(ctx, contestID)
+	if err != nil {
+		return nil, err
+	}
+	for userID := range disqualified {
+		delete(participantMap, userID)
+	}
+
 	// Step 4: Convert the map to a slice for sorting
 	leaderboard := make([]ContestParticipant, 0, len(participantMap))
 	for _, participant := range participantMap {
@@ -1381,13 +1994,13 @@ func (s *serviceImpl) UpdateProblemStatus(ctx context.Context, problemID int, st
 	return nil
 }
 
-func (s *serviceImpl) UpdateProblemExplanation(ctx context.Context, problemID int, explanation string) error {
+func (s *serviceImpl) UpdateProblemExplanation(ctx context.Context, problemID int, explanation, promptVersion string) error {
 	const query = `
 		UPDATE problems
-		SET explanation = $2
+		SET explanation = $2, explanation_prompt_version = $3
 		WHERE id = $1;
 	`
-	_, err := s.db.ExecContext(ctx, query, problemID, explanation)
+	_, err := s.db.ExecContext(ctx, query, problemID, explanation, promptVersion)
 	if err != nil {
 		return fmt.Errorf("failed to update problem status: %w", err)
 	}
@@ -1445,15 +2058,31 @@ func (s *serviceImpl) UpdateSubmission(ctx context.Context, submission *Submissi
 
 	// TODO: Update into the database
 	// Step 1: Validate the submission ID
+	s.submissionsMu.Lock()
 	if submission.ID > len(s.submissions) || submission.ID <= 0 {
+		s.submissionsMu.Unlock()
 		return errors.New("invalid submission")
 	}
 
 	// Step 2: Update the submission details
 	sub := &s.submissions[submission.ID-1]
+	if sub.hideTests {
+		hideTestData(submission)
+	}
 	sub.Message = submission.Message
 	sub.Results = submission.Results
 	sub.Status = submission.Status
+	updated := *sub
+	pending, rejudged := s.rejudging[sub.ID]
+	delete(s.rejudging, sub.ID)
+	s.submissionsMu.Unlock()
+
+	// A rejudged submission records its new verdict, see rejudge.go
+	if rejudged {
+		if err := s.finishRejudge(ctx, updated, pending); err != nil {
+			return err
+		}
+	}
 
 	// Step 3: Handle contest-specific logic
 	if submission.ContestID != nil && *submission.ContestID > 0 {
@@ -1470,6 +2099,8 @@ func (s *serviceImpl) UpdateSubmission(ctx context.Context, submission *Submissi
 
 		// Step 5: Check if the contest problem has already been solved by this user
 		// Check if the contest and problem combination exists for this user
+		s.submissionsMu.Lock()
+		defer s.submissionsMu.Unlock()
 		for _, contestSolved := range s.contestSubmission {
 			if contestSolved.UserID == submission.UserID && contestSolved.ContestID == *submission.ContestID && contestSolved.ProblemID == *submission.ProblemID {
 				// This contest problem has already been solved by the user, no need to add it again
@@ -1482,8 +2113,8 @@ func (s *serviceImpl) UpdateSubmission(ctx context.Context, submission *Submissi
 			ContestID:  *submission.ContestID,
 			UserID:     submission.UserID,
 			ProblemID:  *submission.ProblemID,
-			SolvedAt:   int(time.Now().Unix()), // Record the timestamp of when the problem was solved
-			ScoreDelta: points.Points,          // Using the points fetched from the cache
+			SolvedAt:   int(updated.CreatedAt.Unix()), // Record the timestamp of when the problem was solved
+			ScoreDelta: points.Points,                 // Using the points fetched from the cache
 		}
 
 		// Add to the contestSubmission list
@@ -1493,35 +2124,131 @@ func (s *serviceImpl) UpdateSubmission(ctx context.Context, submission *Submissi
 	return nil
 }
 
-func (s *serviceImpl) validateCode(ctx context.Context, slug string) error {
-	problem, err := s.AdminGetProblemBySlug(ctx, slug)
-	if err != nil {
-		return err
-	}
+// ts_headline marks the matches with random sentinels rather than tags, so
+// a <mark> typed by a user can't pass for one.
+var (
+	headlineStart         = "STARTSEL" + rand.Text()
+	headlineStop          = "STOPSEL" + rand.Text()
+	searchHeadlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop +
+		", MaxWords=35, MinWords=15, MaxFragments=2"
+)
+
+// escapeSnippet makes a ts_headline snippet safe to show as HTML. The text
+// is user content, so everything is escaped and the sentinels then turned
+// into mark tags.
+func escapeSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(headlineStart, "<mark>", headlineStop, "</mark>").Replace(snippet)
+}
+
+// Search runs a ranked full-text query over active problems and discussions.
+// An empty entityType searches both and merges the results by rank.
+func (s *serviceImpl) Search(ctx context.Context, query string, entityType SearchEntityType, limit int) ([]SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
 
-	runtime := 10
-	memory := 50
+	results := []SearchResult{}
 
-	for _, limit := range problem.Limits {
-		if limit.Language == problem.SolutionLanguage {
-			runtime = limit.TimeLimitMS
-			memory = limit.MemoryLimitKB
+	if entityType == "" || entityType == SEARCH_ENTITY_PROBLEM {
+		problems, err := s.searchProblems(ctx, query, limit)
+		if err != nil {
+			return nil, err
 		}
+		results = append(results, problems...)
 	}
 
-	payload := ExecutionPayload{
-		ID:            problem.ID,
-		Language:      problem.SolutionLanguage,
-		Code:          problem.SolutionCode,
-		TestCases:     problem.TestCases,
-		TimeLimitMS:   runtime,
-		MemoryLimitKB: memory,
-		ExecutionType: EXECUTION_VALIDATE,
-		ContestID:     0,
-		ProblemID:     problem.ID,
+	if entityType == "" || entityType == SEARCH_ENTITY_DISCUSSION {
+		discussions, err := s.searchDiscussions(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, discussions...)
 	}
 
-	err = s.redis.ExecuteCode(ctx, payload)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
 
-	return err
+	return results, nil
+}
+
+func (s *serviceImpl) searchProblems(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	const searchQuery = `
+		SELECT p.id, p.title, p.slug, ts_rank(p.search_vector, q.query) AS rank,
+		       ts_headline('english', coalesce(p.description, ''), q.query, $3)
+		FROM problems p, websearch_to_tsquery('english', $1) AS q(query)
+		WHERE p.status = 'active' AND p.search_vector @@ q.query
+		ORDER BY rank DESC
+		LIMIT $2;
+	`
+
+	rows, err := s.db.QueryContext(ctx, searchQuery, query, limit, searchHeadlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search problems: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		res := SearchResult{EntityType: SEARCH_ENTITY_PROBLEM}
+		if err := rows.Scan(&res.ID, &res.Title, &res.Slug, &res.Rank, &res.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan problem search result: %w", err)
+		}
+		res.Snippet = escapeSnippet(res.Snippet)
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+func (s *serviceImpl) searchDiscussions(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	// A discussion matches on its own title/content or on any of its comments.
+	// Comment hits are ranked lower than hits on the discussion itself, and the
+	// snippet comes from the best matching comment when the body doesn't match.
+	const searchQuery = `
+		WITH q AS (
+			SELECT websearch_to_tsquery('english', $1) AS query
+		),
+		comment_hits AS (
+			SELECT c.discussion_id,
+			       max(ts_rank(c.search_vector, q.query)) AS rank,
+			       (array_agg(c.content ORDER BY ts_rank(c.search_vector, q.query) DESC))[1] AS content
+			FROM discussion_comments c, q
+			WHERE c.search_vector @@ q.query
+			GROUP BY c.discussion_id
+		)
+		SELECT d.id, coalesce(d.problem_id, 0), coalesce(d.title, ''),
+		       GREATEST(
+		           CASE WHEN d.search_vector @@ q.query THEN ts_rank(d.search_vector, q.query) ELSE 0 END,
+		           coalesce(ch.rank, 0) * 0.5
+		       ) AS rank,
+		       ts_headline('english',
+		           CASE WHEN d.search_vector @@ q.query THEN coalesce(d.content, '') ELSE ch.content END,
+		           q.query, $3)
+		FROM discussions d
+		CROSS JOIN q
+		LEFT JOIN comment_hits ch ON ch.discussion_id = d.id
+		WHERE d.is_active AND (d.search_vector @@ q.query OR ch.discussion_id IS NOT NULL)
+		ORDER BY rank DESC
+		LIMIT $2;
+	`
+
+	rows, err := s.db.QueryContext(ctx, searchQuery, query, limit, searchHeadlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search discussions: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		res := SearchResult{EntityType: SEARCH_ENTITY_DISCUSSION}
+		if err := rows.Scan(&res.ID, &res.ProblemID, &res.Title, &res.Rank, &res.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan discussion search result: %w", err)
+		}
+		res.Snippet = escapeSnippet(res.Snippet)
+		results = append(results, res)
+	}
+	return results, rows.Err()
 }
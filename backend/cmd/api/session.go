@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A login starts a session: the client holds a short-lived access token (a
+// JWT naming the session) and a long-lived refresh token that is traded for
+// a new pair at /refresh. Refresh tokens rotate on every use; presenting an
+// already rotated token means it was copied, so the whole session is revoked.
+//
+// Access tokens aren't looked up in the database. Revoking a session marks
+// it in Redis for as long as its last access token can still be valid, and
+// AuthMiddleware rejects tokens of marked sessions.
+
+// A rotated token replayed within this window is assumed to be a concurrent
+// refresh from another tab rather than theft.
+const refreshReuseGrace = 30 * time.Second
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// ErrRefreshTokenRotated is the previous token used within
+// refreshReuseGrace: another request, like a second tab, refreshed first
+// and its cookies are the ones to keep.
+var ErrRefreshTokenRotated = errors.New("refresh token already rotated, retry with the new one")
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "revoked_session:" + sessionID
+}
+
+// CreateSession starts a session for the user and returns its id and
+// refresh token.
+func (s *serviceImpl) CreateSession(ctx context.Context, userID int, userAgent, ip string) (string, string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, token_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		sessionID, userID, hashToken(refreshToken), userAgent, ip, time.Now().Add(s.refreshTokenTTL),
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create session: %w", err)
+	}
+	return sessionID, refreshToken, nil
+}
+
+// RefreshSession rotates the session's refresh token and returns the user's
+// id and current role, the session id and the new refresh token.
+func (s *serviceImpl) RefreshSession(ctx context.Context, refreshToken, userAgent, ip string) (int, string, string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash := hashToken(refreshToken)
+	var sessionID, role string
+	var userID int
+	var current bool
+	var lastUsedAt, expiresAt time.Time
+	var revokedAt *time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT s.id, s.user_id, u.role, s.token_hash = $1, s.last_used_at, s.expires_at, s.revoked_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 OR s.previous_token_hash = $1
+		FOR UPDATE OF s`, hash,
+	).Scan(&sessionID, &userID, &role, &current, &lastUsedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", "", "", ErrInvalidRefreshToken
+		}
+		return 0, "", "", "", fmt.Errorf("failed to get session: %w", err)
+	}
+	if revokedAt != nil || time.Now().After(expiresAt) {
+		return 0, "", "", "", ErrInvalidRefreshToken
+	}
+	if !current {
+		if time.Since(lastUsedAt) <= refreshReuseGrace {
+			return 0, "", "", "", ErrRefreshTokenRotated
+		}
+		if err := s.revokeSessions(ctx, tx, userID, sessionID); err != nil {
+			return 0, "", "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", "", "", fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return 0, "", "", "", ErrInvalidRefreshToken
+	}
+
+	newToken, err := randomToken(32)
+	if err != nil {
+		return 0, "", "", "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions
+		SET previous_token_hash = token_hash, token_hash = $2, user_agent = $3, ip = $4,
+		    last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, sessionID, hashToken(newToken), userAgent, ip)
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", "", "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, role, sessionID, newToken, nil
+}
+
+func (s *serviceImpl) GetSessions(ctx context.Context, userID int, currentSessionID string) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_agent, ip, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var sess Session
+		if err := rows.Scan(&sess.ID, &sess.UserAgent, &sess.IP, &sess.CreatedAt, &sess.LastUsedAt, &sess.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sess.Current = sess.ID == currentSessionID
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *serviceImpl) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+	return s.revokeSessions(ctx, s.db, userID, sessionID)
+}
+
+// RevokeSessionByRefreshToken ends the session a refresh token belongs to,
+// for logging out with an expired access token.
+func (s *serviceImpl) RevokeSessionByRefreshToken(ctx context.Context, refreshToken string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var userID int
+	var sessionID string
+	err := s.db.QueryRowContext(ctx, `SELECT user_id, id FROM sessions WHERE token_hash = $1`, hashToken(refreshToken)).
+		Scan(&userID, &sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	return s.revokeSessions(ctx, s.db, userID, sessionID)
+}
+
+// RevokeAllSessions logs the user out everywhere.
+func (s *serviceImpl) RevokeAllSessions(ctx context.Context, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+	return s.revokeSessions(ctx, s.db, userID, "")
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// revokeSessions revokes one of the user's live sessions, or all of them
+// when sessionID is empty, and marks them in Redis so their access tokens
+// stop working.
+func (s *serviceImpl) revokeSessions(ctx context.Context, db queryer, userID int, sessionID string) error {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL AND ($2 = '' OR id = $2)
+		RETURNING id`, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if sessionID != "" && len(ids) == 0 {
+		return errors.New("session not found")
+	}
+
+	for _, id := range ids {
+		if err := s.redis.Set(ctx, revokedSessionKey(id), true, s.accessTokenTTL); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsSessionRevoked reports whether access tokens of the session have been
+// revoked. It only checks Redis, so it stays cheap enough for every request.
+func (s *serviceImpl) IsSessionRevoked(ctx context.Context, sessionID string) bool {
+	var revoked bool
+	return s.redis.Get(ctx, revokedSessionKey(sessionID), &revoked) == nil && revoked
+}
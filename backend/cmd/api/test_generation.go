@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Test generation runs in three execution stages, each one a task on the
+// execution service whose result advances the job:
+//
+//	generate        -> the generator runs once per script line, stdout is the input
+//	validate_input  -> the validator reads every input and must exit cleanly
+//	generate_output -> the reference solution produces the expected outputs
+//
+// Inputs and outputs go straight to the blob store, and the finished tests
+// replace (or extend) the problem's tests as a new revision.
+
+const maxGeneratedTests = 500
+
+// parseGeneratorScript returns one argument list per test. Blank lines and
+// lines starting with # are skipped.
+func parseGeneratorScript(script string) ([][]string, error) {
+	var invocations [][]string
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		invocations = append(invocations, strings.Fields(line))
+	}
+	if len(invocations) == 0 {
+		return nil, errors.New("generator script has no invocations")
+	}
+	if len(invocations) > maxGeneratedTests {
+		return nil, fmt.Errorf("generator script has more than %d invocations", maxGeneratedTests)
+	}
+	return invocations, nil
+}
+
+// StartTestGeneration creates a generation job for the problem and queues
+// its generator run.
+func (s *serviceImpl) StartTestGeneration(ctx context.Context, problemID, userID int, replace bool) (int, error) {
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return 0, err
+	}
+	if problem.Generator == nil {
+		return 0, errors.New("problem has no generator")
+	}
+	if problem.SolutionCode == "" {
+		return 0, errors.New("problem has no reference solution")
+	}
+	invocations, err := parseGeneratorScript(problem.GeneratorScript)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var jobID int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO test_generation_jobs (problem_id, created_by, replace_tests)
+		VALUES ($1, $2, $3) RETURNING id`,
+		problemID, userID, replace,
+	).Scan(&jobID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create generation job: %w", err)
+	}
+
+	testCases := make([]TestCase, len(invocations))
+	for i, args := range invocations {
+		testCases[i] = TestCase{ID: i + 1, Args: args}
+	}
+
+	err = s.redis.ExecuteCode(ctx, ExecutionPayload{
+		ID:            jobID,
+		Language:      problem.Generator.Language,
+		Code:          problem.Generator.Code,
+		TestCases:     testCases,
+		TimeLimitMS:   maxTimeLimitMS,
+		MemoryLimitKB: maxMemoryLimitKB,
+		ExecutionType: EXECUTION_GENERATE,
+		ProblemID:     problemID,
+	})
+	if err != nil {
+		s.failTestGeneration(ctx, jobID, "failed to queue generator: "+err.Error(), nil)
+		return 0, fmt.Errorf("failed to queue generator: %w", err)
+	}
+	return jobID, nil
+}
+
+// HandleGenerationResult advances a generation job once one of its stages
+// comes back from the execution service.
+func (s *serviceImpl) HandleGenerationResult(ctx context.Context, er *ExecutionResponse) error {
+	jobID := er.SubmissionID
+
+	var problemID int
+	var createdBy sql.NullInt64
+	var status GenerationStatus
+	var replace bool
+	var inputHashes []string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT problem_id, created_by, status, replace_tests, COALESCE(input_hashes, '{}')
+		FROM test_generation_jobs WHERE id = $1`, jobID,
+	).Scan(&problemID, &createdBy, &status, &replace, pq.Array(&inputHashes))
+	if err != nil {
+		return fmt.Errorf("failed to load generation job %d: %w", jobID, err)
+	}
+
+	// Ignore results that don't belong to the job's current stage
+	expected := map[ExecutionType]GenerationStatus{
+		EXECUTION_GENERATE:        GENERATION_STATUS_GENERATING,
+		EXECUTION_VALIDATE_INPUT:  GENERATION_STATUS_VALIDATING,
+		EXECUTION_GENERATE_OUTPUT: GENERATION_STATUS_SOLVING,
+	}
+	if expected[er.ExecutionType] != status {
+		return fmt.Errorf("generation job %d is %s, ignoring %s result", jobID, status, er.ExecutionType)
+	}
+
+	for _, res := range er.Results {
+		if res.Status != string(SUBMISSION_STATUS_ACCEPTED) {
+			msg := fmt.Sprintf("%s failed on test %d: %s", er.ExecutionType, res.ID, res.Status)
+			return s.failTestGeneration(ctx, jobID, msg, er.Results)
+		}
+	}
+
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return s.failTestGeneration(ctx, jobID, err.Error(), nil)
+	}
+
+	switch er.ExecutionType {
+	case EXECUTION_GENERATE:
+		hashes, err := s.storeGenerationOutputs(ctx, er.Results)
+		if err != nil {
+			return s.failTestGeneration(ctx, jobID, err.Error(), nil)
+		}
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE test_generation_jobs SET input_hashes = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`, jobID, pq.Array(hashes))
+		if err != nil {
+			return fmt.Errorf("failed to update generation job: %w", err)
+		}
+
+		if problem.Validator != nil {
+			return s.queueGenerationStage(ctx, jobID, problem, EXECUTION_VALIDATE_INPUT, hashes)
+		}
+		return s.queueGenerationStage(ctx, jobID, problem, EXECUTION_GENERATE_OUTPUT, hashes)
+
+	case EXECUTION_VALIDATE_INPUT:
+		return s.queueGenerationStage(ctx, jobID, problem, EXECUTION_GENERATE_OUTPUT, inputHashes)
+
+	case EXECUTION_GENERATE_OUTPUT:
+		outputHashes, err := s.storeGenerationOutputs(ctx, er.Results)
+		if err != nil {
+			return s.failTestGeneration(ctx, jobID, err.Error(), nil)
+		}
+		if len(outputHashes) != len(inputHashes) {
+			return s.failTestGeneration(ctx, jobID, "solution results don't match the generated inputs", nil)
+		}
+
+		testCases := make([]TestCase, len(inputHashes))
+		for i := range inputHashes {
+			testCases[i] = TestCase{InputHash: inputHashes[i], ExpectedOutputHash: outputHashes[i]}
+		}
+		// Keep small tests inline like any other, so they show up in the admin form
+		if err := s.loadTestCaseData(ctx, testCases); err != nil {
+			return s.failTestGeneration(ctx, jobID, err.Error(), nil)
+		}
+
+		if replace {
+			problem.TestCases = testCases
+		} else {
+			problem.TestCases = append(problem.TestCases, testCases...)
+		}
+
+		editorID := 0
+		if createdBy.Valid {
+			editorID = int(createdBy.Int64)
+		}
+		if err := s.UpdateProblemByID(ctx, problemID, editorID, problem); err != nil {
+			return s.failTestGeneration(ctx, jobID, err.Error(), nil)
+		}
+
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE test_generation_jobs
+			SET status = $2, output_hashes = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`, jobID, GENERATION_STATUS_COMPLETED, pq.Array(outputHashes))
+		if err != nil {
+			return fmt.Errorf("failed to update generation job: %w", err)
+		}
+	}
+	return nil
+}
+
+// queueGenerationStage moves the job to the given stage and queues its run
+// over the generated inputs.
+func (s *serviceImpl) queueGenerationStage(ctx context.Context, jobID int, problem *ProblemDetail, stage ExecutionType, inputHashes []string) error {
+	payload := ExecutionPayload{
+		ID:            jobID,
+		TimeLimitMS:   maxTimeLimitMS,
+		MemoryLimitKB: maxMemoryLimitKB,
+		ExecutionType: stage,
+		ProblemID:     problem.ID,
+	}
+
+	status := GENERATION_STATUS_VALIDATING
+	if stage == EXECUTION_GENERATE_OUTPUT {
+		status = GENERATION_STATUS_SOLVING
+		payload.Language = problem.SolutionLanguage
+		payload.Code = problem.SolutionCode
+		payload.TimeLimitMS, payload.MemoryLimitKB = problemLimits(problem, problem.SolutionLanguage)
+	} else {
+		payload.Language = problem.Validator.Language
+		payload.Code = problem.Validator.Code
+	}
+
+	payload.TestCases = make([]TestCase, len(inputHashes))
+	for i, hash := range inputHashes {
+		payload.TestCases[i] = TestCase{ID: i + 1, InputHash: hash}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE test_generation_jobs SET status = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, jobID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update generation job: %w", err)
+	}
+
+	if err := s.redis.ExecuteCode(ctx, payload); err != nil {
+		return s.failTestGeneration(ctx, jobID, fmt.Sprintf("failed to queue %s: %s", stage, err), nil)
+	}
+	return nil
+}
+
+// storeGenerationOutputs puts every run's stdout in the blob store, in test
+// order. The worker trims output, so the trailing newline is restored here.
+func (s *serviceImpl) storeGenerationOutputs(ctx context.Context, results []TestResult) ([]string, error) {
+	hashes := make([]string, len(results))
+	for i, res := range results {
+		hash, err := s.blobs.Put(ctx, []byte(res.Output+"\n"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store generated data: %w", err)
+		}
+		hashes[i] = hash
+	}
+	return hashes, nil
+}
+
+// failTestGeneration marks the job as failed, keeping a trimmed copy of the
+// failing stage's results for the author.
+func (s *serviceImpl) failTestGeneration(ctx context.Context, jobID int, message string, results []TestResult) error {
+	var report any
+	if results != nil {
+		data, err := json.Marshal(trimTestResults(results))
+		if err != nil {
+			return err
+		}
+		report = string(data)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE test_generation_jobs
+		SET status = $2, error = $3, report = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, jobID, GENERATION_STATUS_FAILED, message, report)
+	if err != nil {
+		return fmt.Errorf("failed to update generation job: %w", err)
+	}
+	return nil
+}
+
+func (s *serviceImpl) GetTestGenerationJob(ctx context.Context, jobID int) (*TestGenerationJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var job TestGenerationJob
+	var report []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, problem_id, created_by, status, replace_tests,
+		       COALESCE(cardinality(input_hashes), 0), report, error, created_at, updated_at
+		FROM test_generation_jobs WHERE id = $1`, jobID,
+	).Scan(&job.ID, &job.ProblemID, &job.CreatedBy, &job.Status, &job.Replace,
+		&job.TestCount, &report, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("generation job not found")
+		}
+		return nil, fmt.Errorf("failed to get generation job: %w", err)
+	}
+
+	if report != nil {
+		if err := json.Unmarshal(report, &job.Report); err != nil {
+			return nil, fmt.Errorf("failed to decode generation report: %w", err)
+		}
+	}
+	return &job, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"oj-be/prompts"
+)
+
+// Test proposals help authors cover edge cases. The AI provider suggests
+// inputs from the description and constraints (an AI job), then each input
+// runs through two execution stages:
+//
+//	propose_validate -> the input validator, inputs it rejects are marked invalid
+//	propose_output   -> the reference solution produces the expected output
+//
+// Unlike test generation a failing candidate only drops itself. The ready
+// ones wait for the author to accept them into the problem's tests.
+
+const (
+	defaultTestProposals = 10
+	maxTestProposals     = 20
+)
+
+var (
+	ErrNoReferenceSolution = errors.New("problem has no reference solution")
+	ErrNoReadyProposals    = errors.New("none of the proposals are ready to accept")
+)
+
+// StartTestProposals queues an AI job that proposes count test cases for
+// the problem. Poll the job at /ai-jobs/{id}, then list the proposals.
+func (s *serviceImpl) StartTestProposals(ctx context.Context, problemID, userID, count int) (int, error) {
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return 0, err
+	}
+	if problem.SolutionCode == "" {
+		return 0, ErrNoReferenceSolution
+	}
+	if count <= 0 {
+		count = defaultTestProposals
+	}
+	return s.EnqueueAIJob(ctx, AI_JOB_TEST_CASES, userID, problemID, AIJobInput{Count: min(count, maxTestProposals)})
+}
+
+type testCandidate struct {
+	Input  string `json:"input"`
+	Reason string `json:"reason"`
+}
+
+// parseTestCandidates reads the JSON array the model was asked for, which
+// may come wrapped in prose or a code fence.
+func parseTestCandidates(text string, limit int) ([]testCandidate, error) {
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("%w: no test cases in the response", ErrLLMUnavailable)
+	}
+	var raw []testCandidate
+	if err := json.Unmarshal([]byte(text[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("%w: invalid test cases: %v", ErrLLMUnavailable, err)
+	}
+
+	seen := map[string]bool{}
+	var candidates []testCandidate
+	for _, c := range raw {
+		c.Input = strings.TrimSpace(c.Input)
+		if c.Input == "" || len(c.Input) > maxInlineTestDataSize || seen[c.Input] {
+			continue
+		}
+		seen[c.Input] = true
+		c.Input += "\n"
+		candidates = append(candidates, c)
+		if len(candidates) == limit {
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no usable test cases in the response", ErrLLMUnavailable)
+	}
+	return candidates, nil
+}
+
+// ProposeTestCases runs an AI_JOB_TEST_CASES job: it asks for candidate
+// inputs and starts checking them.
+func (ai *AI) ProposeTestCases(ctx context.Context, job *AIJob) (result, promptVersion string, err error) {
+	problem, err := ai.service.AdminGetProblemByID(ctx, job.ProblemID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch problem for AI: %w", err)
+	}
+	if problem.SolutionCode == "" {
+		return "", "", ErrNoReferenceSolution
+	}
+
+	count := job.Input.Count
+	if count <= 0 {
+		count = defaultTestProposals
+	}
+	prompt, err := ai.prompts.Render(prompts.TestCases, prompts.Data{Problem: promptProblem(problem), Count: count})
+	if err != nil {
+		return "", "", err
+	}
+	// Some randomness gives more varied cases, and a different answer on retry
+	call := aiCall{feature: AI_FEATURE_TEST_CASES, problemID: job.ProblemID, promptVersion: prompt.Version}
+	if job.UserID != nil {
+		call.userID = *job.UserID
+	}
+	text, err := ai.generate(ctx, call, LLMRequest{Prompt: prompt.Text, Temperature: 0.7})
+	if err != nil {
+		return "", "", err
+	}
+	candidates, err := parseTestCandidates(text, count)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := ai.service.addTestProposals(ctx, job.ID, problem, candidates, prompt.Version); err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("Proposed %d test cases", len(candidates)), prompt.Version, nil
+}
+
+// addTestProposals stores the candidates and queues their first check.
+func (s *serviceImpl) addTestProposals(ctx context.Context, jobID int, problem *ProblemDetail, candidates []testCandidate, promptVersion string) error {
+	stage, status := EXECUTION_PROPOSE_OUTPUT, PROPOSAL_STATUS_SOLVING
+	if problem.Validator != nil {
+		stage, status = EXECUTION_PROPOSE_VALIDATE, PROPOSAL_STATUS_VALIDATING
+	}
+
+	runs := make([]TestCase, len(candidates))
+	for i, c := range candidates {
+		hash, err := s.blobs.Put(ctx, []byte(c.Input))
+		if err != nil {
+			return fmt.Errorf("failed to store proposed input: %w", err)
+		}
+		runs[i].InputHash = hash
+
+		err = s.db.QueryRowContext(ctx, `
+			INSERT INTO test_proposals (problem_id, ai_job_id, input_hash, rationale, status, prompt_version)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			problem.ID, jobID, hash, strings.TrimSpace(c.Reason), status, promptVersion,
+		).Scan(&runs[i].ID)
+		if err != nil {
+			return fmt.Errorf("failed to save test proposal: %w", err)
+		}
+	}
+	return s.queueProposalStage(ctx, jobID, problem, stage, runs)
+}
+
+// queueProposalStage runs the validator or the reference solution over the
+// proposals. Test case IDs are proposal IDs, so results map back to them.
+func (s *serviceImpl) queueProposalStage(ctx context.Context, jobID int, problem *ProblemDetail, stage ExecutionType, runs []TestCase) error {
+	payload := ExecutionPayload{
+		ID:            jobID,
+		TestCases:     runs,
+		TimeLimitMS:   maxTimeLimitMS,
+		MemoryLimitKB: maxMemoryLimitKB,
+		ExecutionType: stage,
+		ProblemID:     problem.ID,
+	}
+	if stage == EXECUTION_PROPOSE_OUTPUT {
+		payload.Language = problem.SolutionLanguage
+		payload.Code = problem.SolutionCode
+		payload.TimeLimitMS, payload.MemoryLimitKB = problemLimits(problem, problem.SolutionLanguage)
+	} else {
+		payload.Language = problem.Validator.Language
+		payload.Code = problem.Validator.Code
+	}
+
+	if err := s.redis.ExecuteCode(ctx, payload); err != nil {
+		ids := make([]int64, len(runs))
+		for i, run := range runs {
+			ids[i] = int64(run.ID)
+		}
+		s.db.ExecContext(ctx, `
+			UPDATE test_proposals SET status = $2, message = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ANY($1)`, pq.Array(ids), PROPOSAL_STATUS_FAILED, "failed to queue "+string(stage))
+		return fmt.Errorf("failed to queue %s: %w", stage, err)
+	}
+	return nil
+}
+
+// HandleProposalResult records a check of proposed tests and queues the
+// reference solution on the inputs that passed the validator.
+func (s *serviceImpl) HandleProposalResult(ctx context.Context, er *ExecutionResponse) error {
+	expected := PROPOSAL_STATUS_VALIDATING
+	if er.ExecutionType == EXECUTION_PROPOSE_OUTPUT {
+		expected = PROPOSAL_STATUS_SOLVING
+	}
+
+	var problemID int
+	var passed []TestCase
+	for _, res := range er.Results {
+		var inputHash string
+		err := s.db.QueryRowContext(ctx, `
+			SELECT problem_id, input_hash FROM test_proposals WHERE id = $1 AND status = $2`,
+			res.ID, expected).Scan(&problemID, &inputHash)
+		if err != nil {
+			// Dismissed while it ran, or a stale result
+			continue
+		}
+
+		if res.Status != string(SUBMISSION_STATUS_ACCEPTED) {
+			status := PROPOSAL_STATUS_INVALID
+			if er.ExecutionType == EXECUTION_PROPOSE_OUTPUT {
+				status = PROPOSAL_STATUS_FAILED
+			}
+			message := res.Status
+			if out := strings.TrimSpace(res.Output); out != "" {
+				message += ": " + truncate(out, maxReportDataLen)
+			}
+			err = s.setProposalStatus(ctx, res.ID, status, "", message)
+		} else if er.ExecutionType == EXECUTION_PROPOSE_VALIDATE {
+			passed = append(passed, TestCase{ID: res.ID, InputHash: inputHash})
+			err = s.setProposalStatus(ctx, res.ID, PROPOSAL_STATUS_SOLVING, "", "")
+		} else {
+			var hash string
+			hash, err = s.blobs.Put(ctx, []byte(res.Output+"\n"))
+			if err == nil {
+				err = s.setProposalStatus(ctx, res.ID, PROPOSAL_STATUS_READY, hash, "")
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update test proposal %d: %w", res.ID, err)
+		}
+	}
+
+	if len(passed) == 0 {
+		return nil
+	}
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return err
+	}
+	return s.queueProposalStage(ctx, er.SubmissionID, problem, EXECUTION_PROPOSE_OUTPUT, passed)
+}
+
+func (s *serviceImpl) setProposalStatus(ctx context.Context, id int, status TestProposalStatus, outputHash, message string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE test_proposals
+		SET status = $2, output_hash = COALESCE(NULLIF($3, ''), output_hash), message = NULLIF($4, ''),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id, status, outputHash, message)
+	return err
+}
+
+// GetTestProposals lists the problem's proposals, newest first, leaving out
+// dismissed ones.
+func (s *serviceImpl) GetTestProposals(ctx context.Context, problemID int) ([]TestProposal, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, problem_id, ai_job_id, input_hash, COALESCE(output_hash, ''), rationale, status, message,
+		       COALESCE(prompt_version, ''), created_at
+		FROM test_proposals
+		WHERE problem_id = $1 AND status <> $2
+		ORDER BY id DESC`, problemID, PROPOSAL_STATUS_DISMISSED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get test proposals: %w", err)
+	}
+	defer rows.Close()
+
+	proposals := []TestProposal{}
+	var data []TestCase
+	for rows.Next() {
+		var p TestProposal
+		var tc TestCase
+		err := rows.Scan(&p.ID, &p.ProblemID, &p.AIJobID, &tc.InputHash, &tc.ExpectedOutputHash, &p.Rationale,
+			&p.Status, &p.Message, &p.PromptVersion, &p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, p)
+		data = append(data, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTestCaseData(ctx, data); err != nil {
+		return nil, fmt.Errorf("failed to load proposed test data: %w", err)
+	}
+	for i := range proposals {
+		proposals[i].Input = data[i].Input
+		proposals[i].ExpectedOutput = truncate(data[i].ExpectedOutput, maxInlineTestDataSize)
+	}
+	return proposals, nil
+}
+
+// AcceptTestProposals adds the ready proposals among ids to the problem's
+// tests as a new revision and returns how many were added.
+func (s *serviceImpl) AcceptTestProposals(ctx context.Context, problemID, editorID int, ids []int) (int, error) {
+	// Claimed up front so two editors accepting at once don't add the same tests twice
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE test_proposals SET status = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE problem_id = $1 AND id = ANY($2) AND status = $3
+		RETURNING id, input_hash, output_hash`,
+		problemID, pq.Array(ids), PROPOSAL_STATUS_READY, PROPOSAL_STATUS_ACCEPTED)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim test proposals: %w", err)
+	}
+	defer rows.Close()
+
+	var accepted []int64
+	var testCases []TestCase
+	for rows.Next() {
+		var id int64
+		var tc TestCase
+		if err := rows.Scan(&id, &tc.InputHash, &tc.ExpectedOutputHash); err != nil {
+			return 0, err
+		}
+		accepted = append(accepted, id)
+		testCases = append(testCases, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(testCases) == 0 {
+		return 0, ErrNoReadyProposals
+	}
+
+	if err := s.addProposedTests(ctx, problemID, editorID, testCases); err != nil {
+		_, revertErr := s.db.ExecContext(context.WithoutCancel(ctx), `
+			UPDATE test_proposals SET status = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ANY($1)`, pq.Array(accepted), PROPOSAL_STATUS_READY)
+		if revertErr != nil {
+			return 0, errors.Join(err, fmt.Errorf("failed to unclaim test proposals: %w", revertErr))
+		}
+		return 0, err
+	}
+	return len(testCases), nil
+}
+
+// addProposedTests appends the tests to the problem as a new revision.
+func (s *serviceImpl) addProposedTests(ctx context.Context, problemID, editorID int, testCases []TestCase) error {
+	// Keep small tests inline like any other, so they show up in the admin form
+	if err := s.loadTestCaseData(ctx, testCases); err != nil {
+		return err
+	}
+	problem, err := s.AdminGetProblemByID(ctx, problemID)
+	if err != nil {
+		return err
+	}
+	problem.TestCases = append(problem.TestCases, testCases...)
+	return s.UpdateProblemByID(ctx, problemID, editorID, problem)
+}
+
+// DismissTestProposals hides proposals the author doesn't want. Accepted
+// ones are already tests and stay as they are.
+func (s *serviceImpl) DismissTestProposals(ctx context.Context, problemID int, ids []int) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE test_proposals SET status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE problem_id = $1 AND id = ANY($2) AND status <> $4`,
+		problemID, pq.Array(ids), PROPOSAL_STATUS_DISMISSED, PROPOSAL_STATUS_ACCEPTED)
+	if err != nil {
+		return fmt.Errorf("failed to dismiss test proposals: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication uses TOTP (RFC 6238: HMAC-SHA1, 30 second steps,
+// 6 digits), which every authenticator app supports. A secret is stored on
+// setup and only enforced once a first code confirms the app has it. Each
+// accepted code's step is remembered so a code can't be replayed, and ten
+// single-use recovery codes cover a lost device.
+//
+// Users with admin-level permissions must use it: their password alone only
+// gets them a login challenge, which they complete (enrolling first if
+// needed) at /login/2fa.
+
+const (
+	totpIssuer           = "OJ"
+	totpPeriod           = 30
+	totpDigits           = 6
+	totpSkew             = 1 // steps of clock drift accepted either way
+	recoveryCodeCount    = 10
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5 // codes a user may try per challengeLockout
+	challengeLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("login challenge expired, log in again")
+	ErrTooManyAttempts      = errors.New("too many two-factor attempts, try again later")
+)
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// requiresTwoFactor reports whether the permissions are sensitive enough to
+// make 2FA mandatory.
+func requiresTwoFactor(perms *Permissions) bool {
+	return perms.Has(PERMISSION_USER_MANAGE) || perms.Has(PERMISSION_PROBLEM_MANAGE)
+}
+
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%uint32(math.Pow10(totpDigits)))
+}
+
+// checkTOTP returns the step the code belongs to if it is valid now and
+// newer than lastStep.
+func checkTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	key, err := base32NoPad.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpURI(username, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32NoPad.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+// TwoFactorEnabled reports whether the user has confirmed a TOTP secret.
+func (s *serviceImpl) TwoFactorEnabled(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, `SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	return enabled, nil
+}
+
+// BeginTwoFactorSetup stores a new secret and returns it along with its
+// provisioning URI for the authenticator app.
+func (s *serviceImpl) BeginTwoFactorSetup(ctx context.Context, userID int) (string, string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	secret := base32NoPad.EncodeToString(key)
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	var username string
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users SET totp_secret = $2, totp_last_step = 0
+		WHERE id = $1 AND totp_enabled_at IS NULL
+		RETURNING username`, userID, secret,
+	).Scan(&username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", errors.New("two-factor authentication is already enabled")
+		}
+		return "", "", fmt.Errorf("failed to start two-factor setup: %w", err)
+	}
+	return secret, totpURI(username, secret), nil
+}
+
+// EnableTwoFactor confirms the pending secret with a code from the app and
+// returns fresh recovery codes.
+func (s *serviceImpl) EnableTwoFactor(ctx context.Context, userID int, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabled bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`, userID,
+	).Scan(&secret, &enabled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if enabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	if !secret.Valid {
+		return nil, errors.New("start the two-factor setup first")
+	}
+
+	step, ok := checkTOTP(secret.String, strings.TrimSpace(code), 0, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $2 WHERE id = $1`, userID, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking a current code. Users who
+// must use 2FA can't turn it off.
+func (s *serviceImpl) DisableTwoFactor(ctx context.Context, userID int, code string) error {
+	perms, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if requiresTwoFactor(perms) {
+		return errors.New("two-factor authentication is mandatory for your role")
+	}
+	if err := s.VerifySecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a current code.
+func (s *serviceImpl) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.VerifySecondFactor(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashToken(code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor accepts a TOTP code or an unused recovery code.
+func (s *serviceImpl) VerifySecondFactor(ctx context.Context, userID int, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, maxQueryTime)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var lastStep int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_last_step FROM users
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL FOR UPDATE`, userID,
+	).Scan(&secret, &lastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("two-factor authentication is not enabled")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := checkTOTP(secret.String, code, lastStep, time.Now()); ok {
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET totp_last_step = $2 WHERE id = $1`, userID, step); err != nil {
+			return fmt.Errorf("failed to record two-factor code: %w", err)
+		}
+	} else {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+			userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return fmt.Errorf("failed to use recovery code: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// LoginChallenge is a password login waiting for its second factor.
+type LoginChallenge struct {
+	UserID        int
+	Role          string
+	SetupRequired bool // the user must enroll before finishing the login
+}
+
+func loginChallengeKey(token string) string {
+	return "login_challenge:" + hashToken(token)
+}
+
+func challengeAttemptsKey(userID int) string {
+	return "login_challenge_attempts:" + strconv.Itoa(userID)
+}
+
+func (s *serviceImpl) CreateLoginChallenge(ctx context.Context, challenge LoginChallenge) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Set(ctx, loginChallengeKey(token), challenge, loginChallengeTTL); err != nil {
+		return "", fmt.Errorf("failed to store login challenge: %w", err)
+	}
+	return token, nil
+}
+
+func (s *serviceImpl) GetLoginChallenge(ctx context.Context, token string) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	if err := s.redis.Get(ctx, loginChallengeKey(token), &challenge); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	return &challenge, nil
+}
+
+// CompleteLoginChallenge checks the second factor of a login challenge,
+// enrolling the user first when the challenge requires it, and returns the
+// challenge along with any new recovery codes. Attempts are counted per user,
+// since every password login starts a new challenge, and too many of them
+// lock the user out for challengeLockout.
+func (s *serviceImpl) CompleteLoginChallenge(ctx context.Context, token, code string) (*LoginChallenge, []string, error) {
+	challenge, err := s.GetLoginChallenge(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Counted before the code is checked, so parallel guesses can't get past the limit
+	attempts, err := s.redis.Increment(ctx, challengeAttemptsKey(challenge.UserID), challengeLockout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count two-factor attempt: %w", err)
+	}
+	if attempts > maxChallengeAttempts {
+		s.redis.Delete(ctx, loginChallengeKey(token))
+		return nil, nil, ErrTooManyAttempts
+	}
+
+	var codes []string
+	if challenge.SetupRequired {
+		codes, err = s.EnableTwoFactor(ctx, challenge.UserID, code)
+	} else {
+		err = s.VerifySecondFactor(ctx, challenge.UserID, code)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.redis.Delete(ctx, loginChallengeKey(token))
+	s.redis.Delete(ctx, challengeAttemptsKey(challenge.UserID))
+	return challenge, codes, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// The SHA1 vectors of RFC 6238 appendix B, cut to our 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := base32NoPad.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	code := func(step int64) string { return totpCode(key, step) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", secret, code(current), 0, current, true},
+		{"previous step", secret, code(current - 1), 0, current - 1, true},
+		{"next step", secret, code(current + 1), 0, current + 1, true},
+		{"outside the window before", secret, code(current - 2), 0, 0, false},
+		{"outside the window after", secret, code(current + 2), 0, 0, false},
+		{"replayed", secret, code(current), current, 0, false},
+		{"older than the last used", secret, code(current - 1), current, 0, false},
+		{"newer than the last used", secret, code(current + 1), current, current + 1, true},
+		{"wrong code", secret, "000000", 0, 0, false},
+		{"too short", secret, code(current)[:5], 0, 0, false},
+		{"invalid secret", "not base32!", code(current), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := checkTOTP(tt.secret, tt.code, tt.lastStep, now)
+			if step != tt.wantStep || ok != tt.wantOK {
+				t.Errorf("checkTOTP = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecoveryCode(t *testing.T) {
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := map[string]bool{}
+	for range 100 {
+		code, err := newRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !format.MatchString(code) {
+			t.Fatalf("recovery code %q isn't formatted like abcd-efgh", code)
+		}
+		if seen[code] {
+			t.Fatalf("recovery code %q generated twice", code)
+		}
+		seen[code] = true
+		// Codes are stored as generated and looked up normalized
+		if got := normalizeRecoveryCode(code); got != code {
+			t.Errorf("normalizeRecoveryCode(%q) = %q", code, got)
+		}
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct{ code, want string }{
+		{"abcd-efgh", "abcd-efgh"},
+		{"ABCD-EFGH", "abcd-efgh"},
+		{"  abcd-efgh\n", "abcd-efgh"},
+		{"abcd - efgh", "abcd-efgh"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.code); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -8,31 +8,23 @@ import (
 	"time"
 )
 
-// Helper functions for password hashing
-func hashPassword(pw string) (string, error) {
-	// Just a mock hash function, use bcrypt or a better hashing algorithm in production.
-	return pw + "_hash", nil
-}
-
-// func comparePassword(hash, pw string) error {
-// 	if hash != pw+"_hashed" {
-// 		return fmt.Errorf("wrong password")
-// 	}
-// 	return nil
-// }
-
-func setAuthCookie(w http.ResponseWriter, token string) {
+func setAuthCookie(w http.ResponseWriter, name, token string, expires time.Time) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     AuthCookieName,
+		Name:     name,
 		Value:    token,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteNoneMode,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  expires,
 	})
 }
 
+func clearAuthCookies(w http.ResponseWriter) {
+	setAuthCookie(w, AuthCookieName, "", time.Unix(0, 0))
+	setAuthCookie(w, RefreshCookieName, "", time.Unix(0, 0))
+}
+
 func GetContestProblemKey(contestId, problemId int) string {
 	return fmt.Sprintf("%d:%d", contestId, problemId)
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptSecret reads a line without echoing it where stty is available.
+func promptSecret(label string) (string, error) {
+	hide := exec.Command("stty", "-echo")
+	hide.Stdin = os.Stdin
+	if hide.Run() == nil {
+		defer func() {
+			show := exec.Command("stty", "echo")
+			show.Stdin = os.Stdin
+			show.Run()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	return prompt(label)
+}
+
+// exactArgs parses the flags and checks the number of arguments left.
+func exactArgs(fs *flag.FlagSet, args []string, n int, names string) ([]string, error) {
+	fs.Parse(args)
+	if fs.NArg() != n {
+		return nil, fmt.Errorf("usage: %s %s", fs.Name(), names)
+	}
+	return fs.Args(), nil
+}
+
+type loginResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	SetupRequired     bool   `json:"setup_required"`
+	Challenge         string `json:"challenge"`
+}
+
+// runLogin saves an API token, or logs in with a password and saves the
+// session cookies, which the client refreshes as they expire.
+func runLogin(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj login", flag.ExitOnError)
+	server := fs.String("server", "", "judge URL, e.g. "+defaultServer)
+	token := fs.String("token", "", "personal API token, created under /tokens")
+	if _, err := exactArgs(fs, args, 0, "[-server URL] [-token TOKEN]"); err != nil {
+		return err
+	}
+
+	if *server != "" {
+		c.cfg.Server = strings.TrimRight(*server, "/")
+	}
+	c.cfg.Token, c.cfg.AccessToken, c.cfg.RefreshToken = strings.TrimSpace(*token), "", ""
+	c.use(c.cfg.Server, c.cfg.Token)
+
+	if *token == "" {
+		if err := passwordLogin(c); err != nil {
+			return err
+		}
+	}
+
+	var user User
+	if err := c.Do(http.MethodGet, "/me", nil, &user); err != nil {
+		return err
+	}
+	if err := c.cfg.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s as %s\n", c.server, user.Username)
+	return nil
+}
+
+func passwordLogin(c *Client) error {
+	username, err := prompt("Username: ")
+	if err != nil {
+		return err
+	}
+	password, err := promptSecret("Password: ")
+	if err != nil {
+		return err
+	}
+
+	var resp loginResponse
+	err = c.Do(http.MethodPost, "/login", map[string]string{"Username": username, "Password": password}, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.TwoFactorRequired {
+		return nil
+	}
+	if resp.SetupRequired {
+		return errors.New("your account needs two-factor authentication, set it up by logging in on the website first")
+	}
+
+	code, err := prompt("Two-factor code (or recovery code): ")
+	if err != nil {
+		return err
+	}
+	return c.Do(http.MethodPost, "/login/2fa", map[string]string{"Challenge": resp.Challenge, "Code": code}, nil)
+}
+
+func runLogout(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj logout", flag.ExitOnError)
+	if _, err := exactArgs(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	if c.cfg.RefreshToken != "" {
+		if err := c.Do(http.MethodPost, "/logout", nil, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: failed to end the session:", err)
+		}
+	}
+	c.cfg.Token, c.cfg.AccessToken, c.cfg.RefreshToken = "", "", ""
+	if err := c.cfg.save(); err != nil {
+		return err
+	}
+	fmt.Println("Logged out")
+	return nil
+}
+
+func runWhoami(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj whoami", flag.ExitOnError)
+	if _, err := exactArgs(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	var user User
+	if err := c.Do(http.MethodGet, "/me", nil, &user); err != nil {
+		return err
+	}
+	fmt.Printf("%s (%s) on %s\n", user.Username, user.Role, c.server)
+	return nil
+}
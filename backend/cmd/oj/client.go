@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultServer     = "http://localhost:8080"
+	authCookieName    = "auth_token"
+	refreshCookieName = "refresh_token"
+)
+
+// Config is saved between runs. It holds either a personal API token or the
+// cookies of a password login.
+type Config struct {
+	Server       string `json:"server"`
+	Token        string `json:"token,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// configPath is $OJ_CONFIG, or oj/config.json in the user config directory.
+func configPath() (string, error) {
+	if path := os.Getenv("OJ_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "oj", "config.json"), nil
+}
+
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+func (c *Config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// APIError is a non-2xx response. The server answers errors in plain text.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Status == http.StatusUnauthorized {
+		return fmt.Sprintf("%s (run oj login)", e.Message)
+	}
+	return e.Message
+}
+
+// Client talks to the judge. OJ_SERVER and OJ_TOKEN override the saved
+// config without changing it.
+type Client struct {
+	cfg    *Config
+	server string
+	token  string
+	http   *http.Client
+}
+
+func NewClient(cfg *Config) *Client {
+	c := &Client{cfg: cfg, http: &http.Client{Timeout: 30 * time.Second}}
+	c.use(cfg.Server, cfg.Token)
+	if server := os.Getenv("OJ_SERVER"); server != "" {
+		c.server = strings.TrimRight(server, "/")
+	}
+	if token := os.Getenv("OJ_TOKEN"); token != "" {
+		c.token = token
+	}
+	return c
+}
+
+func (c *Client) use(server, token string) {
+	if server == "" {
+		server = defaultServer
+	}
+	c.server = strings.TrimRight(server, "/")
+	c.token = token
+}
+
+// Do sends the request with the saved credentials and decodes the JSON
+// response into out, if given. An expired login is refreshed once.
+func (c *Client) Do(method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.send(method, path, payload)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.token == "" && c.cfg.RefreshToken != "" {
+		resp.Body.Close()
+		if err := c.refresh(); err != nil {
+			return err
+		}
+		if resp, err = c.send(method, path, payload); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	c.saveCookies(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) send(method, path string, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.server+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.cfg.AccessToken != "" || c.cfg.RefreshToken != "":
+		req.AddCookie(&http.Cookie{Name: authCookieName, Value: c.cfg.AccessToken})
+		req.AddCookie(&http.Cookie{Name: refreshCookieName, Value: c.cfg.RefreshToken})
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't reach %s: %w", c.server, err)
+	}
+	return resp, nil
+}
+
+func (c *Client) refresh() error {
+	resp, err := c.send(http.MethodPost, "/refresh", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.cfg.AccessToken, c.cfg.RefreshToken = "", ""
+		c.cfg.save()
+		return &APIError{Status: http.StatusUnauthorized, Message: "login expired"}
+	}
+	c.saveCookies(resp)
+	return nil
+}
+
+// saveCookies keeps the session cookies the server set, which rotate on
+// every refresh.
+func (c *Client) saveCookies(resp *http.Response) {
+	changed := false
+	for _, cookie := range resp.Cookies() {
+		switch cookie.Name {
+		case authCookieName:
+			c.cfg.AccessToken, changed = cookie.Value, true
+		case refreshCookieName:
+			c.cfg.RefreshToken, changed = cookie.Value, true
+		}
+	}
+	if changed {
+		if err := c.cfg.save(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: failed to save login:", err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func contestID(arg string) (string, error) {
+	if _, err := strconv.Atoi(arg); err != nil {
+		return "", fmt.Errorf("invalid contest id %q", arg)
+	}
+	return arg, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func runContests(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj contests", flag.ExitOnError)
+	if _, err := exactArgs(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	var contests []Contest
+	if err := c.Do(http.MethodGet, "/contests", nil, &contests); err != nil {
+		return err
+	}
+
+	tw := newTabWriter()
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tSTARTS\tENDS")
+	for _, ct := range contests {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", ct.ID, ct.Name, ct.Status, formatTime(ct.StartTime), formatTime(ct.EndTime))
+	}
+	return tw.Flush()
+}
+
+func runContest(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj contest", flag.ExitOnError)
+	rest, err := exactArgs(fs, args, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := contestID(rest[0])
+	if err != nil {
+		return err
+	}
+
+	var ct Contest
+	if err := c.Do(http.MethodGet, "/contest/"+id, nil, &ct); err != nil {
+		return err
+	}
+	fmt.Printf("%s (%s)\n%s to %s\n\n", ct.Name, ct.Status, formatTime(ct.StartTime), formatTime(ct.EndTime))
+
+	tw := newTabWriter()
+	fmt.Fprintln(tw, "SLUG\tTITLE\tDIFFICULTY\tPOINTS")
+	for _, p := range ct.Problems {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", p.Slug, p.Title, p.Difficulty, p.MaxPoints)
+	}
+	return tw.Flush()
+}
+
+func runJoin(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj join", flag.ExitOnError)
+	rest, err := exactArgs(fs, args, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := contestID(rest[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.Do(http.MethodPost, "/contest/"+id+"/join", nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Joined contest %s, submit with oj submit -contest %s FILE\n", id, id)
+	return nil
+}
+
+func runStandings(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj standings", flag.ExitOnError)
+	rest, err := exactArgs(fs, args, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := contestID(rest[0])
+	if err != nil {
+		return err
+	}
+
+	var participants []ContestParticipant
+	if err := c.Do(http.MethodGet, "/contest/"+id+"/leaderboard", nil, &participants); err != nil {
+		return err
+	}
+	if len(participants) == 0 {
+		fmt.Println("No participants yet")
+		return nil
+	}
+
+	tw := newTabWriter()
+	fmt.Fprintln(tw, "RANK\tUSER\tSCORE")
+	for i, p := range participants {
+		fmt.Fprintf(tw, "%d\t%s\t%d\n", i+1, p.Username, p.Score)
+	}
+	return tw.Flush()
+}
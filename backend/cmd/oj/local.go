@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local runs build and run solutions the way the judge's workers do, so the
+// examples give the same answers here.
+
+var languageByExt = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".cpp":  "cpp",
+	".cc":   "cpp",
+	".cxx":  "cpp",
+	".c":    "c",
+	".java": "java",
+}
+
+func detectLanguage(file, lang string) (string, error) {
+	if lang != "" {
+		return lang, nil
+	}
+	if lang, ok := languageByExt[strings.ToLower(filepath.Ext(file))]; ok {
+		return lang, nil
+	}
+	return "", fmt.Errorf("can't tell the language of %s, pass -lang", file)
+}
+
+// build compiles the solution in workDir and returns the command that runs
+// it.
+func build(lang, file, workDir string) ([]string, error) {
+	bin := filepath.Join(workDir, "main")
+	var compile *exec.Cmd
+	var run []string
+	switch lang {
+	case "python":
+		return []string{"python3", file}, nil
+	case "go":
+		compile = exec.Command("go", "build", "-o", bin, file)
+		run = []string{bin}
+	case "cpp":
+		compile = exec.Command("g++", "-O2", "-std=c++17", file, "-o", bin)
+		run = []string{bin}
+	case "c":
+		compile = exec.Command("gcc", "-O2", file, "-o", bin)
+		run = []string{bin}
+	case "java":
+		code, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		src := filepath.Join(workDir, "Main.java")
+		if err := os.WriteFile(src, code, 0644); err != nil {
+			return nil, err
+		}
+		compile = exec.Command("javac", src)
+		run = []string{"java", "-cp", workDir, "Main"}
+	default:
+		return nil, fmt.Errorf("unsupported language %q", lang)
+	}
+
+	var stderr bytes.Buffer
+	compile.Stderr = &stderr
+	if err := compile.Run(); err != nil {
+		return nil, fmt.Errorf("compilation error: %v\n%s", err, stderr.String())
+	}
+	return run, nil
+}
+
+func runTest(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj test", flag.ExitOnError)
+	lang := fs.String("lang", "", "language, guessed from the file extension by default")
+	timeout := fs.Duration("timeout", 0, "time limit per example, the problem's limit by default")
+	rest, err := exactArgs(fs, args, 1, "[-lang L] [-timeout D] FILE")
+	if err != nil {
+		return err
+	}
+	file, err := filepath.Abs(rest[0])
+	if err != nil {
+		return err
+	}
+
+	language, err := detectLanguage(file, *lang)
+	if err != nil {
+		return err
+	}
+	ref, dir, err := findProblem(file)
+	if err != nil {
+		return err
+	}
+	cases, err := loadExamples(dir)
+	if err != nil {
+		return err
+	}
+	if *timeout == 0 {
+		*timeout = 2 * time.Second
+		for _, l := range ref.Limits {
+			if l.Language == language && l.TimeLimitMS > 0 {
+				*timeout = time.Duration(l.TimeLimitMS) * time.Millisecond
+			}
+		}
+	}
+
+	workDir, err := os.MkdirTemp("", "oj-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	cmd, err := build(language, file, workDir)
+	if err != nil {
+		return err
+	}
+
+	passed := 0
+	for i, tc := range cases {
+		output, elapsed, err := runCase(cmd, tc.Input, *timeout)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			fmt.Printf("#%d time limit exceeded (%s)\n", i+1, *timeout)
+		case err != nil:
+			fmt.Printf("#%d runtime error: %v\n", i+1, err)
+		case strings.TrimSpace(output) != strings.TrimSpace(tc.ExpectedOutput):
+			fmt.Printf("#%d wrong answer (%d ms)\n", i+1, elapsed.Milliseconds())
+			fmt.Printf("  input:\n%s  expected:\n%s  got:\n%s", indent(tc.Input), indent(tc.ExpectedOutput), indent(output))
+		default:
+			fmt.Printf("#%d accepted (%d ms)\n", i+1, elapsed.Milliseconds())
+			passed++
+		}
+	}
+
+	fmt.Printf("%d/%d examples passed\n", passed, len(cases))
+	if passed != len(cases) {
+		return fmt.Errorf("%d of %d examples failed", len(cases)-passed, len(cases))
+	}
+	return nil
+}
+
+func runCase(cmd []string, input string, timeout time.Duration) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	run := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	run.Stdin = strings.NewReader(input)
+	run.Stdout = &stdout
+	run.Stderr = &stderr
+
+	start := time.Now()
+	err := run.Run()
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		return "", elapsed, ctx.Err()
+	}
+	if err != nil {
+		return "", elapsed, fmt.Errorf("%v\n%s", err, indent(stderr.String()))
+	}
+	return stdout.String(), elapsed, nil
+}
+
+func indent(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return ""
+	}
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ") + "\n"
+}
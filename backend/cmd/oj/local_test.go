@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		file    string
+		lang    string
+		want    string
+		wantErr bool
+	}{
+		{"main.go", "", "go", false},
+		{"sol.py", "", "python", false},
+		{"a.cpp", "", "cpp", false},
+		{"a.cc", "", "cpp", false},
+		{"A.CXX", "", "cpp", false},
+		{"a.c", "", "c", false},
+		{"Main.java", "", "java", false},
+		{"dir.v2/sol.PY", "", "python", false},
+		{"sol.txt", "python", "python", false},
+		{"main.go", "cpp", "cpp", false},
+		{"sol.rb", "", "", true},
+		{"Makefile", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+" "+tt.lang, func(t *testing.T) {
+			got, err := detectLanguage(tt.file, tt.lang)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectLanguage(%q, %q) error = %v, wantErr %v", tt.file, tt.lang, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("detectLanguage(%q, %q) = %q, want %q", tt.file, tt.lang, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Command oj is a command-line client for the judge: it fetches problems,
+// runs their examples locally and submits solutions through the REST API.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(c *Client, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"login", "[-server URL] [-token TOKEN]", "log in with your password or a personal API token", runLogin},
+		{"logout", "", "forget the saved login", runLogout},
+		{"whoami", "", "show the logged in user", runWhoami},
+		{"problems", "[-difficulty D] [-tag T]", "list problems", runProblems},
+		{"search", "QUERY", "search problems", runSearch},
+		{"pull", "[-dir DIR] SLUG", "download a problem's statement and examples into DIR/SLUG", runPull},
+		{"test", "[-lang L] [-timeout D] FILE", "run a solution against the downloaded examples locally", runTest},
+		{"run", "[-problem SLUG] [-lang L] FILE", "run a solution against the examples on the judge", runRun},
+		{"submit", "[-problem SLUG] [-lang L] [-contest ID] [-wait D] FILE", "submit a solution and wait for the verdict", runSubmit},
+		{"status", "ID", "show a submission's verdict", runStatus},
+		{"contests", "", "list contests", runContests},
+		{"contest", "ID", "show a contest and its problems", runContest},
+		{"join", "ID", "join a contest", runJoin},
+		{"standings", "ID", "show a contest's leaderboard", runStandings},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: oj COMMAND [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.help)
+		if cmd.usage != "" {
+			fmt.Fprintf(os.Stderr, "  %-10s   oj %s %s\n", "", cmd.name, cmd.usage)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Flags go before arguments. OJ_SERVER and OJ_TOKEN override the saved login.")
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || strings.HasPrefix(os.Args[1], "-") {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "oj:", err)
+			os.Exit(1)
+		}
+		if err := cmd.run(NewClient(cfg), os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "oj:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "oj: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// A pulled problem lives in its own folder: README.md with the statement,
+// tests/N.in and tests/N.out for every example, and problemFile so commands
+// run from the folder know which problem it is.
+const problemFile = ".oj.json"
+
+type problemRef struct {
+	ID     int      `json:"id"`
+	Slug   string   `json:"slug"`
+	Limits []Limits `json:"limits,omitempty"`
+}
+
+func newTabWriter() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func runProblems(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj problems", flag.ExitOnError)
+	difficulty := fs.String("difficulty", "", "only show easy, medium or hard problems")
+	tag := fs.String("tag", "", "only show problems with this tag")
+	if _, err := exactArgs(fs, args, 0, "[-difficulty D] [-tag T]"); err != nil {
+		return err
+	}
+
+	var problems []Problem
+	if err := c.Do(http.MethodGet, "/problems", nil, &problems); err != nil {
+		return err
+	}
+
+	tw := newTabWriter()
+	fmt.Fprintln(tw, "ID\tSLUG\tTITLE\tDIFFICULTY\tTAGS")
+	for _, p := range problems {
+		if *difficulty != "" && !strings.EqualFold(p.Difficulty, *difficulty) {
+			continue
+		}
+		if *tag != "" && !slices.ContainsFunc(p.Tags, func(t string) bool { return strings.EqualFold(t, *tag) }) {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", p.ID, p.Slug, p.Title, p.Difficulty, strings.Join(p.Tags, ", "))
+	}
+	return tw.Flush()
+}
+
+var markTags = regexp.MustCompile(`</?mark>`)
+
+func runSearch(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj search", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "maximum number of results")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: oj search [-limit N] QUERY")
+	}
+
+	q := url.Values{}
+	q.Set("q", strings.Join(fs.Args(), " "))
+	q.Set("type", "problem")
+	q.Set("limit", fmt.Sprint(*limit))
+
+	var results []SearchResult
+	if err := c.Do(http.MethodGet, "/search?"+q.Encode(), nil, &results); err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	tw := newTabWriter()
+	fmt.Fprintln(tw, "SLUG\tTITLE\tMATCH")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Slug, r.Title, strings.Join(strings.Fields(markTags.ReplaceAllString(r.Snippet, "")), " "))
+	}
+	return tw.Flush()
+}
+
+func getProblem(c *Client, slug string) (*Problem, error) {
+	var p Problem
+	if err := c.Do(http.MethodGet, "/problem/"+url.PathEscape(slug), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func runPull(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj pull", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory to create the problem folder in")
+	rest, err := exactArgs(fs, args, 1, "[-dir DIR] SLUG")
+	if err != nil {
+		return err
+	}
+
+	p, err := getProblem(c, rest[0])
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Join(*dir, p.Slug)
+	if err := os.MkdirAll(filepath.Join(root, "tests"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(root, "README.md"), []byte(problemMarkdown(p)), 0644); err != nil {
+		return err
+	}
+	for i, ex := range p.Examples {
+		base := filepath.Join(root, "tests", fmt.Sprint(i+1))
+		if err := os.WriteFile(base+".in", []byte(withNewline(ex.Input)), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(base+".out", []byte(withNewline(ex.ExpectedOutput)), 0644); err != nil {
+			return err
+		}
+	}
+
+	ref, err := json.MarshalIndent(problemRef{ID: p.ID, Slug: p.Slug, Limits: p.Limits}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(root, problemFile), ref, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %s with %d examples to %s\n", p.Title, len(p.Examples), root)
+	return nil
+}
+
+func withNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
+
+func problemMarkdown(p *Problem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", p.Title)
+	fmt.Fprintf(&b, "Difficulty: %s", p.Difficulty)
+	if len(p.Tags) > 0 {
+		fmt.Fprintf(&b, " | Tags: %s", strings.Join(p.Tags, ", "))
+	}
+	b.WriteString("\n\n")
+	b.WriteString(strings.TrimSpace(p.Description))
+	b.WriteString("\n")
+
+	if len(p.Constraints) > 0 {
+		b.WriteString("\n## Constraints\n\n")
+		for _, con := range p.Constraints {
+			fmt.Fprintf(&b, "- %s\n", con)
+		}
+	}
+	for i, ex := range p.Examples {
+		fmt.Fprintf(&b, "\n## Example %d\n\nInput:\n\n```\n%s```\n\nOutput:\n\n```\n%s```\n", i+1, withNewline(ex.Input), withNewline(ex.ExpectedOutput))
+		if ex.Explanation != "" {
+			fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(ex.Explanation))
+		}
+	}
+	if len(p.Limits) > 0 {
+		b.WriteString("\n## Limits\n\n")
+		for _, l := range p.Limits {
+			fmt.Fprintf(&b, "- %s: %d ms, %d KB\n", l.Language, l.TimeLimitMS, l.MemoryLimitKB)
+		}
+	}
+	return b.String()
+}
+
+// findProblem reads problemFile from the solution's folder or one of its
+// parents.
+func findProblem(file string) (*problemRef, string, error) {
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, problemFile))
+		if err == nil {
+			var ref problemRef
+			if err := json.Unmarshal(data, &ref); err != nil {
+				return nil, "", fmt.Errorf("invalid %s: %w", filepath.Join(dir, problemFile), err)
+			}
+			return &ref, dir, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, "", fmt.Errorf("no %s found for %s, run oj pull or pass -problem", problemFile, file)
+		}
+		dir = parent
+	}
+}
+
+// resolveProblem finds the problem by slug, or from the solution's folder.
+func resolveProblem(c *Client, slug, file string) (*problemRef, string, error) {
+	if slug != "" {
+		p, err := getProblem(c, slug)
+		if err != nil {
+			return nil, "", err
+		}
+		return &problemRef{ID: p.ID, Slug: p.Slug, Limits: p.Limits}, "", nil
+	}
+	return findProblem(file)
+}
+
+// loadExamples reads the tests folder written by oj pull.
+func loadExamples(dir string) ([]TestCase, error) {
+	inputs, err := filepath.Glob(filepath.Join(dir, "tests", "*.in"))
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(inputs, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(a, b)
+	})
+
+	var cases []TestCase
+	for _, in := range inputs {
+		input, err := os.ReadFile(in)
+		if err != nil {
+			return nil, err
+		}
+		output, err := os.ReadFile(strings.TrimSuffix(in, ".in") + ".out")
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, TestCase{Input: string(input), ExpectedOutput: string(output)})
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no examples in %s", filepath.Join(dir, "tests"))
+	}
+	return cases, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadExamples(t *testing.T) {
+	dir := t.TempDir()
+	tests := filepath.Join(dir, "tests")
+	if err := os.Mkdir(tests, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Written out of order, 10 sorts after 2
+	for _, n := range []string{"10", "1", "2"} {
+		if err := os.WriteFile(filepath.Join(tests, n+".in"), []byte("in "+n), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tests, n+".out"), []byte("out "+n), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases, err := loadExamples(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TestCase{
+		{Input: "in 1", ExpectedOutput: "out 1"},
+		{Input: "in 2", ExpectedOutput: "out 2"},
+		{Input: "in 10", ExpectedOutput: "out 10"},
+	}
+	if !slices.Equal(cases, want) {
+		t.Errorf("loadExamples() = %v, want %v", cases, want)
+	}
+}
+
+func TestLoadExamplesMissing(t *testing.T) {
+	t.Run("no tests", func(t *testing.T) {
+		if _, err := loadExamples(t.TempDir()); err == nil {
+			t.Error("loadExamples() succeeded, want an error")
+		}
+	})
+
+	t.Run("no output", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "tests"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "tests", "1.in"), []byte("in"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadExamples(dir); err == nil {
+			t.Error("loadExamples() succeeded, want an error")
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	statusPending  = "pending"
+	statusAccepted = "accepted"
+	pollInterval   = time.Second
+)
+
+type runResponse struct {
+	RunID int `json:"run_id"`
+}
+
+func runRun(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj run", flag.ExitOnError)
+	slug := fs.String("problem", "", "problem slug, read from the pulled folder by default")
+	lang := fs.String("lang", "", "language, guessed from the file extension by default")
+	wait := fs.Duration("wait", 2*time.Minute, "how long to wait for the result")
+	rest, err := exactArgs(fs, args, 1, "[-problem SLUG] [-lang L] FILE")
+	if err != nil {
+		return err
+	}
+	file := rest[0]
+
+	language, err := detectLanguage(file, *lang)
+	if err != nil {
+		return err
+	}
+	code, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	ref, dir, err := resolveProblem(c, *slug, file)
+	if err != nil {
+		return err
+	}
+
+	var cases []TestCase
+	if dir != "" {
+		if cases, err = loadExamples(dir); err != nil {
+			return err
+		}
+	} else {
+		p, err := getProblem(c, ref.Slug)
+		if err != nil {
+			return err
+		}
+		for _, ex := range p.Examples {
+			cases = append(cases, TestCase{Input: ex.Input, ExpectedOutput: ex.ExpectedOutput})
+		}
+	}
+
+	var resp runResponse
+	payload := map[string]any{"ProblemID": ref.ID, "Language": language, "Code": string(code), "Cases": cases}
+	if err := c.Do(http.MethodPost, "/run", payload, &resp); err != nil {
+		return err
+	}
+	return waitForVerdict(c, "/run/", resp.RunID, *wait)
+}
+
+func runSubmit(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj submit", flag.ExitOnError)
+	slug := fs.String("problem", "", "problem slug, read from the pulled folder by default")
+	lang := fs.String("lang", "", "language, guessed from the file extension by default")
+	contest := fs.Int("contest", 0, "submit to this contest")
+	wait := fs.Duration("wait", 2*time.Minute, "how long to wait for the verdict, 0 to not wait")
+	rest, err := exactArgs(fs, args, 1, "[-problem SLUG] [-lang L] [-contest ID] [-wait D] FILE")
+	if err != nil {
+		return err
+	}
+	file := rest[0]
+
+	language, err := detectLanguage(file, *lang)
+	if err != nil {
+		return err
+	}
+	code, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	ref, _, err := resolveProblem(c, *slug, file)
+	if err != nil {
+		return err
+	}
+
+	var resp runResponse
+	payload := map[string]any{"ProblemID": ref.ID, "Language": language, "Code": string(code), "ContestID": *contest}
+	if err := c.Do(http.MethodPost, "/submit", payload, &resp); err != nil {
+		return err
+	}
+	fmt.Printf("Submitted %s to %s as submission %d\n", filepath.Base(file), ref.Slug, resp.RunID)
+	if *wait == 0 {
+		return nil
+	}
+	return waitForVerdict(c, "/submission/", resp.RunID, *wait)
+}
+
+func runStatus(c *Client, args []string) error {
+	fs := flag.NewFlagSet("oj status", flag.ExitOnError)
+	rest, err := exactArgs(fs, args, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(rest[0])
+	if err != nil {
+		return fmt.Errorf("invalid submission id %q", rest[0])
+	}
+
+	var sub Submission
+	if err := c.Do(http.MethodGet, "/submission/"+strconv.Itoa(id), nil, &sub); err != nil {
+		return err
+	}
+	printVerdict(&sub)
+	return nil
+}
+
+// waitForVerdict polls the run or submission until it leaves the pending
+// state, printing progress as it goes.
+func waitForVerdict(c *Client, path string, id int, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	fmt.Fprint(os.Stderr, "Judging")
+	for {
+		var sub Submission
+		if err := c.Do(http.MethodGet, path+strconv.Itoa(id), nil, &sub); err != nil {
+			fmt.Fprintln(os.Stderr)
+			return err
+		}
+		if !strings.EqualFold(sub.Status, statusPending) && sub.Status != "" {
+			fmt.Fprintln(os.Stderr)
+			printVerdict(&sub)
+			if !strings.EqualFold(sub.Status, statusAccepted) {
+				return errors.New("not accepted")
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintln(os.Stderr)
+			return errors.New("still judging, check again with oj status " + strconv.Itoa(id))
+		}
+		fmt.Fprint(os.Stderr, ".")
+		time.Sleep(pollInterval)
+	}
+}
+
+func printVerdict(sub *Submission) {
+	fmt.Printf("Verdict: %s\n", sub.Status)
+	if sub.Message != "" {
+		fmt.Println(indent(sub.Message))
+	}
+
+	tw := newTabWriter()
+	for i, res := range sub.Results {
+		fmt.Fprintf(tw, "  #%d\t%s\t%d ms\t%d KB\n", i+1, res.Status, res.RuntimeMS, res.MemoryKB)
+	}
+	tw.Flush()
+
+	// Show the first failing test in full, if the judge shared it
+	for i, res := range sub.Results {
+		// Inputs of full submissions are hidden
+		if strings.EqualFold(res.Status, statusAccepted) || res.Input == "" || res.Input == "<hidden>" {
+			continue
+		}
+		fmt.Printf("\nTest #%d\n  input:\n%s  expected:\n%s  got:\n%s", i+1, indent(res.Input), indent(res.ExpectedOutput), indent(res.Output))
+		break
+	}
+}
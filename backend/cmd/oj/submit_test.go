@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWaitForVerdict(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string // answered in turn, the last one repeats
+		wantErr  bool
+	}{
+		{"accepted", []string{"Accepted"}, false},
+		{"accepted lowercase", []string{"accepted"}, false},
+		{"accepted uppercase", []string{"ACCEPTED"}, false},
+		{"wrong answer", []string{"Wrong Answer on Test Case : 2"}, true},
+		{"pending first", []string{"PENDING", "Accepted"}, false},
+		{"still pending", []string{"pending"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[min(calls, len(tt.statuses)-1)]
+				calls++
+				json.NewEncoder(w).Encode(Submission{ID: 1, Status: status})
+			}))
+			defer srv.Close()
+			t.Setenv("OJ_SERVER", srv.URL)
+			t.Setenv("OJ_TOKEN", "")
+
+			err := waitForVerdict(NewClient(&Config{}), "/submissions/", 1, pollInterval)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("waitForVerdict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
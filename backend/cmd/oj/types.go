@@ -0,0 +1,90 @@
+package main
+
+import "time"
+
+// The parts of the API's models the CLI uses, see cmd/api/models.go.
+
+type User struct {
+	ID       int
+	Username string
+	Role     string
+}
+
+type Problem struct {
+	ID          int
+	Title       string
+	Slug        string
+	Difficulty  string
+	Tags        []string
+	Description string
+	Constraints []string
+	Examples    []Example
+	Limits      []Limits
+}
+
+type Example struct {
+	ID             int
+	Input          string
+	ExpectedOutput string
+	Explanation    string
+}
+
+type Limits struct {
+	Language      string
+	TimeLimitMS   int
+	MemoryLimitKB int
+}
+
+type SearchResult struct {
+	EntityType string
+	ID         int
+	Title      string
+	Slug       string
+	ProblemID  int
+	Snippet    string
+}
+
+type TestCase struct {
+	Input          string
+	ExpectedOutput string
+}
+
+type Submission struct {
+	ID      int
+	Status  string
+	Message string
+	Results []TestResult
+}
+
+type TestResult struct {
+	ID             int
+	Status         string
+	Input          string
+	ExpectedOutput string
+	Output         string
+	RuntimeMS      int
+	MemoryKB       int
+}
+
+type Contest struct {
+	ID        int
+	Name      string
+	Status    string
+	StartTime time.Time
+	EndTime   time.Time
+	Problems  []ContestProblem
+}
+
+type ContestProblem struct {
+	ID         int
+	Title      string
+	Slug       string
+	Difficulty string
+	MaxPoints  int
+}
+
+type ContestParticipant struct {
+	UserID   int
+	Username string
+	Score    int
+}
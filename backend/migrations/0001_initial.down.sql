@@ -1,5 +1,3 @@
--- migration_clear_schema.sql
-
 -- Drop tables in reverse dependency order
 DROP TABLE IF EXISTS discussion_comments;
 DROP TABLE IF EXISTS discussion_votes;
@@ -13,15 +11,32 @@ DROP TABLE IF EXISTS contest_problems;
 DROP TABLE IF EXISTS contests;
 DROP TABLE IF EXISTS test_results;
 DROP TABLE IF EXISTS submissions;
+DROP TABLE IF EXISTS test_generation_jobs;
+DROP TABLE IF EXISTS problem_reviews;
+DROP TABLE IF EXISTS problem_revisions;
+DROP TABLE IF EXISTS problem_validation_runs;
+DROP TABLE IF EXISTS problem_solutions;
 DROP TABLE IF EXISTS limits;
 DROP TABLE IF EXISTS test_cases;
 DROP TABLE IF EXISTS problem_examples;
 DROP TABLE IF EXISTS problem_tags;
 DROP TABLE IF EXISTS solved_problems;
 DROP TABLE IF EXISTS problems;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS role_grants;
 DROP TABLE IF EXISTS users;
 
+-- Drop search trigger functions
+DROP FUNCTION IF EXISTS problem_tags_search_vector_update;
+DROP FUNCTION IF EXISTS problems_search_vector_update;
+
 -- Drop custom enum types
+DROP TYPE IF EXISTS user_token_purpose;
+DROP TYPE IF EXISTS review_action;
+DROP TYPE IF EXISTS generation_status;
 DROP TYPE IF EXISTS execution_type;
 DROP TYPE IF EXISTS difficulty;
 DROP TYPE IF EXISTS language;
@@ -0,0 +1,405 @@
+CREATE TYPE user_role AS ENUM (
+    'user', 'admin', 'problem_setter', 'tester', 'reviewer',
+    'contest_manager', 'moderator'
+);
+
+CREATE TYPE problem_status AS ENUM (
+    'draft', 'validate', 'active', 'rejected', 'archieved',
+    'validated', 'in_review', 'changes_requested'
+);
+
+CREATE TYPE review_action AS ENUM ('submitted', 'comment', 'approved', 'changes_requested');
+
+CREATE TYPE submission_status AS ENUM (
+    'pending', 'accepted', 'wrong answer', 'time limit exceeded',
+    'memory limit exceeded', 'compilation error', 'runtime error'
+);
+
+CREATE TYPE contest_status AS ENUM ('waiting', 'running', 'ended', 'cancelled');
+
+CREATE TYPE language AS ENUM ('go', 'python', 'cpp', 'java', 'c');
+
+CREATE TYPE difficulty AS ENUM ('easy', 'medium', 'hard');
+
+CREATE TYPE execution_type AS ENUM (
+    'run', 'submit', 'contest', 'validate',
+    'generate', 'validate_input', 'generate_output'
+);
+
+CREATE TYPE generation_status AS ENUM ('generating', 'validating', 'solving', 'completed', 'failed');
+
+CREATE TYPE user_token_purpose AS ENUM ('verify_email', 'reset_password');
+
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    role user_role NOT NULL DEFAULT 'user',
+    rating INT NOT NULL DEFAULT 0,
+    email_verified_at TIMESTAMPTZ,
+    totp_secret TEXT, -- set on setup, enforced once totp_enabled_at is set
+    totp_enabled_at TIMESTAMPTZ,
+    totp_last_step BIGINT NOT NULL DEFAULT 0, -- last accepted TOTP step, against replays
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX recovery_codes_user_idx ON recovery_codes (user_id);
+
+-- Single-use tokens mailed to users. Only their hashes are stored.
+CREATE TABLE user_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose user_token_purpose NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX user_tokens_user_idx ON user_tokens (user_id, purpose);
+
+-- Roles held on top of users.role. A grant without a resource applies
+-- everywhere, otherwise only to that resource (e.g. one contest).
+CREATE TABLE role_grants (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role user_role NOT NULL,
+    resource_type TEXT,
+    resource_id INT,
+    granted_by INT REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((resource_type IS NULL) = (resource_id IS NULL))
+);
+
+CREATE UNIQUE INDEX role_grants_unique_idx
+    ON role_grants (user_id, role, COALESCE(resource_type, ''), COALESCE(resource_id, 0));
+
+-- Login sessions. Only hashes of the refresh tokens are stored; the token
+-- rotates on every refresh and the previous hash is kept to detect reuse.
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    previous_token_hash TEXT,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_user_idx ON sessions (user_id);
+CREATE INDEX sessions_previous_token_idx ON sessions (previous_token_hash);
+
+-- Personal API tokens for the CLI and editor plugins, sent as
+-- "Authorization: Bearer". Only their hashes are stored.
+CREATE TABLE api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL CHECK (scopes <@ ARRAY['read', 'submit', 'write']),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_tokens_user_idx ON api_tokens (user_id);
+
+CREATE TABLE problems (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT,
+    slug TEXT UNIQUE,
+    constraints TEXT,
+    difficulty difficulty NOT NULL,
+    author_id INT REFERENCES users (id),
+    status problem_status NOT NULL DEFAULT 'draft',
+    solution_language language,
+    solution_code TEXT,
+    generator_language language,
+    generator_code TEXT,
+    generator_script TEXT,
+    validator_language language,
+    validator_code TEXT,
+    explanation TEXT,
+    failure_reason TEXT,
+    validation_report JSONB,
+    validation_count INT NOT NULL DEFAULT 0,
+    current_revision INT NOT NULL DEFAULT 0,
+    search_vector tsvector
+);
+
+CREATE TABLE solved_problems (
+    user_id INT REFERENCES users (id),
+    problem_id INT NOT NULL,
+    solved_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, problem_id),
+    FOREIGN KEY (problem_id) REFERENCES problems (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE problem_tags (
+    problem_id INT REFERENCES problems (id),
+    tag TEXT,
+    PRIMARY KEY (problem_id, tag)
+);
+
+CREATE TABLE problem_examples (
+    id SERIAL PRIMARY KEY,
+    problem_id INT REFERENCES problems (id),
+    input TEXT,
+    expected_output TEXT,
+    explanation TEXT
+);
+
+-- Test data lives in the blob store, addressed by the *_hash columns.
+-- input/expected_output are only kept inline for small tests.
+CREATE TABLE test_cases (
+    id SERIAL PRIMARY KEY,
+    problem_id INT REFERENCES problems (id),
+    input TEXT,
+    expected_output TEXT,
+    input_hash TEXT,
+    expected_output_hash TEXT
+);
+
+CREATE TABLE limits (
+    problem_id INT REFERENCES problems (id),
+    language language,
+    time_limit_ms INT CHECK (time_limit_ms > 0),
+    memory_limit_kb INT CHECK (memory_limit_kb > 0),
+    PRIMARY KEY (problem_id, language)
+);
+
+-- Extra author solutions checked during validation. A solution passes when
+-- its verdict (the first failing test's status) is one of expected_verdicts.
+CREATE TABLE problem_solutions (
+    id SERIAL PRIMARY KEY,
+    problem_id INT NOT NULL REFERENCES problems (id),
+    name TEXT NOT NULL,
+    language language NOT NULL,
+    code TEXT NOT NULL,
+    expected_verdicts submission_status[] NOT NULL
+);
+
+-- One row per solution run of a validation, validation_id being the
+-- problem's validation_count when it was queued.
+CREATE TABLE problem_validation_runs (
+    id SERIAL PRIMARY KEY,
+    problem_id INT NOT NULL REFERENCES problems (id),
+    validation_id INT NOT NULL,
+    solution_name TEXT NOT NULL,
+    language language NOT NULL,
+    expected_verdicts submission_status[] NOT NULL,
+    verdict TEXT,
+    results JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_problem_validation_runs_problem ON problem_validation_runs (problem_id, validation_id);
+
+-- Review history of a problem: submissions for review, tester and reviewer
+-- comments, and reviewer decisions, each tied to the revision it was about.
+CREATE TABLE problem_reviews (
+    id SERIAL PRIMARY KEY,
+    problem_id INT NOT NULL REFERENCES problems (id),
+    user_id INT REFERENCES users (id),
+    action review_action NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    revision INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Immutable snapshots of a problem's statement, tests, limits and solution,
+-- one per create/update.
+CREATE TABLE problem_revisions (
+    id SERIAL PRIMARY KEY,
+    problem_id INT NOT NULL REFERENCES problems (id),
+    revision INT NOT NULL,
+    author_id INT REFERENCES users (id),
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (problem_id, revision)
+);
+
+-- Generator -> input validator -> reference solution runs that produce a
+-- problem's tests. input_hashes/output_hashes point into the blob store.
+CREATE TABLE test_generation_jobs (
+    id SERIAL PRIMARY KEY,
+    problem_id INT NOT NULL REFERENCES problems (id),
+    created_by INT REFERENCES users (id),
+    status generation_status NOT NULL DEFAULT 'generating',
+    replace_tests BOOLEAN NOT NULL DEFAULT TRUE,
+    input_hashes TEXT[],
+    output_hashes TEXT[],
+    report JSONB,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE submissions (
+    id SERIAL PRIMARY KEY,
+    problem_id INT REFERENCES problems (id),
+    user_id INT REFERENCES users (id),
+    contest_id INT,
+    language language,
+    code TEXT,
+    status submission_status,
+    message TEXT,
+    problem_revision INT
+);
+
+CREATE TABLE test_results (
+    id SERIAL PRIMARY KEY,
+    submission_id INT REFERENCES submissions (id),
+    status submission_status,
+    stdout TEXT,
+    stderr TEXT,
+    runtime_ms INT,
+    memory_kb INT
+);
+
+CREATE TABLE contests (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    status contest_status,
+    start_time TIMESTAMPTZ,
+    end_time TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE contest_problems (
+    contest_id INT REFERENCES contests (id),
+    problem_id INT REFERENCES problems (id),
+    max_points INT,
+    PRIMARY KEY (contest_id, problem_id)
+);
+
+CREATE TABLE contest_participants (
+    contest_id INT REFERENCES contests (id),
+    user_id INT REFERENCES users (id),
+    score INT DEFAULT 0,
+    rating_change INT DEFAULT 0,
+    PRIMARY KEY (contest_id, user_id)
+);
+
+CREATE TABLE contest_solved_problems (
+    contest_id INT,
+    user_id INT,
+    problem_id INT,
+    solved_at TIMESTAMPTZ,
+    score_delta INT,
+    PRIMARY KEY (
+        contest_id,
+        user_id,
+        problem_id
+    ),
+    FOREIGN KEY (contest_id, user_id) REFERENCES contest_participants (contest_id, user_id)
+);
+
+CREATE TABLE execution_payloads (
+    id SERIAL PRIMARY KEY,
+    language language,
+    code TEXT,
+    time_limit_ms INT,
+    memory_limit_kb INT,
+    execution_type execution_type,
+    points INT,
+    penalty INT
+);
+
+CREATE TABLE execution_testcases (
+    payload_id INT REFERENCES execution_payloads (id),
+    testcase_id INT REFERENCES test_cases (id),
+    PRIMARY KEY (payload_id, testcase_id)
+);
+
+CREATE TABLE execution_responses (
+    id SERIAL PRIMARY KEY,
+    submission_id INT REFERENCES submissions (id),
+    execution_type execution_type,
+    score_delta INT
+);
+
+CREATE TABLE discussions (
+    id SERIAL PRIMARY KEY,
+    problem_id INT REFERENCES problems (id),
+    title TEXT,
+    content TEXT,
+    author_id INT REFERENCES users (id),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'B')
+    ) STORED
+);
+
+CREATE TABLE discussion_votes (
+    user_id INT REFERENCES users (id),
+    discussion_id INT REFERENCES discussions (id),
+    vote INT CHECK (vote IN (-1, 0, 1)),
+    PRIMARY KEY (user_id, discussion_id)
+);
+
+CREATE TABLE discussion_comments (
+    id SERIAL PRIMARY KEY,
+    discussion_id INT REFERENCES discussions (id),
+    author_id INT REFERENCES users (id),
+    content TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    search_vector tsvector GENERATED ALWAYS AS (
+        to_tsvector('english', coalesce(content, ''))
+    ) STORED
+);
+
+-- Full-text search
+
+CREATE INDEX idx_problems_search_vector ON problems USING GIN (search_vector);
+
+-- Tags live in problem_tags, so the problem vector is maintained by triggers
+-- instead of a generated column.
+CREATE FUNCTION problems_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(
+            (SELECT string_agg(tag, ' ') FROM problem_tags WHERE problem_id = NEW.id), ''
+        )), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER problems_search_vector_trigger
+BEFORE INSERT OR UPDATE OF title, description ON problems
+FOR EACH ROW EXECUTE FUNCTION problems_search_vector_update();
+
+-- Touching the title re-runs the trigger above with the new tag set.
+CREATE FUNCTION problem_tags_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE problems SET title = title
+    WHERE id = COALESCE(NEW.problem_id, OLD.problem_id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER problem_tags_search_vector_trigger
+AFTER INSERT OR UPDATE OR DELETE ON problem_tags
+FOR EACH ROW EXECUTE FUNCTION problem_tags_search_vector_update();
+
+CREATE INDEX idx_discussions_search_vector ON discussions USING GIN (search_vector);
+
+CREATE INDEX idx_discussion_comments_search_vector ON discussion_comments USING GIN (search_vector);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ai_jobs;
+DROP TYPE IF EXISTS ai_job_status;
+DROP TYPE IF EXISTS ai_job_kind;
@@ -0,0 +1,26 @@
+-- Durable queue for AI work (problem explanations, code feedback). Workers
+-- claim jobs with FOR UPDATE SKIP LOCKED; a claim expires at locked_until so
+-- jobs of a crashed worker are picked up again.
+CREATE TYPE ai_job_kind AS ENUM ('explanation', 'feedback');
+
+CREATE TYPE ai_job_status AS ENUM ('queued', 'running', 'completed', 'failed');
+
+CREATE TABLE ai_jobs (
+    id SERIAL PRIMARY KEY,
+    kind ai_job_kind NOT NULL,
+    user_id INT REFERENCES users (id) ON DELETE CASCADE,
+    problem_id INT NOT NULL REFERENCES problems (id) ON DELETE CASCADE,
+    input JSONB NOT NULL DEFAULT '{}',
+    status ai_job_status NOT NULL DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMPTZ,
+    result TEXT,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX ai_jobs_pending_idx ON ai_jobs (run_at) WHERE status IN ('queued', 'running');
+CREATE INDEX ai_jobs_user_idx ON ai_jobs (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE contests DROP COLUMN IF EXISTS hint_penalty;
+DROP TABLE IF EXISTS hint_reveals;
+DROP TABLE IF EXISTS problem_hints;
+DROP TYPE IF EXISTS hint_source;
@@ -0,0 +1,30 @@
+-- Graded hints: level 1 is a nudge, 2 the key idea, 3 a pseudo-code outline.
+-- Authors may write them; missing levels are generated on first reveal and
+-- kept here.
+CREATE TYPE hint_source AS ENUM ('author', 'ai');
+
+CREATE TABLE problem_hints (
+    problem_id INT NOT NULL REFERENCES problems (id) ON DELETE CASCADE,
+    level SMALLINT NOT NULL CHECK (level BETWEEN 1 AND 3),
+    content TEXT NOT NULL,
+    source hint_source NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (problem_id, level)
+);
+
+-- contest_id and penalty are set when the hint was taken during a contest
+CREATE TABLE hint_reveals (
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    problem_id INT NOT NULL REFERENCES problems (id) ON DELETE CASCADE,
+    level SMALLINT NOT NULL CHECK (level BETWEEN 1 AND 3),
+    contest_id INT REFERENCES contests (id) ON DELETE SET NULL,
+    penalty INT NOT NULL DEFAULT 0,
+    revealed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, problem_id, level)
+);
+
+CREATE INDEX hint_reveals_contest_idx ON hint_reveals (contest_id) WHERE contest_id IS NOT NULL;
+
+-- Points a hint costs during the contest; NULL turns hints off for it
+ALTER TABLE contests ADD COLUMN hint_penalty INT CHECK (hint_penalty >= 0);
@@ -0,0 +1,5 @@
+-- Enum values can't be dropped: the added ai_job_kind and execution_type
+-- values stay, and the up migration skips them when it runs again.
+DELETE FROM ai_jobs WHERE kind = 'test_cases';
+DROP TABLE IF EXISTS test_proposals;
+DROP TYPE IF EXISTS test_proposal_status;
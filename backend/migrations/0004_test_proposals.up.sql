@@ -0,0 +1,26 @@
+-- Edge-case tests proposed by the AI provider. Each candidate input goes
+-- through the input validator and the reference solution; the ones that
+-- come out ready wait for the author to accept them into the problem.
+ALTER TYPE ai_job_kind ADD VALUE IF NOT EXISTS 'test_cases';
+
+ALTER TYPE execution_type ADD VALUE IF NOT EXISTS 'propose_validate';
+ALTER TYPE execution_type ADD VALUE IF NOT EXISTS 'propose_output';
+
+CREATE TYPE test_proposal_status AS ENUM (
+    'validating', 'solving', 'ready', 'invalid', 'failed', 'accepted', 'dismissed'
+);
+
+CREATE TABLE test_proposals (
+    id SERIAL PRIMARY KEY,
+    problem_id INT NOT NULL REFERENCES problems (id) ON DELETE CASCADE,
+    ai_job_id INT REFERENCES ai_jobs (id) ON DELETE SET NULL,
+    input_hash TEXT NOT NULL,
+    output_hash TEXT,
+    rationale TEXT NOT NULL DEFAULT '',
+    status test_proposal_status NOT NULL,
+    message TEXT, -- why the validator or the solution rejected it
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX test_proposals_problem_idx ON test_proposals (problem_id);
@@ -0,0 +1,4 @@
+ALTER TABLE test_proposals DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE problem_hints DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE problems DROP COLUMN IF EXISTS explanation_prompt_version;
+ALTER TABLE ai_jobs DROP COLUMN IF EXISTS prompt_version;
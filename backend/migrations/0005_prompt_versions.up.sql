@@ -0,0 +1,6 @@
+-- The prompt template version (e.g. "feedback.v2", see the prompts package)
+-- each AI-generated result came from.
+ALTER TABLE ai_jobs ADD COLUMN prompt_version TEXT;
+ALTER TABLE problems ADD COLUMN explanation_prompt_version TEXT;
+ALTER TABLE problem_hints ADD COLUMN prompt_version TEXT;
+ALTER TABLE test_proposals ADD COLUMN prompt_version TEXT;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ai_quotas;
+DROP TABLE IF EXISTS ai_usage;
+DROP TYPE IF EXISTS ai_feature;
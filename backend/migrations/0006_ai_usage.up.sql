@@ -0,0 +1,36 @@
+-- One row per call to the AI provider, with the tokens it reported. Calls
+-- the system makes on its own, like explanations, have no user.
+CREATE TYPE ai_feature AS ENUM ('explanation', 'feedback', 'hint', 'test_cases');
+
+CREATE TABLE ai_usage (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT REFERENCES users (id) ON DELETE SET NULL,
+    problem_id INT REFERENCES problems (id) ON DELETE SET NULL,
+    feature ai_feature NOT NULL,
+    model TEXT NOT NULL,
+    prompt_version TEXT,
+    input_tokens INT NOT NULL DEFAULT 0,
+    output_tokens INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX ai_usage_user_idx ON ai_usage (user_id, created_at);
+CREATE INDEX ai_usage_created_idx ON ai_usage (created_at);
+
+-- AI calls a role may make per UTC day and month; NULL means no limit. A
+-- user gets the most generous limits of their role and global grants.
+CREATE TABLE ai_quotas (
+    role user_role PRIMARY KEY,
+    daily_limit INT CHECK (daily_limit >= 0),
+    monthly_limit INT CHECK (monthly_limit >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO ai_quotas (role, daily_limit, monthly_limit) VALUES
+    ('user', 20, 300),
+    ('moderator', 20, 300),
+    ('contest_manager', 20, 300),
+    ('tester', 50, 1000),
+    ('reviewer', 50, 1000),
+    ('problem_setter', 100, 2000),
+    ('admin', NULL, NULL);
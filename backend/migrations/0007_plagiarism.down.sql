@@ -0,0 +1,9 @@
+ALTER TABLE contest_participants
+    DROP COLUMN IF EXISTS disqualified_reason,
+    DROP COLUMN IF EXISTS disqualified_by,
+    DROP COLUMN IF EXISTS disqualified_at;
+
+DROP TABLE IF EXISTS plagiarism_pairs;
+DROP TABLE IF EXISTS plagiarism_checks;
+DROP TYPE IF EXISTS plagiarism_review;
+DROP TYPE IF EXISTS plagiarism_check_status;
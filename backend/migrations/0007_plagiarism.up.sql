@@ -0,0 +1,45 @@
+-- Plagiarism checks compare the submissions to each contest problem, see
+-- the plagiarism package. Submissions live in memory, so each pair keeps
+-- the code it was flagged on for review.
+CREATE TYPE plagiarism_check_status AS ENUM ('running', 'completed', 'failed');
+CREATE TYPE plagiarism_review AS ENUM ('pending', 'confirmed', 'dismissed');
+
+CREATE TABLE plagiarism_checks (
+    id SERIAL PRIMARY KEY,
+    contest_id INT NOT NULL REFERENCES contests (id) ON DELETE CASCADE,
+    created_by INT REFERENCES users (id) ON DELETE SET NULL, -- NULL when the contest ending started it
+    status plagiarism_check_status NOT NULL DEFAULT 'running',
+    submissions INT NOT NULL DEFAULT 0, -- compared
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX plagiarism_checks_contest_idx ON plagiarism_checks (contest_id);
+
+CREATE TABLE plagiarism_pairs (
+    id SERIAL PRIMARY KEY,
+    check_id INT NOT NULL REFERENCES plagiarism_checks (id) ON DELETE CASCADE,
+    problem_id INT NOT NULL REFERENCES problems (id) ON DELETE CASCADE,
+    language language NOT NULL,
+    similarity REAL NOT NULL,
+    submission_a INT NOT NULL,
+    user_a INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_a TEXT NOT NULL,
+    submission_b INT NOT NULL,
+    user_b INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_b TEXT NOT NULL,
+    regions JSONB NOT NULL DEFAULT '[]', -- matching line ranges of both
+    review plagiarism_review NOT NULL DEFAULT 'pending',
+    reviewed_by INT REFERENCES users (id) ON DELETE SET NULL,
+    review_note TEXT,
+    reviewed_at TIMESTAMPTZ
+);
+
+CREATE INDEX plagiarism_pairs_check_idx ON plagiarism_pairs (check_id, similarity DESC);
+
+-- Disqualified participants are left out of the standings
+ALTER TABLE contest_participants
+    ADD COLUMN disqualified_at TIMESTAMPTZ,
+    ADD COLUMN disqualified_by INT REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN disqualified_reason TEXT;
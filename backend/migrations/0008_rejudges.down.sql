@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS submission_verdicts;
+DROP TABLE IF EXISTS rejudges;
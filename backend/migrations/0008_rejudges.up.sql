@@ -0,0 +1,31 @@
+-- Rejudges requeue submissions after a test or checker fix. Each names one
+-- scope: a submission, a problem or a contest, optionally only submissions
+-- with a verdict. Submissions live in memory, so the verdict history keeps
+-- who and what each one was for.
+CREATE TABLE rejudges (
+    id SERIAL PRIMARY KEY,
+    submission_id INT,
+    problem_id INT REFERENCES problems (id) ON DELETE CASCADE,
+    contest_id INT REFERENCES contests (id) ON DELETE CASCADE,
+    verdict TEXT, -- only submissions with this verdict, like 'wrong answer'
+    requested_by INT REFERENCES users (id) ON DELETE SET NULL,
+    submissions INT NOT NULL DEFAULT 0, -- queued
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX rejudges_contest_idx ON rejudges (contest_id);
+
+CREATE TABLE submission_verdicts (
+    id BIGSERIAL PRIMARY KEY,
+    submission_id INT NOT NULL,
+    rejudge_id INT REFERENCES rejudges (id) ON DELETE SET NULL,
+    user_id INT REFERENCES users (id) ON DELETE CASCADE,
+    problem_id INT REFERENCES problems (id) ON DELETE CASCADE,
+    contest_id INT,
+    old_status TEXT NOT NULL,
+    new_status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX submission_verdicts_submission_idx ON submission_verdicts (submission_id);
+CREATE INDEX submission_verdicts_rejudge_idx ON submission_verdicts (rejudge_id);
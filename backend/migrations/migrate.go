@@ -1,28 +1,347 @@
+// Package migrate applies the numbered SQL migrations in this directory.
+//
+// Each migration is a NNNN_name.up.sql file with an optional
+// NNNN_name.down.sql that reverts it. Applied versions are recorded in
+// schema_migrations along with a checksum of the up file. Migrations are
+// forward-only: once applied, a file must not change, so schema changes go
+// in a new file with the next number.
 package migrate
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
 )
 
-func ResetDB(db *sql.DB) error {
-	files := []string{"down.sql", "up.sql", "seed.sql"}
+//go:embed *.sql
+var files embed.FS
 
-	for _, file := range files {
-		sqlBytes, err := os.ReadFile(filepath.Join("migrations", file))
+// lockID keeps concurrent servers from migrating at the same time.
+const lockID = 72_651_001
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // empty if the migration can't be reverted
+	Checksum string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Modified  bool // the up file changed after it was applied
+	Missing   bool // applied, but its file is gone
+}
+
+// Load returns the embedded migrations ordered by version.
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.Name() == "seed.sql" {
+			continue
+		}
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
 		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", file, err)
+			return nil, err
 		}
 
-		sqlStatements := string(sqlBytes)
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
 
-		_, err = db.Exec(sqlStatements)
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// making sure schema_migrations exists. Only changes take the lock, see
+// GetStatus.
+func withLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// querier is a *sql.DB or *sql.Conn.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func applied(ctx context.Context, conn querier) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = a
+	}
+	return versions, rows.Err()
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones it applied.
+func Up(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
 		if err != nil {
-			return fmt.Errorf("failed to execute %s: %w", file, err)
+			return err
+		}
+		if len(versions) == 0 {
+			if err := checkEmpty(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		todo, err := pending(migrations, versions)
+		if err != nil {
+			return err
+		}
+		for _, mig := range todo {
+			if err := run(ctx, conn, mig.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					mig.Version, mig.Name, mig.Checksum)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
 		}
+		return nil
+	})
+	return done, err
+}
+
+// pending returns the migrations that aren't applied yet, in order. It fails
+// if an applied one changed since.
+func pending(migrations []Migration, versions map[int]appliedMigration) ([]Migration, error) {
+	var todo []Migration
+	for _, mig := range migrations {
+		if a, ok := versions[mig.Version]; ok {
+			if a.checksum != mig.Checksum {
+				return nil, fmt.Errorf("migration %d_%s changed after it was applied, add a new migration instead", mig.Version, mig.Name)
+			}
+			continue
+		}
+		todo = append(todo, mig)
 	}
+	return todo, nil
+}
 
+// checkEmpty refuses to migrate a database that was set up before
+// migrations were tracked, which would fail halfway through.
+func checkEmpty(ctx context.Context, conn *sql.Conn) error {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass('users') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("the database has tables but no recorded migrations, recreate it before migrating")
+	}
 	return nil
 }
+
+// Down reverts the latest applied migration and returns it, or nil if
+// nothing is applied.
+func Down(ctx context.Context, db *sql.DB) (*Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted *Migration
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		var version int
+		err := conn.QueryRowContext(ctx, `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		i := slices.IndexFunc(migrations, func(m Migration) bool { return m.Version == version })
+		if i < 0 {
+			return fmt.Errorf("migration %d is applied but its file is missing", version)
+		}
+		mig := migrations[i]
+		if mig.Down == "" {
+			return fmt.Errorf("migration %d_%s can't be reverted, it has no down file", mig.Version, mig.Name)
+		}
+		if err := run(ctx, conn, mig.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+			return err
+		}); err != nil {
+			return fmt.Errorf("reverting migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		reverted = &mig
+		return nil
+	})
+	return reverted, err
+}
+
+func run(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetStatus lists every known migration, applied or not, by version. It
+// only reads, so it neither waits for a running migration nor creates
+// schema_migrations.
+func GetStatus(ctx context.Context, db *sql.DB) ([]Status, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[int]appliedMigration{}
+	if exists {
+		if versions, err = applied(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+	return statuses(migrations, versions), nil
+}
+
+// statuses matches the migrations on file with the applied versions.
+func statuses(migrations []Migration, versions map[int]appliedMigration) []Status {
+	var list []Status
+	seen := map[int]bool{}
+	for _, mig := range migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := versions[mig.Version]; ok {
+			st.AppliedAt = &a.appliedAt
+			st.Modified = a.checksum != mig.Checksum
+		}
+		seen[mig.Version] = true
+		list = append(list, st)
+	}
+	for version, a := range versions {
+		if !seen[version] {
+			list = append(list, Status{Version: version, Name: a.name, AppliedAt: &a.appliedAt, Missing: true})
+		}
+	}
+	slices.SortFunc(list, func(a, b Status) int { return a.Version - b.Version })
+	return list
+}
+
+// Seed loads the development data in seed.sql. It expects a freshly
+// migrated database.
+func Seed(ctx context.Context, db *sql.DB) error {
+	script, err := files.ReadFile("seed.sql")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return fmt.Errorf("failed to execute seed.sql: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,177 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func mapFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, body := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(body)}
+	}
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := load(mapFS(map[string]string{
+		"0010_tags.up.sql":      "CREATE TABLE tags ();",
+		"0002_users.up.sql":     "CREATE TABLE users ();",
+		"0002_users.down.sql":   "DROP TABLE users;",
+		"0001_initial.up.sql":   "CREATE TABLE a ();",
+		"0010_tags.down.sql":    "DROP TABLE tags;",
+		"seed.sql":              "INSERT INTO a DEFAULT VALUES;",
+		"0001_initial.down.sql": "DROP TABLE a;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "initial", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "users", Up: "CREATE TABLE users ();", Down: "DROP TABLE users;"},
+		{Version: 10, Name: "tags", Up: "CREATE TABLE tags ();", Down: "DROP TABLE tags;"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, mig := range migrations {
+		w := want[i]
+		if mig.Version != w.Version || mig.Name != w.Name || mig.Up != w.Up || mig.Down != w.Down {
+			t.Errorf("migration %d = %d_%s %q %q, want %d_%s %q %q", i, mig.Version, mig.Name, mig.Up, mig.Down, w.Version, w.Name, w.Up, w.Down)
+		}
+	}
+}
+
+func TestLoadWithoutDown(t *testing.T) {
+	migrations, err := load(mapFS(map[string]string{"0001_initial.up.sql": "SELECT 1;"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 1 || migrations[0].Down != "" {
+		t.Errorf("got %+v, want one migration without a down script", migrations)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"down without up", map[string]string{"0001_initial.down.sql": "SELECT 1;"}, "has no up file"},
+		{"two names", map[string]string{"0001_a.up.sql": "SELECT 1;", "0001_b.down.sql": "SELECT 1;"}, "has two names"},
+		{"invalid name", map[string]string{"initial.sql": "SELECT 1;"}, "invalid migration file name"},
+		{"invalid direction", map[string]string{"0001_initial.sideways.sql": "SELECT 1;"}, "invalid migration file name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(mapFS(tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("load = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	checksum := func(files map[string]string) string {
+		t.Helper()
+		migrations, err := load(mapFS(files))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return migrations[0].Checksum
+	}
+
+	base := checksum(map[string]string{"0001_initial.up.sql": "CREATE TABLE a ();"})
+	// sha256 of the up file
+	if want := "902f5c947b00294d6b0cdb41666553a31c51672ed6e65af6209e622790dce7b1"; base != want {
+		t.Errorf("checksum = %s, want %s", base, want)
+	}
+	if got := checksum(map[string]string{"0001_initial.up.sql": "CREATE TABLE a ();", "0001_initial.down.sql": "DROP TABLE a;"}); got != base {
+		t.Error("adding a down file changed the checksum")
+	}
+	if got := checksum(map[string]string{"0001_initial.up.sql": "CREATE TABLE b ();"}); got == base {
+		t.Error("changing the up file kept the checksum")
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "initial", Checksum: "a"},
+		{Version: 2, Name: "users", Checksum: "b"},
+		{Version: 3, Name: "tags", Checksum: "c"},
+	}
+
+	todo, err := pending(migrations, map[int]appliedMigration{1: {name: "initial", checksum: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todo) != 2 || todo[0].Version != 2 || todo[1].Version != 3 {
+		t.Errorf("pending = %+v, want versions 2 and 3", todo)
+	}
+
+	_, err = pending(migrations, map[int]appliedMigration{1: {name: "initial", checksum: "a"}, 2: {name: "users", checksum: "x"}})
+	if err == nil || !strings.Contains(err.Error(), "2_users changed after it was applied") {
+		t.Errorf("pending = %v, want a checksum mismatch on 2_users", err)
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	appliedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	migrations := []Migration{
+		{Version: 1, Name: "initial", Checksum: "a"},
+		{Version: 2, Name: "users", Checksum: "b"},
+		{Version: 4, Name: "tags", Checksum: "d"},
+	}
+	versions := map[int]appliedMigration{
+		1: {name: "initial", checksum: "a", appliedAt: appliedAt},
+		2: {name: "users", checksum: "changed", appliedAt: appliedAt},
+		3: {name: "removed", checksum: "c", appliedAt: appliedAt},
+	}
+
+	got := statuses(migrations, versions)
+	want := []struct {
+		version           int
+		name              string
+		applied           bool
+		modified, missing bool
+	}{
+		{1, "initial", true, false, false},
+		{2, "users", true, true, false},
+		{3, "removed", true, false, true},
+		{4, "tags", false, false, false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d statuses, want %d", len(got), len(want))
+	}
+	for i, st := range got {
+		w := want[i]
+		if st.Version != w.version || st.Name != w.name || (st.AppliedAt != nil) != w.applied || st.Modified != w.modified || st.Missing != w.missing {
+			t.Errorf("status %d = %+v, want %+v", i, st, w)
+		}
+	}
+	if len(versions) != 3 {
+		t.Error("statuses changed the applied versions")
+	}
+}
+
+// The migrations on file must load, be numbered from 1 without gaps and all
+// be reversible.
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Errorf("migration %d_%s, want version %d", mig.Version, mig.Name, i+1)
+		}
+		if mig.Down == "" {
+			t.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+	}
+}
@@ -1,4 +1,4 @@
--- Password: "pass_hash" for all users (for testing purposes only)
+-- Password: "pass" for all users, stored in the legacy "<password>_hash" format
 INSERT INTO
     users (
         username,
@@ -36,6 +36,9 @@ VALUES (
         950
     );
 
+-- Seeded accounts count as verified
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+
 -- Problems with solution implementations
 
 INSERT INTO
@@ -0,0 +1,233 @@
+// Package plagiarism finds submissions that share code, the way MOSS does.
+//
+// Code is reduced to normalized tokens (see tokenize), every run of
+// kgramSize tokens is hashed, and winnowing keeps the smallest hash of each
+// window of windowSize hashes as the document's fingerprints. Two programs
+// that share a run of at least kgramSize+windowSize-1 tokens are guaranteed
+// to share a fingerprint, while the fingerprints stay few.
+//
+// Fingerprints found in most submissions of a problem, like input parsing
+// boilerplate, are ignored so they don't make everyone look alike.
+package plagiarism
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+)
+
+const (
+	kgramSize  = 10
+	windowSize = 5
+
+	// MinSimilarity is the share of fingerprints a pair must have in
+	// common to be reported.
+	MinSimilarity = 0.5
+)
+
+// Submission is a program to compare. Submissions with the same owner
+// aren't compared with each other.
+type Submission struct {
+	ID       int
+	Owner    int
+	Language string
+	Code     string
+}
+
+// Region is a run of matching code, as 1-based inclusive line ranges of
+// both submissions.
+type Region struct {
+	AStart, AEnd int
+	BStart, BEnd int
+}
+
+// Match is a suspicious pair of submissions.
+type Match struct {
+	A, B       Submission
+	Similarity float64 // shared fingerprints over those of the smaller program
+	Shared     int     // fingerprints in common
+	Regions    []Region
+}
+
+type fingerprint struct {
+	hash uint64
+	pos  int // token index of the k-gram
+}
+
+type document struct {
+	sub    Submission
+	tokens []token
+	first  map[uint64]int // first position of each fingerprint
+}
+
+func newDocument(sub Submission) *document {
+	doc := &document{sub: sub, tokens: tokenize(sub.Language, sub.Code), first: map[uint64]int{}}
+	for _, fp := range winnow(kgramHashes(doc.tokens)) {
+		if _, ok := doc.first[fp.hash]; !ok {
+			doc.first[fp.hash] = fp.pos
+		}
+	}
+	return doc
+}
+
+func kgramHashes(tokens []token) []uint64 {
+	if len(tokens) < kgramSize {
+		return nil
+	}
+	hashes := make([]uint64, len(tokens)-kgramSize+1)
+	for i := range hashes {
+		h := fnv.New64a()
+		for _, t := range tokens[i : i+kgramSize] {
+			h.Write([]byte(t.text))
+			h.Write([]byte{0})
+		}
+		hashes[i] = h.Sum64()
+	}
+	return hashes
+}
+
+// winnow picks the smallest hash of every window, the rightmost on ties,
+// recording it once for as long as it stays the smallest.
+func winnow(hashes []uint64) []fingerprint {
+	var prints []fingerprint
+	if len(hashes) == 0 {
+		return prints
+	}
+	window := min(windowSize, len(hashes))
+	last := -1
+	for start := 0; start+window <= len(hashes); start++ {
+		best := start
+		for i := start; i < start+window; i++ {
+			if hashes[i] <= hashes[best] {
+				best = i
+			}
+		}
+		if best != last {
+			prints = append(prints, fingerprint{hashes[best], best})
+			last = best
+		}
+	}
+	return prints
+}
+
+// Compare finds the suspicious pairs among submissions to one problem,
+// most similar first. Only submissions in the same language are compared,
+// and of each pair of owners only their most similar submissions are kept.
+func Compare(subs []Submission) []Match {
+	byLanguage := map[string][]*document{}
+	for _, sub := range subs {
+		byLanguage[sub.Language] = append(byLanguage[sub.Language], newDocument(sub))
+	}
+
+	type owners struct{ a, b int }
+	best := map[owners]Match{}
+	for _, docs := range byLanguage {
+		ignored := commonFingerprints(docs)
+		for i, a := range docs {
+			for _, b := range docs[i+1:] {
+				if a.sub.Owner == b.sub.Owner {
+					continue
+				}
+				m, ok := compare(a, b, ignored)
+				if !ok {
+					continue
+				}
+				key := owners{min(a.sub.Owner, b.sub.Owner), max(a.sub.Owner, b.sub.Owner)}
+				if prev, seen := best[key]; !seen || m.Similarity > prev.Similarity {
+					best[key] = m
+				}
+			}
+		}
+	}
+
+	matches := make([]Match, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	slices.SortFunc(matches, func(x, y Match) int {
+		return cmp.Or(
+			cmp.Compare(y.Similarity, x.Similarity),
+			cmp.Compare(y.Shared, x.Shared),
+			cmp.Compare(x.A.ID, y.A.ID),
+			cmp.Compare(x.B.ID, y.B.ID),
+		)
+	})
+	return matches
+}
+
+// commonFingerprints are those in more than half of the owners'
+// submissions, and in at least three.
+func commonFingerprints(docs []*document) map[uint64]bool {
+	owners := map[uint64]map[int]bool{}
+	all := map[int]bool{}
+	for _, doc := range docs {
+		all[doc.sub.Owner] = true
+		for h := range doc.first {
+			if owners[h] == nil {
+				owners[h] = map[int]bool{}
+			}
+			owners[h][doc.sub.Owner] = true
+		}
+	}
+	ignored := map[uint64]bool{}
+	for h, by := range owners {
+		if len(by) >= 3 && 2*len(by) > len(all) {
+			ignored[h] = true
+		}
+	}
+	return ignored
+}
+
+func compare(a, b *document, ignored map[uint64]bool) (Match, bool) {
+	countA, countB := 0, 0
+	for h := range a.first {
+		if !ignored[h] {
+			countA++
+		}
+	}
+	for h := range b.first {
+		if !ignored[h] {
+			countB++
+		}
+	}
+	if countA == 0 || countB == 0 {
+		return Match{}, false
+	}
+
+	type hit struct{ a, b int }
+	var hits []hit
+	for h, posA := range a.first {
+		if posB, ok := b.first[h]; ok && !ignored[h] {
+			hits = append(hits, hit{posA, posB})
+		}
+	}
+	similarity := float64(len(hits)) / float64(min(countA, countB))
+	if similarity < MinSimilarity {
+		return Match{}, false
+	}
+
+	// Hits that follow each other in both programs form one region
+	slices.SortFunc(hits, func(x, y hit) int { return cmp.Or(cmp.Compare(x.a, y.a), cmp.Compare(x.b, y.b)) })
+	var regions []Region
+	aStart, aEnd, bStart, bEnd := -1, -1, -1, -1
+	flush := func() {
+		if aStart >= 0 {
+			regions = append(regions, Region{
+				AStart: a.tokens[aStart].line, AEnd: a.tokens[aEnd-1].line,
+				BStart: b.tokens[bStart].line, BEnd: b.tokens[bEnd-1].line,
+			})
+		}
+	}
+	for _, h := range hits {
+		if aStart >= 0 && h.a <= aEnd+windowSize && h.b >= bStart && h.b <= bEnd+windowSize {
+			aEnd = max(aEnd, h.a+kgramSize)
+			bEnd = max(bEnd, h.b+kgramSize)
+			continue
+		}
+		flush()
+		aStart, aEnd, bStart, bEnd = h.a, h.a+kgramSize, h.b, h.b+kgramSize
+	}
+	flush()
+
+	return Match{A: a.sub, B: b.sub, Similarity: similarity, Shared: len(hits), Regions: regions}, true
+}
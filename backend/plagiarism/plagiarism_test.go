@@ -0,0 +1,130 @@
+package plagiarism
+
+import (
+	"strings"
+	"testing"
+)
+
+const sumPairs = `package main
+
+import "fmt"
+
+func main() {
+	var n int
+	fmt.Scan(&n)
+	nums := make([]int, n)
+	for i := range nums {
+		fmt.Scan(&nums[i])
+	}
+	best := 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if nums[i]+nums[j] > best {
+				best = nums[i] + nums[j]
+			}
+		}
+	}
+	fmt.Println(best)
+}
+`
+
+const countWords = `package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+func main() {
+	seen := map[string]int{}
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		for _, w := range strings.Fields(sc.Text()) {
+			seen[strings.ToLower(w)]++
+		}
+	}
+	total := 0
+	for range seen {
+		total++
+	}
+	println(total)
+}
+`
+
+func TestCompare(t *testing.T) {
+	renamed := strings.NewReplacer("nums", "values", "best := 0", "answer := 1", "best", "answer", "n int", "count int", "(&n)", "(&count)").Replace(sumPairs)
+	commented := strings.Replace(sumPairs, "best := 0", "// the largest sum\n\tbest := 0 /* so far */", 1)
+
+	tests := []struct {
+		name  string
+		a, b  Submission
+		match bool
+	}{
+		{"identical code", Submission{1, 10, "go", sumPairs}, Submission{2, 20, "go", sumPairs}, true},
+		{"renamed variables and constants", Submission{1, 10, "go", sumPairs}, Submission{2, 20, "go", renamed}, true},
+		{"added comments", Submission{1, 10, "go", sumPairs}, Submission{2, 20, "go", commented}, true},
+		{"unrelated code", Submission{1, 10, "go", sumPairs}, Submission{2, 20, "go", countWords}, false},
+		{"same owner", Submission{1, 10, "go", sumPairs}, Submission{2, 10, "go", sumPairs}, false},
+		{"different languages", Submission{1, 10, "go", sumPairs}, Submission{2, 20, "c", sumPairs}, false},
+		{"too short to compare", Submission{1, 10, "go", "x := 1"}, Submission{2, 20, "go", "x := 1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := Compare([]Submission{tt.a, tt.b})
+			if !tt.match {
+				if len(matches) != 0 {
+					t.Fatalf("got %d matches with similarity %v, want none", len(matches), matches[0].Similarity)
+				}
+				return
+			}
+			if len(matches) != 1 {
+				t.Fatalf("got %d matches, want 1", len(matches))
+			}
+			m := matches[0]
+			if m.A.ID != tt.a.ID || m.B.ID != tt.b.ID {
+				t.Errorf("matched %d and %d, want %d and %d", m.A.ID, m.B.ID, tt.a.ID, tt.b.ID)
+			}
+			if m.Similarity != 1 {
+				t.Errorf("similarity = %v, want 1", m.Similarity)
+			}
+			if len(m.Regions) == 0 {
+				t.Error("no matching regions")
+			}
+		})
+	}
+}
+
+func TestCompareIgnoresCommonCode(t *testing.T) {
+	// Everyone shares the boilerplate, two of them also share the solution
+	var subs []Submission
+	for owner := 1; owner <= 4; owner++ {
+		code := countWords
+		if owner <= 2 {
+			code += "\n" + strings.Replace(sumPairs, "package main\n", "", 1)
+		}
+		subs = append(subs, Submission{ID: owner, Owner: owner, Language: "go", Code: code})
+	}
+
+	matches := Compare(subs)
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	if m := matches[0]; m.A.Owner != 1 || m.B.Owner != 2 {
+		t.Errorf("matched owners %d and %d, want 1 and 2", m.A.Owner, m.B.Owner)
+	}
+}
+
+func TestCompareKeepsBestPairPerOwners(t *testing.T) {
+	matches := Compare([]Submission{
+		{ID: 1, Owner: 10, Language: "go", Code: sumPairs},
+		{ID: 2, Owner: 20, Language: "go", Code: sumPairs},
+		{ID: 3, Owner: 20, Language: "go", Code: sumPairs + "\nfunc unused() { println(1, 2, 3, 4, 5, 6, 7, 8) }\n"},
+	})
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	if matches[0].B.ID != 2 {
+		t.Errorf("kept submission %d, want the identical one, 2", matches[0].B.ID)
+	}
+}
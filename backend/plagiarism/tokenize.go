@@ -0,0 +1,142 @@
+package plagiarism
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a normalized lexeme: identifiers become "V", numbers "N" and
+// string or character literals "S", so renaming variables or changing
+// constants doesn't hide a copy. Keywords, operators and punctuation are
+// kept. Whitespace and comments are dropped.
+type token struct {
+	text string
+	line int
+}
+
+var keywords = map[string]map[string]bool{}
+
+func init() {
+	c := "auto break case char const continue default do double else enum extern float for goto if int long " +
+		"register return short signed sizeof static struct switch typedef union unsigned void volatile while"
+	cpp := c + " bool catch class delete false friend inline namespace new nullptr operator private " +
+		"protected public template this throw true try typename using virtual"
+	java := "abstract boolean break byte case catch char class continue default do double else extends final " +
+		"finally float for if implements import instanceof int interface long new null package private " +
+		"protected public return short static super switch this throw throws true false try void while"
+	golang := "break case chan const continue default defer else fallthrough for func go goto if import " +
+		"interface map package range return select struct switch type var nil true false"
+	python := "False None True and as assert async await break class continue def del elif else except " +
+		"finally for from global if import in is lambda nonlocal not or pass raise return try while with yield"
+
+	for lang, words := range map[string]string{"c": c, "cpp": cpp, "java": java, "go": golang, "python": python} {
+		keywords[lang] = map[string]bool{}
+		for _, word := range strings.Fields(words) {
+			keywords[lang][word] = true
+		}
+	}
+}
+
+// tokenize splits code in one of the judge's languages into normalized
+// tokens. Unknown languages are read with C-like rules.
+func tokenize(language, code string) []token {
+	src := []rune(code)
+	hashComments := language == "python"
+	// Preprocessor lines are mostly includes, the same in every solution
+	preprocessor := language == "c" || language == "cpp"
+	kw := keywords[language]
+
+	var tokens []token
+	line := 1
+	skipLine := func(i int) int {
+		for i < len(src) && src[i] != '\n' {
+			i++
+		}
+		return i
+	}
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+
+		case unicode.IsSpace(r):
+			i++
+
+		case hashComments && r == '#', preprocessor && r == '#':
+			i = skipLine(i)
+
+		case !hashComments && r == '/' && i+1 < len(src) && src[i+1] == '/':
+			i = skipLine(i)
+
+		case !hashComments && r == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				if src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i += 2
+
+		case r == '"' || r == '\'' || r == '`':
+			start := line
+			i = skipString(src, i, &line, language)
+			tokens = append(tokens, token{"S", start})
+
+		case unicode.IsDigit(r):
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '_' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{"N", line})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '_') {
+				i++
+			}
+			word := string(src[start:i])
+			if !kw[word] {
+				word = "V"
+			}
+			tokens = append(tokens, token{word, line})
+
+		default:
+			tokens = append(tokens, token{string(r), line})
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipString returns the index after the literal starting at i, counting
+// the lines it spans. Python triple quotes and Go raw strings may span
+// lines, other literals end at the line.
+func skipString(src []rune, i int, line *int, language string) int {
+	quote := src[i]
+	if language == "python" && i+2 < len(src) && src[i+1] == quote && src[i+2] == quote {
+		i += 3
+		for i < len(src) && !(src[i] == quote && i+2 < len(src) && src[i+1] == quote && src[i+2] == quote) {
+			if src[i] == '\n' {
+				*line++
+			}
+			i++
+		}
+		return min(i+3, len(src))
+	}
+
+	raw := quote == '`'
+	for i++; i < len(src) && src[i] != quote; i++ {
+		switch {
+		case src[i] == '\\' && !raw:
+			i++
+		case src[i] == '\n' && raw:
+			*line++
+		case src[i] == '\n':
+			// Unterminated, don't swallow the rest of the file
+			return i
+		}
+	}
+	return min(i+1, len(src))
+}
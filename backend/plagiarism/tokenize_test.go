@@ -0,0 +1,51 @@
+package plagiarism
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		code     string
+		want     string
+	}{
+		{"go identifiers and numbers", "go", "x := 42 + y1", "V : = N + V"},
+		{"go keywords", "go", "for i := range xs { return }", "for V : = range V { return }"},
+		{"go raw string", "go", "s := `a\nb`", "V : = S"},
+		{"go comments", "go", "a // b c\n/* d\ne */ f", "V V"},
+		{"c preprocessor", "c", "#include <stdio.h>\nint a = 'c';", "int V = S ;"},
+		{"cpp keywords", "cpp", "class A { public: bool ok = true; };", "class V { public : bool V = true ; } ;"},
+		{"java escaped quote", "java", `String s = "a\"b";`, `V V = S ;`},
+		{"java number with suffix", "java", "long n = 10L + 1.5;", "long V = N + N ;"},
+		{"python comments and strings", "python", "def f(s): # x\n    return 'y' + \"\"\"z\n\"\"\"", "def V ( V ) : return S + S"},
+		{"python keywords are case sensitive", "python", "True true", "True V"},
+		{"unterminated string", "c", "a = \"b\nc", "V = S V"},
+		{"unknown language", "rust", "fn main() {}", "V V ( ) { }"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, tok := range tokenize(tt.language, tt.code) {
+				got = append(got, tok.text)
+			}
+			if want := strings.Fields(tt.want); !slices.Equal(got, want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.code, got, want)
+			}
+		})
+	}
+}
+
+func TestTokenizeLines(t *testing.T) {
+	code := "a /* x\ny */ b\n`c\nd` e\n\nf"
+	var got []int
+	for _, tok := range tokenize("go", code) {
+		got = append(got, tok.line)
+	}
+	if want := []int{1, 2, 3, 4, 6}; !slices.Equal(got, want) {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+}
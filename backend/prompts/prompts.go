@@ -0,0 +1,205 @@
+// Package prompts holds the prompts of the AI features as text/template
+// files.
+//
+// A prompt is a file named NAME.vN.tmpl; the highest N of a name is the one
+// in use. To change a prompt, add the next version instead of editing the
+// file, so results stay traceable to the prompt that produced them: every
+// stored result records its version, e.g. "feedback.v2".
+//
+// Templates execute with Data. Fields that don't apply to a prompt are left
+// empty, and a template that names an unknown field fails to render.
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed *.tmpl
+var files embed.FS
+
+const (
+	Explanation = "explanation"
+	Feedback    = "feedback"
+	Hint        = "hint"
+	TestCases   = "test_cases"
+)
+
+var fileName = regexp.MustCompile(`^(\w+)\.v(\d+)\.tmpl$`)
+
+var ErrUnknownPrompt = errors.New("unknown prompt")
+
+// Data is what a prompt can use.
+type Data struct {
+	Problem Problem
+
+	// Feedback: the user's code and, when they submitted it, how it did
+	Code        string
+	Language    string
+	Verdict     string // e.g. "wrong answer", empty if the code wasn't submitted
+	Error       string // compiler or runtime error output
+	FailingTest *Test  // first failing test, if its data is visible
+	CodeChanged bool   // Verdict is of an earlier version of Code
+
+	HintLevel int // 1 nudge, 2 key idea, 3 pseudo-code outline
+	Count     int // test cases to propose
+}
+
+type Problem struct {
+	Title            string
+	Description      string
+	Constraints      []string
+	Explanation      string // generated from the reference solution, may be empty
+	SolutionLanguage string
+	SolutionCode     string
+}
+
+type Test struct {
+	Input          string
+	ExpectedOutput string
+	Output         string
+}
+
+// Prompt is a rendered prompt and the version of its template.
+type Prompt struct {
+	Text    string
+	Version string
+}
+
+type Info struct {
+	Name     string
+	Version  string
+	Source   string
+	Versions []string // every version on file, oldest first
+}
+
+// Set is the loaded prompts, by name.
+type Set struct {
+	templates map[string]*template.Template
+	infos     map[string]*Info
+}
+
+// Load reads the prompts from dir, or the embedded ones when dir is empty.
+func Load(dir string) (*Set, error) {
+	fsys := fs.FS(files)
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]int{}
+	set := &Set{templates: map[string]*template.Template{}, infos: map[string]*Info{}}
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		name := m[1]
+		version, _ := strconv.Atoi(m[2])
+		info, ok := set.infos[name]
+		if !ok {
+			info = &Info{Name: name}
+			set.infos[name] = info
+		}
+		info.Versions = append(info.Versions, fmt.Sprintf("%s.v%d", name, version))
+		if ok && version < latest[name] {
+			continue
+		}
+
+		source, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(entry.Name()).Option("missingkey=error").Parse(string(source))
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt %s: %w", entry.Name(), err)
+		}
+		// Unknown fields only fail when they're reached, so try the branches now
+		for _, data := range checkData() {
+			if err := tmpl.Execute(io.Discard, data); err != nil {
+				return nil, fmt.Errorf("invalid prompt %s: %w", entry.Name(), err)
+			}
+		}
+		latest[name] = version
+		set.templates[name] = tmpl
+		info.Version = fmt.Sprintf("%s.v%d", name, version)
+		info.Source = string(source)
+	}
+
+	for _, name := range []string{Explanation, Feedback, Hint, TestCases} {
+		if set.templates[name] == nil {
+			return nil, fmt.Errorf("missing prompt %s", name)
+		}
+	}
+	for _, info := range set.infos {
+		slices.SortFunc(info.Versions, func(a, b string) int { return versionNumber(a) - versionNumber(b) })
+	}
+	return set, nil
+}
+
+// checkData is an empty Data and fully populated ones, one per hint level.
+func checkData() []Data {
+	data := []Data{{}}
+	for level := 1; level <= 3; level++ {
+		data = append(data, Data{
+			Problem: Problem{
+				Title:            "Title",
+				Description:      "Description",
+				Constraints:      []string{"Constraint"},
+				Explanation:      "Explanation",
+				SolutionLanguage: "Language",
+				SolutionCode:     "Code",
+			},
+			Code:        "Code",
+			Language:    "Language",
+			Verdict:     "wrong answer",
+			Error:       "Error",
+			FailingTest: &Test{Input: "Input", ExpectedOutput: "Expected", Output: "Output"},
+			CodeChanged: true,
+			HintLevel:   level,
+			Count:       1,
+		})
+	}
+	return data
+}
+
+func versionNumber(version string) int {
+	n, _ := strconv.Atoi(version[strings.LastIndex(version, ".v")+2:])
+	return n
+}
+
+// Render fills in the named prompt.
+func (s *Set) Render(name string, data Data) (Prompt, error) {
+	tmpl, ok := s.templates[name]
+	if !ok {
+		return Prompt{}, fmt.Errorf("%w %q", ErrUnknownPrompt, name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return Prompt{}, fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+	return Prompt{Text: strings.TrimSpace(buf.String()), Version: s.infos[name].Version}, nil
+}
+
+// List describes the prompts in use, by name.
+func (s *Set) List() []Info {
+	infos := make([]Info, 0, len(s.infos))
+	for _, info := range s.infos {
+		infos = append(infos, *info)
+	}
+	slices.SortFunc(infos, func(a, b Info) int { return strings.Compare(a.Name, b.Name) })
+	return infos
+}
@@ -0,0 +1,93 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEmbeddedPrompts(t *testing.T) {
+	set, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{Explanation, Feedback, Hint, TestCases} {
+		for _, data := range checkData() {
+			prompt, err := set.Render(name, data)
+			if err != nil {
+				t.Errorf("Render(%s): %v", name, err)
+				continue
+			}
+			if prompt.Text == "" {
+				t.Errorf("Render(%s) is empty", name)
+			}
+		}
+	}
+}
+
+// writePrompts writes a prompt directory with a v1 of every prompt and the
+// given extra files.
+func writePrompts(t *testing.T, extra map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{Explanation, Feedback, Hint, TestCases} {
+		files[name+".v1.tmpl"] = name + " v1"
+	}
+	for file, source := range extra {
+		files[file] = source
+	}
+	for file, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadVersionOrder(t *testing.T) {
+	dir := writePrompts(t, map[string]string{
+		"feedback.v2.tmpl":  "feedback v2",
+		"feedback.v10.tmpl": "feedback v10",
+	})
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prompt, err := set.Render(Feedback, Data{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt.Version != "feedback.v10" || prompt.Text != "feedback v10" {
+		t.Errorf("Render(feedback) = %+v, want feedback.v10", prompt)
+	}
+
+	i := slices.IndexFunc(set.List(), func(info Info) bool { return info.Name == Feedback })
+	want := []string{"feedback.v1", "feedback.v2", "feedback.v10"}
+	if got := set.List()[i].Versions; !slices.Equal(got, want) {
+		t.Errorf("Versions = %v, want %v", got, want)
+	}
+}
+
+func TestLoadInvalidPrompt(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"syntax", "{{if .Code}}"},
+		{"unknown field", "{{.Foo}}"},
+		{"unknown nested field", "{{.Problem.Foo}}"},
+		{"unknown field in a branch", "{{with .FailingTest}}{{.Foo}}{{end}}"},
+		{"unknown field at one hint level", "{{if eq .HintLevel 3}}{{.Problem.Foo}}{{end}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePrompts(t, map[string]string{"hint.v2.tmpl": tt.source})
+			if _, err := Load(dir); err == nil {
+				t.Error("Load() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Test data referenced by hash lives in the backend's blob store (a shared
+// directory or an S3-compatible bucket). Blobs are content-addressed and
+// never change, so anything fetched is cached locally by hash for good.
+
+const maxResultDataLen = 1024 // echo at most this much of blob-backed tests in results
+
+type BlobFetcher interface {
+	Fetch(ctx context.Context, hash string) ([]byte, error)
+}
+
+func newBlobFetcher() (BlobFetcher, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "", "fs":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "./data/blobs"
+		}
+		return &fileBlobFetcher{dir: dir}, nil
+	case "s3":
+		endpoint, err := url.Parse(os.Getenv("S3_ENDPOINT"))
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid S3_ENDPOINT %q", os.Getenv("S3_ENDPOINT"))
+		}
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		cacheDir := os.Getenv("TEST_CACHE_DIR")
+		if cacheDir == "" {
+			cacheDir = "/tmp/testcache"
+		}
+		return &cachedBlobFetcher{
+			dir: cacheDir,
+			source: &s3BlobFetcher{
+				endpoint:  endpoint,
+				bucket:    os.Getenv("S3_BUCKET"),
+				region:    region,
+				accessKey: os.Getenv("S3_ACCESS_KEY"),
+				secretKey: os.Getenv("S3_SECRET_KEY"),
+				client:    &http.Client{Timeout: 5 * time.Minute},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", os.Getenv("BLOB_STORE"))
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// fileBlobFetcher reads the backend's blob directory directly, so it needs
+// no cache of its own.
+type fileBlobFetcher struct {
+	dir string
+}
+
+func (f *fileBlobFetcher) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	if !validBlobHash(hash) {
+		return nil, fmt.Errorf("invalid blob hash %q", hash)
+	}
+	return os.ReadFile(filepath.Join(f.dir, hash[:2], hash))
+}
+
+type cachedBlobFetcher struct {
+	dir    string
+	source BlobFetcher
+}
+
+func (c *cachedBlobFetcher) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	if !validBlobHash(hash) {
+		return nil, fmt.Errorf("invalid blob hash %q", hash)
+	}
+
+	path := filepath.Join(c.dir, hash)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	data, err := c.source.Fetch(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if sha256Hex(data) != hash {
+		return nil, fmt.Errorf("blob %s failed hash verification", hash)
+	}
+
+	// Caching is best effort; a failure here only costs a refetch later
+	if err := os.MkdirAll(c.dir, 0755); err == nil {
+		if tmp, err := os.CreateTemp(c.dir, hash+".tmp-*"); err == nil {
+			_, werr := tmp.Write(data)
+			tmp.Close()
+			if werr == nil {
+				os.Rename(tmp.Name(), path)
+			}
+			os.Remove(tmp.Name())
+		}
+	}
+	return data, nil
+}
+
+type s3BlobFetcher struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3BlobFetcher) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + hash
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blob %s: %w", hash, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch blob %s: %s", hash, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header for a GET.
+func (s *s3BlobFetcher) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(nil)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// resolveTestCases fills in the data of tests that only carry hashes.
+func resolveTestCases(ctx context.Context, fetcher BlobFetcher, payload *ExecuteCodePayload) error {
+	for i := range payload.TestCases {
+		tc := &payload.TestCases[i]
+		if tc.InputHash != "" {
+			data, err := fetcher.Fetch(ctx, tc.InputHash)
+			if err != nil {
+				return err
+			}
+			tc.Input = string(data)
+		}
+		if tc.ExpectedOutputHash != "" {
+			data, err := fetcher.Fetch(ctx, tc.ExpectedOutputHash)
+			if err != nil {
+				return err
+			}
+			tc.ExpectedOutput = string(data)
+		}
+	}
+	return nil
+}
+
+// trimBlobResults keeps results of blob-backed tests small, so large test
+// data isn't sent back through Redis. Runs that produce test data keep their
+// full output, since the backend stores it.
+func trimBlobResults(payload *ExecuteCodePayload, result *ExecuteCodeResponse) {
+	producesData := payload.ExecutionType == "generate" || payload.ExecutionType == "generate_output" ||
+		payload.ExecutionType == "propose_output"
+	for i, tc := range payload.TestCases {
+		if i >= len(result.Results) || (tc.InputHash == "" && tc.ExpectedOutputHash == "") {
+			continue
+		}
+		res := &result.Results[i]
+		res.Input = truncate(res.Input, maxResultDataLen)
+		res.ExpectedOutput = truncate(res.ExpectedOutput, maxResultDataLen)
+		if !producesData {
+			res.Output = truncate(res.Output, maxResultDataLen)
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
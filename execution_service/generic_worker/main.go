@@ -23,9 +23,12 @@ import (
 
 // Define payload and response structures
 type ProblemTestCase struct {
-	ID             int
-	Input          string
-	ExpectedOutput string
+	ID                 int
+	Input              string
+	ExpectedOutput     string
+	InputHash          string // set when the data is in the blob store
+	ExpectedOutputHash string
+	Args               []string // command-line arguments, set for generator runs
 }
 
 type TestResult struct {
@@ -63,7 +66,21 @@ type Executor interface {
 }
 
 // BaseExecutor with common utilities
-type BaseExecutor struct{}
+type BaseExecutor struct {
+	// skipOutputCheck is set for author tooling runs (generators, validators,
+	// output generation), where there is no expected output to compare with.
+	skipOutputCheck bool
+}
+
+// Execution types that don't compare output against an expected output
+var uncheckedExecutionTypes = map[string]bool{
+	"generate":        true,
+	"validate_input":  true,
+	"generate_output": true,
+	// checks of AI-proposed tests
+	"propose_validate": true,
+	"propose_output":   true,
+}
 
 // Optimized memory usage monitoring by reading /proc/[pid]/status
 func (b *BaseExecutor) getMemoryUsage(pid int) int {
@@ -219,7 +236,7 @@ func (b *BaseExecutor) mapResult(
 	expected := strings.TrimSpace(tc.ExpectedOutput)
 	output = strings.TrimSpace(output)
 
-	if status == "accepted" && output != expected {
+	if status == "accepted" && !b.skipOutputCheck && output != expected {
 		status = "wrong answer"
 	}
 
@@ -253,7 +270,7 @@ func (e *PythonExecutor) Execute(payload *ExecuteCodePayload) *ExecuteCodeRespon
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeLimitMS)*time.Millisecond)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "python3", sourcePath)
+		cmd := exec.CommandContext(ctx, "python3", append([]string{sourcePath}, tc.Args...)...)
 		output, runtimeMS, memKB, status := e.runCommand(ctx, cmd, tc.Input, payload.MemoryLimitKB)
 		return e.mapResult(tc, output, runtimeMS, memKB, status)
 	})
@@ -296,7 +313,7 @@ func (e *JavaExecutor) Execute(payload *ExecuteCodePayload) *ExecuteCodeResponse
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeLimitMS)*time.Millisecond)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "java", "-cp", tempDir, "Main")
+		cmd := exec.CommandContext(ctx, "java", append([]string{"-cp", tempDir, "Main"}, tc.Args...)...)
 		output, runtimeMS, memKB, execStatus := e.runCommand(ctx, cmd, tc.Input, payload.MemoryLimitKB)
 		return e.mapResult(tc, output, runtimeMS, memKB, execStatus)
 	})
@@ -341,7 +358,7 @@ func (e *CppExecutor) Execute(payload *ExecuteCodePayload) *ExecuteCodeResponse
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeLimitMS)*time.Millisecond)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, binPath)
+		cmd := exec.CommandContext(ctx, binPath, tc.Args...)
 		output, runtimeMS, memKB, execStatus := e.runCommand(ctx, cmd, tc.Input, payload.MemoryLimitKB)
 		return e.mapResult(tc, output, runtimeMS, memKB, execStatus)
 	})
@@ -386,7 +403,7 @@ func (e *CExecutor) Execute(payload *ExecuteCodePayload) *ExecuteCodeResponse {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeLimitMS)*time.Millisecond)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, binPath)
+		cmd := exec.CommandContext(ctx, binPath, tc.Args...)
 		output, runtimeMS, memKB, execStatus := e.runCommand(ctx, cmd, tc.Input, payload.MemoryLimitKB)
 		return e.mapResult(tc, output, runtimeMS, memKB, execStatus)
 	})
@@ -431,7 +448,7 @@ func (e *GoExecutor) Execute(payload *ExecuteCodePayload) *ExecuteCodeResponse {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(payload.TimeLimitMS)*time.Millisecond)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, binPath)
+		cmd := exec.CommandContext(ctx, binPath, tc.Args...)
 		output, runtimeMS, memKB, execStatus := e.runCommand(ctx, cmd, tc.Input, payload.MemoryLimitKB)
 		return e.mapResult(tc, output, runtimeMS, memKB, execStatus)
 	})
@@ -444,25 +461,26 @@ func (e *GoExecutor) Execute(payload *ExecuteCodePayload) *ExecuteCodeResponse {
 }
 
 // Executor factory
-func newExecutor(language string) Executor {
-	switch language {
+func newExecutor(task *ExecuteCodePayload) Executor {
+	base := BaseExecutor{skipOutputCheck: uncheckedExecutionTypes[task.ExecutionType]}
+	switch task.Language {
 	case "python":
-		return &PythonExecutor{}
+		return &PythonExecutor{base}
 	case "java":
-		return &JavaExecutor{}
+		return &JavaExecutor{base}
 	case "cpp":
-		return &CppExecutor{}
+		return &CppExecutor{base}
 	case "c":
-		return &CExecutor{}
+		return &CExecutor{base}
 	case "go":
-		return &GoExecutor{}
+		return &GoExecutor{base}
 	default:
-		return &PythonExecutor{} // Default to Python
+		return &PythonExecutor{base} // Default to Python
 	}
 }
 
 // Worker and main functions
-func startWorker(ctx context.Context, rdb *redis.Client, wg *sync.WaitGroup) {
+func startWorker(ctx context.Context, rdb *redis.Client, blobs BlobFetcher, wg *sync.WaitGroup) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -496,8 +514,15 @@ func startWorker(ctx context.Context, rdb *redis.Client, wg *sync.WaitGroup) {
 
 				log.Printf("🔧 Processing task %d (%s)", task.ID, task.Language)
 
-				executor := newExecutor(task.Language)
-				result := executor.Execute(&task)
+				var result *ExecuteCodeResponse
+				if err := resolveTestCases(ctx, blobs, &task); err != nil {
+					log.Printf("❌ Failed to fetch test data for task %d: %v", task.ID, err)
+					result = (&BaseExecutor{}).errorResponse(&task, "failed to fetch test data")
+				} else {
+					executor := newExecutor(&task)
+					result = executor.Execute(&task)
+				}
+				trimBlobResults(&task, result)
 
 				data, _ := json.Marshal(result)
 				if err := rdb.RPush(ctx, "results_queue", data).Err(); err != nil {
@@ -518,6 +543,11 @@ func main() {
 		redisAddr = "localhost:6379"
 	}
 
+	blobs, err := newBlobFetcher()
+	if err != nil {
+		log.Fatalf("Failed to set up the test data store: %v", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 
@@ -532,7 +562,7 @@ func main() {
 	defer rdb.Close()
 
 	// Start worker
-	startWorker(ctx, rdb, &wg)
+	startWorker(ctx, rdb, blobs, &wg)
 
 	// Wait for shutdown signal
 	<-sigs
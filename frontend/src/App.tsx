@@ -10,6 +10,8 @@ import AdminProblemPage from "./pages/AdminProblemPage";
 import ProblemForm from "./components/admin/ProblemForm";
 import Navbar from "./components/Navbar";
 import UserProfile from "./pages/UserProfile";
+import VerifyEmailPage from "./pages/VerifyEmailPage";
+import ResetPasswordPage from "./pages/ResetPasswordPage";
 import { ToastContainer } from 'react-toastify';
 import 'react-toastify/dist/ReactToastify.css';
 
@@ -22,6 +24,8 @@ const App = () => {
         <Routes>
           <Route path="/" element={<Navigate to="/problems" />} />
           <Route path="/auth" element={<AuthPage />} />
+          <Route path="/verify-email" element={<VerifyEmailPage />} />
+          <Route path="/reset-password" element={<ResetPasswordPage />} />
           <Route path="/problems" element={<ProblemListPage />} />
           <Route path="/problem/:slug" element={<ProblemDetailPage />} />
           <Route path="/contests" element={<ContestListPage />} />
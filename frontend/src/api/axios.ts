@@ -1,7 +1,7 @@
 import axios from 'axios';
 
 const defaultBackendUrl = 'https://turbo-waddle-7v79v67qjwpw2rr76-8080.app.github.dev';
-const baseURL = import.meta.env.VITE_API_BASE_URL || defaultBackendUrl;
+export const baseURL = import.meta.env.VITE_API_BASE_URL || defaultBackendUrl;
 
 const axiosInstance = axios.create({
   baseURL,
@@ -11,4 +11,33 @@ const axiosInstance = axios.create({
   withCredentials: true,
 });
 
+// Access tokens are short-lived: on a 401, trade the refresh cookie for a new
+// one and retry the request once. Concurrent requests share a single refresh.
+let refreshing: Promise<unknown> | null = null;
+
+axiosInstance.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config;
+    const skip = ['/login', '/login/2fa', '/login/2fa/setup', '/signup', '/refresh', '/logout'];
+    if (error.response?.status !== 401 || original._retried || skip.includes(original.url)) {
+      return Promise.reject(error);
+    }
+
+    original._retried = true;
+    refreshing ??= axiosInstance.post('/refresh').finally(() => {
+      refreshing = null;
+    });
+    try {
+      await refreshing;
+    } catch (refreshError) {
+      // 409: another tab refreshed first and its new cookies are already set
+      if (!axios.isAxiosError(refreshError) || refreshError.response?.status !== 409) {
+        return Promise.reject(error);
+      }
+    }
+    return axiosInstance(original);
+  },
+);
+
 export default axiosInstance;
@@ -1,9 +1,12 @@
 // src/api/endpoints.ts
-import axios from './axios';
+import axios, { baseURL } from './axios';
 import type {
     SignupPayload,
     LoginPayload,
     OkResponse,
+    LoginResponse,
+    TwoFactorSetupResponse,
+    TwoFactorLoginResponse,
     IdResponse,
     User,
     ProblemInfo,
@@ -16,6 +19,11 @@ import type {
     Discussion,
     AddVotePayload,
     AddCommentPayload,
+    JobResponse,
+    AIJob,
+    HintLadder,
+    ProblemHint,
+    AIUsageStatus,
 } from '../types';
 
 // Auth
@@ -23,11 +31,29 @@ export const signup = (data: SignupPayload) =>
     axios.post<OkResponse>('/signup', data);
 
 export const login = (data: LoginPayload) =>
-    axios.post<OkResponse>('/login', data);
+    axios.post<LoginResponse>('/login', data);
+
+export const beginTwoFactorLoginSetup = (Challenge: string) =>
+    axios.post<TwoFactorSetupResponse>('/login/2fa/setup', { Challenge });
+
+export const completeTwoFactorLogin = (Challenge: string, Code: string) =>
+    axios.post<TwoFactorLoginResponse>('/login/2fa', { Challenge, Code });
 
 export const logout = () =>
     axios.post<OkResponse>('/logout');
 
+export const verifyEmail = (Token: string) =>
+    axios.post<OkResponse>('/verify-email', { Token });
+
+export const resendVerificationEmail = () =>
+    axios.post<OkResponse>('/verify-email/resend');
+
+export const forgotPassword = (Email: string) =>
+    axios.post<OkResponse>('/password/forgot', { Email });
+
+export const resetPassword = (Token: string, Password: string) =>
+    axios.post<OkResponse>('/password/reset', { Token, Password });
+
 // Profile
 export const getCurrentUser = () =>
     axios.get<User>(`/me`);
@@ -116,4 +142,78 @@ export const commentDiscussion = (data: AddCommentPayload) =>
     axios.post<IdResponse>('/discussion/comment', data);
 
 export const aiFeedback = (ProblemID: number, Code: string) =>
-    axios.post<{ Feedback: string }>(`/feedback`, { ProblemID, Code });
+    axios.post<JobResponse>(`/feedback`, { ProblemID, Code });
+
+export const getAIJob = (jobId: number) =>
+    axios.get<AIJob>(`/ai-jobs/${jobId}`);
+
+export const getAIUsage = () =>
+    axios.get<AIUsageStatus>('/me/ai-usage');
+
+export const getHints = (problemId: number) =>
+    axios.get<HintLadder>(`/problems/${problemId}/hints`);
+
+export const revealHint = (problemId: number, level: number) =>
+    axios.post<ProblemHint>(`/problems/${problemId}/hints/${level}`);
+
+// Streams the feedback over server-sent events, passing each piece of text
+// to onChunk, and resolves with the whole feedback. Axios can't read a
+// response as it arrives, so this uses fetch and refreshes the session itself.
+export const streamFeedback = async (
+    ProblemID: number,
+    Code: string,
+    onChunk: (text: string) => void,
+    signal?: AbortSignal,
+): Promise<string> => {
+    const post = () => fetch(`${baseURL}/feedback/stream`, {
+        method: 'POST',
+        credentials: 'include',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ ProblemID, Code }),
+        signal,
+    });
+
+    let res = await post();
+    if (res.status === 401) {
+        await axios.post('/refresh');
+        res = await post();
+    }
+    if (!res.ok || !res.body) {
+        throw new Error((await res.text()).trim() || res.statusText);
+    }
+
+    const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = '';
+    for (;;) {
+        const { value, done } = await reader.read();
+        if (done) {
+            break;
+        }
+        buffer += value;
+
+        let end;
+        while ((end = buffer.indexOf('\n\n')) >= 0) {
+            const block = buffer.slice(0, end);
+            buffer = buffer.slice(end + 2);
+
+            let event = 'message';
+            let data = '';
+            for (const line of block.split('\n')) {
+                if (line.startsWith('event: ')) {
+                    event = line.slice(7);
+                } else if (line.startsWith('data: ')) {
+                    data += line.slice(6);
+                }
+            }
+            const payload = JSON.parse(data);
+            if (event === 'chunk') {
+                onChunk(payload.text);
+            } else if (event === 'done') {
+                return payload.feedback;
+            } else if (event === 'error') {
+                throw new Error(payload.error);
+            }
+        }
+    }
+    throw new Error('the feedback stream ended early');
+};
@@ -1,5 +1,6 @@
-import React, { useState } from 'react';
-import { aiFeedback } from '../api/endpoints';
+import React, { useEffect, useRef, useState } from 'react';
+import { getAIUsage, streamFeedback } from '../api/endpoints';
+import type { AIUsageStatus } from '../types';
 import ReactMarkdown from 'react-markdown';
 import remarkGfm from 'remark-gfm';
 import { AxiosError } from 'axios';
@@ -16,27 +17,52 @@ const FeedbackTab: React.FC<FeedbackTabProps> = ({ problemID, code, feedback, se
     const [loading, setLoading] = useState(false);
     const [error, setError] = useState<string | null>(null);
     const [hasFetched, setHasFetched] = useState(false);
+    const [usage, setUsage] = useState<AIUsageStatus | null>(null);
+    const abort = useRef<AbortController | null>(null);
+
+    const loadUsage = () => {
+        getAIUsage().then((res) => setUsage(res.data)).catch(() => setUsage(null));
+    };
+
+    // Show the quota, and stop the generation when leaving the tab
+    useEffect(() => {
+        loadUsage();
+        return () => abort.current?.abort();
+    }, []);
 
     const fetchFeedback = async () => {
         setLoading(true);
         setError(null);
+        abort.current?.abort();
+        const controller = new AbortController();
+        abort.current = controller;
         try {
-            const res = await aiFeedback(problemID, code);
-            setFeedback(res.data.Feedback || 'No feedback provided.');
+            let text = '';
+            setFeedback('');
+            const result = await streamFeedback(problemID, code, (chunk) => {
+                text += chunk;
+                setFeedback(text);
+            }, controller.signal);
+            setFeedback(result || 'No feedback provided.');
         } catch (err) {
-            if (err instanceof AxiosError) {
-                toast(err.response?.data || "unknown error", {
-                    type: 'error',
-                    autoClose: 2000,
-                    position: 'bottom-right',
-                })
+            if (controller.signal.aborted) {
+                return;
             }
+            const message = err instanceof AxiosError ? err.response?.data : (err as Error).message;
+            toast(message || "unknown error", {
+                type: 'error',
+                autoClose: 2000,
+                position: 'bottom-right',
+            })
 
             console.error('Error fetching feedback:', err);
             setError('Unable to fetch feedback at this time. Please try again later.');
         } finally {
-            setLoading(false);
-            setHasFetched(true);
+            if (abort.current === controller) {
+                setLoading(false);
+                setHasFetched(true);
+                loadUsage();
+            }
         }
     };
 
@@ -60,6 +86,13 @@ const FeedbackTab: React.FC<FeedbackTabProps> = ({ problemID, code, feedback, se
                 </button>
             </div>
 
+            {usage?.Daily.Limit != null && (
+                <p className="text-sm text-gray-500">
+                    {Math.max(usage.Daily.Limit - usage.Daily.Used, 0)} of {usage.Daily.Limit} AI requests left today,
+                    resets at {new Date(usage.Daily.ResetAt).toLocaleTimeString()}.
+                </p>
+            )}
+
             {!code && (
                 <p className="text-sm text-gray-500">
                     Please write some code in the Problem tab to receive feedback.
@@ -0,0 +1,91 @@
+import React, { useEffect, useState } from 'react';
+import { AxiosError } from 'axios';
+import { toast } from 'react-toastify';
+import ReactMarkdown from 'react-markdown';
+import remarkGfm from 'remark-gfm';
+import { getHints, revealHint } from '../api/endpoints';
+import type { HintLadder } from '../types';
+
+interface HintsTabProps {
+    problemID: number;
+}
+
+const levelNames = ['Nudge', 'Key idea', 'Outline'];
+
+const HintsTab: React.FC<HintsTabProps> = ({ problemID }) => {
+    const [ladder, setLadder] = useState<HintLadder | null>(null);
+    const [revealing, setRevealing] = useState(0);
+
+    useEffect(() => {
+        getHints(problemID)
+            .then(res => setLadder(res.data))
+            .catch(err => console.error('Error fetching hints:', err));
+    }, [problemID]);
+
+    const reveal = async (level: number) => {
+        if (!ladder) return;
+        if (ladder.Penalty > 0 && !window.confirm(`This hint costs ${ladder.Penalty} points in the contest. Reveal it?`)) {
+            return;
+        }
+
+        setRevealing(level);
+        try {
+            const res = await revealHint(problemID, level);
+            setLadder({
+                ...ladder,
+                Hints: ladder.Hints.map(h => (h.Level === level ? res.data : h)),
+            });
+        } catch (err) {
+            toast(err instanceof AxiosError ? err.response?.data || 'unknown error' : 'unknown error', {
+                type: 'error',
+                autoClose: 2000,
+                position: 'bottom-right',
+            });
+        } finally {
+            setRevealing(0);
+        }
+    };
+
+    if (!ladder) {
+        return <p>Loading hints...</p>;
+    }
+
+    // Hints are revealed in order, only the first hidden one can be opened
+    const next = ladder.Hints.find(h => !h.Revealed)?.Level;
+
+    return (
+        <div className="max-w-3xl mx-auto space-y-4">
+            <h2 className="text-2xl font-semibold">Hints</h2>
+
+            {ladder.Disabled && (
+                <p className="text-sm text-gray-500">Hints are disabled during this contest.</p>
+            )}
+            {!ladder.Disabled && ladder.Penalty > 0 && (
+                <p className="text-sm text-gray-500">Each hint costs {ladder.Penalty} points in the running contest.</p>
+            )}
+
+            {ladder.Hints.map(hint => (
+                <div key={hint.Level} className="bg-gray-50 p-4 rounded-lg border border-gray-200">
+                    <h3 className="font-medium mb-2">
+                        Hint {hint.Level}: {levelNames[hint.Level - 1]}
+                    </h3>
+                    {hint.Revealed ? (
+                        <div className="prose prose-sm max-w-none">
+                            <ReactMarkdown remarkPlugins={[remarkGfm]}>{hint.Content || ''}</ReactMarkdown>
+                        </div>
+                    ) : (
+                        <button
+                            onClick={() => reveal(hint.Level)}
+                            disabled={hint.Level !== next || ladder.Disabled || revealing !== 0}
+                            className="bg-blue-600 hover:bg-blue-700 text-white px-4 py-2 rounded disabled:opacity-50"
+                        >
+                            {revealing === hint.Level ? 'Revealing...' : 'Reveal'}
+                        </button>
+                    )}
+                </div>
+            ))}
+        </div>
+    );
+};
+
+export default HintsTab;
@@ -2,9 +2,9 @@
 
 import React, { useState } from 'react';
 import { useForm } from 'react-hook-form';
-import { signup, login } from '../api/endpoints';
-import type { SignupPayload, LoginPayload } from '../types';
-import { useNavigate } from 'react-router-dom';
+import { signup, login, beginTwoFactorLoginSetup, completeTwoFactorLogin } from '../api/endpoints';
+import type { SignupPayload, LoginPayload, TwoFactorSetupResponse } from '../types';
+import { Link, useNavigate } from 'react-router-dom';
 import { useUser } from '../contexts/UserContext';
 import { AxiosError } from 'axios';
 import { toast } from 'react-toastify';
@@ -12,6 +12,10 @@ import { toast } from 'react-toastify';
 const AuthPage: React.FC = () => {
     const [isSignup, setIsSignup] = useState(false);
     const [serverError, setServerError] = useState('');
+    const [challenge, setChallenge] = useState<{ token: string; setupRequired: boolean } | null>(null);
+    const [setup, setSetup] = useState<TwoFactorSetupResponse | null>(null);
+    const [code, setCode] = useState('');
+    const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
     const navigate = useNavigate();
     const { getCurrentUserProfile } = useUser();
 
@@ -35,7 +39,15 @@ const AuthPage: React.FC = () => {
                     Username: data.Username,
                     Password: data.Password,
                 };
-                await login(loginData);
+                const res = await login(loginData);
+                if (res.data.two_factor_required && res.data.challenge) {
+                    setChallenge({ token: res.data.challenge, setupRequired: !!res.data.setup_required });
+                    if (res.data.setup_required) {
+                        const setupRes = await beginTwoFactorLoginSetup(res.data.challenge);
+                        setSetup(setupRes.data);
+                    }
+                    return;
+                }
                 navigate('/problems');
             }
             getCurrentUserProfile();
@@ -52,6 +64,104 @@ const AuthPage: React.FC = () => {
         }
     };
 
+    const onSubmitCode = async (e: React.FormEvent) => {
+        e.preventDefault();
+        if (!challenge) return;
+
+        try {
+            const res = await completeTwoFactorLogin(challenge.token, code);
+            getCurrentUserProfile();
+            if (res.data.recovery_codes?.length) {
+                setRecoveryCodes(res.data.recovery_codes);
+                return;
+            }
+            navigate('/problems');
+        } catch (err) {
+            if (err instanceof AxiosError) {
+                toast(err.response?.data || "unknown error", {
+                    type: 'error',
+                    autoClose: 2000,
+                    position: 'bottom-right',
+                })
+                // the challenge is gone, start over from the password
+                if (err.response?.status === 401) {
+                    setChallenge(null);
+                    setSetup(null);
+                }
+            }
+            setCode('');
+        }
+    };
+
+    if (recoveryCodes) {
+        return (
+            <div className="min-h-screen flex items-center justify-center bg-gray-50 px-4">
+                <div className="max-w-md w-full bg-white p-8 rounded shadow">
+                    <h2 className="text-2xl font-bold text-center mb-4">Save your recovery codes</h2>
+                    <p className="text-sm text-gray-600 mb-4">
+                        Each code logs you in once if you lose your authenticator. They won't be shown again.
+                    </p>
+                    <ul className="grid grid-cols-2 gap-2 font-mono text-center mb-6">
+                        {recoveryCodes.map((c) => (
+                            <li key={c} className="bg-gray-100 rounded py-1">{c}</li>
+                        ))}
+                    </ul>
+                    <button
+                        onClick={() => navigate('/problems')}
+                        className="w-full bg-blue-600 text-white py-2 px-4 rounded hover:bg-blue-700"
+                    >
+                        I saved them
+                    </button>
+                </div>
+            </div>
+        );
+    }
+
+    if (challenge) {
+        return (
+            <div className="min-h-screen flex items-center justify-center bg-gray-50 px-4">
+                <div className="max-w-md w-full bg-white p-8 rounded shadow">
+                    <h2 className="text-2xl font-bold text-center mb-6">Two-Factor Authentication</h2>
+
+                    {challenge.setupRequired && (
+                        <div className="mb-4 text-sm">
+                            <p className="text-gray-600 mb-2">
+                                Your account requires two-factor authentication. Add this key to your
+                                authenticator app, then enter the code it shows.
+                            </p>
+                            {setup && (
+                                <>
+                                    <p className="font-mono break-all bg-gray-100 rounded p-2">{setup.secret}</p>
+                                    <a href={setup.uri} className="text-blue-600 hover:underline">
+                                        Open in authenticator app
+                                    </a>
+                                </>
+                            )}
+                        </div>
+                    )}
+
+                    <form onSubmit={onSubmitCode} className="space-y-4">
+                        <input
+                            type="text"
+                            autoComplete="one-time-code"
+                            placeholder={challenge.setupRequired ? 'Code' : 'Code or recovery code'}
+                            value={code}
+                            onChange={(e) => setCode(e.target.value)}
+                            className="w-full px-4 py-2 border rounded focus:outline-none focus:ring"
+                        />
+                        <button
+                            type="submit"
+                            disabled={!code}
+                            className="w-full bg-blue-600 text-white py-2 px-4 rounded hover:bg-blue-700"
+                        >
+                            Verify
+                        </button>
+                    </form>
+                </div>
+            </div>
+        );
+    }
+
     return (
         <div className="min-h-screen flex items-center justify-center bg-gray-50 px-4">
             <div className="max-w-md w-full bg-white p-8 rounded shadow">
@@ -121,6 +231,14 @@ const AuthPage: React.FC = () => {
                     </button>
                 </form>
 
+                {!isSignup && (
+                    <p className="mt-4 text-sm text-center">
+                        <Link to="/reset-password" className="text-blue-600 hover:underline">
+                            Forgot your password?
+                        </Link>
+                    </p>
+                )}
+
                 <p className="mt-4 text-sm text-center">
                     {isSignup ? 'Already have an account?' : "Don't have an account?"}{' '}
                     <button
@@ -23,6 +23,7 @@ import type {
 import DiscussionsTab from '../components/DiscussionsTab';
 import ProblemDetails from '../components/ProblemDetails';
 import FeedbackTab from '../components/FeedbackTab';
+import HintsTab from '../components/HintsTab';
 import clsx from 'clsx';
 import { toast } from 'react-toastify';
 import { AxiosError } from 'axios';
@@ -241,7 +242,7 @@ const ProblemDetailPage: React.FC = () => {
   return (
     <div className="max-w-5xl mx-auto px-4 py-6 space-y-6">
       <div className="flex space-x-4 border-b-2 pb-2">
-        {['Problem', 'Discussions', 'Feedback'].map((label, idx) => (
+        {['Problem', 'Discussions', 'Feedback', 'Hints'].map((label, idx) => (
           <button
             key={label}
             className={clsx(
@@ -284,8 +285,10 @@ const ProblemDetailPage: React.FC = () => {
           // onVoteDiscussion={handleVoteDiscussion}
           />
         )
-      ) : (
+      ) : activeTab === 2 ? (
         <FeedbackTab problemID={problem.ID} code={code} feedback={feedback} setFeedback={setFeedback} />
+      ) : (
+        <HintsTab problemID={problem.ID} />
       )}
     </div>
   );
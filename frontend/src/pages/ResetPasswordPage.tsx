@@ -0,0 +1,110 @@
+// src/pages/ResetPasswordPage.tsx
+
+import React, { useState } from 'react';
+import { useForm } from 'react-hook-form';
+import { Link, useSearchParams } from 'react-router-dom';
+import { AxiosError } from 'axios';
+import { toast } from 'react-toastify';
+import { forgotPassword, resetPassword } from '../api/endpoints';
+
+interface ResetForm {
+    Email: string;
+    Password: string;
+}
+
+// Without a token this asks for the account's email and mails a reset link;
+// the link brings the user back here with the token to pick a new password.
+const ResetPasswordPage: React.FC = () => {
+    const [searchParams] = useSearchParams();
+    const token = searchParams.get('token');
+    const [done, setDone] = useState(false);
+
+    const {
+        register,
+        handleSubmit,
+        formState: { errors, isSubmitting },
+    } = useForm<ResetForm>();
+
+    const onSubmit = async (data: ResetForm) => {
+        try {
+            if (token) {
+                await resetPassword(token, data.Password);
+            } else {
+                await forgotPassword(data.Email);
+            }
+            setDone(true);
+        } catch (err) {
+            if (err instanceof AxiosError) {
+                toast(err.response?.data || "unknown error", {
+                    type: 'error',
+                    autoClose: 2000,
+                    position: 'bottom-right',
+                })
+            }
+        }
+    };
+
+    return (
+        <div className="min-h-screen flex items-center justify-center bg-gray-50 px-4">
+            <div className="max-w-md w-full bg-white p-8 rounded shadow">
+                <h2 className="text-2xl font-bold text-center mb-6">
+                    {token ? 'Choose a new password' : 'Reset your password'}
+                </h2>
+
+                {done ? (
+                    <p className="text-center text-gray-700">
+                        {token ? (
+                            <>Your password has been changed. <Link to="/auth" className="text-blue-600 hover:underline">Log in</Link></>
+                        ) : (
+                            'If that address belongs to an account, a reset link is on its way.'
+                        )}
+                    </p>
+                ) : (
+                    <form onSubmit={handleSubmit(onSubmit)} className="space-y-4">
+                        {token ? (
+                            <div>
+                                <input
+                                    type="password"
+                                    placeholder="New password"
+                                    {...register('Password', {
+                                        required: 'Password is required',
+                                        minLength: {
+                                            value: 8,
+                                            message: 'Password must be at least 8 characters',
+                                        },
+                                    })}
+                                    className="w-full px-4 py-2 border rounded focus:outline-none focus:ring"
+                                />
+                                {errors.Password && (
+                                    <p className="text-red-500 text-sm mt-1">{errors.Password.message}</p>
+                                )}
+                            </div>
+                        ) : (
+                            <div>
+                                <input
+                                    type="email"
+                                    placeholder="Email"
+                                    {...register('Email', { required: 'Email is required' })}
+                                    className="w-full px-4 py-2 border rounded focus:outline-none focus:ring"
+                                />
+                                {errors.Email && (
+                                    <p className="text-red-500 text-sm mt-1">{errors.Email.message}</p>
+                                )}
+                            </div>
+                        )}
+
+                        <button
+                            type="submit"
+                            disabled={isSubmitting}
+                            className="w-full bg-blue-600 text-white py-2 px-4 rounded hover:bg-blue-700"
+                        >
+                            {isSubmitting ? 'Please wait...' : token ? 'Change password' : 'Send reset link'}
+                        </button>
+                    </form>
+                )}
+            </div>
+        </div>
+    );
+};
+
+export default ResetPasswordPage;
@@ -0,0 +1,48 @@
+// src/pages/VerifyEmailPage.tsx
+
+import React, { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { AxiosError } from 'axios';
+import { verifyEmail } from '../api/endpoints';
+import { useUser } from '../contexts/UserContext';
+
+const VerifyEmailPage: React.FC = () => {
+    const [searchParams] = useSearchParams();
+    const [status, setStatus] = useState<'pending' | 'done' | 'failed'>('pending');
+    const [message, setMessage] = useState('');
+    const { getCurrentUserProfile } = useUser();
+    const sent = useRef(false);
+
+    useEffect(() => {
+        // Tokens are single-use, so don't send it twice in strict mode
+        if (sent.current) return;
+        sent.current = true;
+
+        verifyEmail(searchParams.get('token') || '')
+            .then(() => {
+                setStatus('done');
+                getCurrentUserProfile();
+            })
+            .catch((err) => {
+                setStatus('failed');
+                setMessage(err instanceof AxiosError ? err.response?.data || err.message : 'unknown error');
+            });
+    }, [searchParams, getCurrentUserProfile]);
+
+    return (
+        <div className="min-h-screen flex items-center justify-center bg-gray-50 px-4">
+            <div className="max-w-md w-full bg-white p-8 rounded shadow text-center">
+                <h2 className="text-2xl font-bold mb-4">Email verification</h2>
+                {status === 'pending' && <p className="text-gray-600">Verifying...</p>}
+                {status === 'done' && (
+                    <p className="text-green-600">
+                        Your email address is verified. <Link to="/contests" className="text-blue-600 hover:underline">Browse contests</Link>
+                    </p>
+                )}
+                {status === 'failed' && <p className="text-red-500">{message}</p>}
+            </div>
+        </div>
+    );
+};
+
+export default VerifyEmailPage;
@@ -13,6 +13,7 @@ export interface User {
     Email: string;
     Role: UserRole;
     Rating: number;
+    EmailVerified?: boolean;
     SolvedProblems: ProblemInfo[];
 }
 
@@ -94,6 +95,7 @@ export interface ContestParticipant {
     UserID: number;
     Username: string;
     Score: number;
+    HintPenalty?: number;
     ProblemsSolved: ContestProblem[];
     RatingChange: number;
 }
@@ -104,6 +106,7 @@ export interface Contest {
     Status: ContestStatus;
     StartTime: string; // ISO date-time string
     EndTime: string;
+    HintPenalty: number | null; // points per hint, null turns hints off
     Problems: ContestProblem[];
     Leaderboard: ContestParticipant[];
 }
@@ -164,6 +167,70 @@ export interface OkResponse {
     message: string;
 }
 
+// Set instead of message when the login needs a second factor
+export interface LoginResponse {
+    message?: string;
+    two_factor_required?: boolean;
+    setup_required?: boolean;
+    challenge?: string;
+}
+
+export interface TwoFactorSetupResponse {
+    secret: string;
+    uri: string;
+}
+
+export interface TwoFactorLoginResponse {
+    message: string;
+    recovery_codes: string[] | null;
+}
+
+export interface ProblemHint {
+    Level: number;
+    Content?: string;
+    Source?: 'author' | 'ai';
+    Revealed: boolean;
+    Penalty?: number;
+}
+
+export interface HintLadder {
+    Hints: ProblemHint[];
+    ContestID?: number;
+    Disabled: boolean;
+    Penalty: number;
+}
+
+export interface JobResponse {
+    job_id: number;
+}
+
+export interface AIJob {
+    ID: number;
+    Kind: 'explanation' | 'feedback' | 'test_cases';
+    ProblemID: number;
+    Status: 'queued' | 'running' | 'completed' | 'failed';
+    Attempts: number;
+    RunAt: string;
+    Result?: string;
+    Error?: string;
+    PromptVersion?: string; // e.g. "feedback.v1"
+    CreatedAt: string;
+    UpdatedAt: string;
+}
+
+export interface AIQuotaUsage {
+    Used: number;
+    Limit: number | null; // null when unlimited
+    ResetAt: string;
+}
+
+export interface AIUsageStatus {
+    Daily: AIQuotaUsage;
+    Monthly: AIQuotaUsage;
+    InputTokens: number; // this month
+    OutputTokens: number;
+}
+
 export interface IdResponse {
     id: number;
     run_id: number;